@@ -9,11 +9,13 @@ import (
 	"github.com/9bany/db/internal/platform/types"
 	"github.com/9bany/db/internal/table"
 	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/wal"
 	"github.com/spf13/cobra"
 )
 
 var (
-	Database string
+	Database   string
+	Durability string
 )
 
 func dropDb(dbName string) error {
@@ -53,6 +55,16 @@ func fakeInsertTbUser(dbName string) error {
 	if err != nil {
 		return err
 	}
+	defer db.Close()
+	mode, err := wal.ParseDurability(Durability)
+	if err != nil {
+		return err
+	}
+	policy := wal.DefaultDurabilityPolicy
+	policy.Mode = mode
+	if err := db.SetDurability(policy); err != nil {
+		return err
+	}
 	_, err = db.Tables["tb_user"].Insert(map[string]interface{}{
 		"id": int32(1),
 		"username": "bany",
@@ -75,6 +87,7 @@ func init() {
 	databaseCmd.AddCommand(fakeTbCmd)
 
 	fakeInsertTbCmd.PersistentFlags().StringVarP(&Database, "database_name", "d", "", "Database name")
+	fakeInsertTbCmd.PersistentFlags().StringVar(&Durability, "durability", string(wal.DurabilityAlways), "Durability: always, group, interval or off")
 	databaseCmd.AddCommand(fakeInsertTbCmd)
 
 	rootCmd.AddCommand(databaseCmd)
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/9bany/db/internal"
+	"github.com/spf13/cobra"
+)
+
+func checkpointDb(dbName string) (int64, error) {
+	db, err := internal.NewDatabase(dbName)
+	if err != nil {
+		return 0, err
+	}
+	return db.Checkpoint()
+}
+
+func init() {
+	checkpointCmd.PersistentFlags().StringVarP(&Database, "database_name", "d", "", "Database name")
+	walCmd.AddCommand(checkpointCmd)
+
+	rootCmd.AddCommand(walCmd)
+}
+
+var walCmd = &cobra.Command{
+	Use:   "wal",
+	Short: "Write-ahead log commands",
+	Long:  ``,
+}
+
+var checkpointCmd = &cobra.Command{
+	Use:   "checkpoint",
+	Short: "Flush the tables and truncate the write-ahead log",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(Database) == 0 {
+			os.Exit(0)
+		}
+		lsn, err := checkpointDb(Database)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Checkpoint at LSN %d\n", lsn)
+	},
+}
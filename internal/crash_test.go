@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/platform/vfs"
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useFS(t *testing.T, fsys vfs.FS) {
+	prev := FS
+	FS = fsys
+	t.Cleanup(func() { FS = prev })
+}
+
+// account is a row of the accounts table of the crash tests.
+type account struct {
+	owner   string
+	balance int64
+}
+
+type accounts map[int32]account
+
+func (a accounts) clone() accounts {
+	c := make(accounts, len(a))
+	for id, acc := range a {
+		c[id] = acc
+	}
+	return c
+}
+
+// crashWorkload runs random operations against the accounts table and
+// tracks what they committed.
+type crashWorkload struct {
+	rand   *rand.Rand
+	db     *Database
+	nextID int32
+	// committed holds the rows of every operation that succeeded
+	committed accounts
+}
+
+var crashOwners = []string{"al", "bany", "carol", "dominique", "evangeline-the-second"}
+
+func newCrashDatabase(t *testing.T, fsys *vfs.MemFS) *Database {
+	useFS(t, fsys)
+	useBaseDir(t, "/data")
+	db, err := CreateDatabase("crashdb")
+	require.Nil(t, err)
+	_, err = db.CreateTable("accounts", []string{"id", "owner", "balance"}, table.Columns{
+		"id":      column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+		"owner":   column.NewColumn("owner", types.TypeString, column.ColumnOptions{}),
+		"balance": column.NewColumn("balance", types.TypeInt64, column.ColumnOptions{}),
+	})
+	require.Nil(t, err)
+	return db
+}
+
+// step runs a random operation and returns the rows once it committed.
+func (w *crashWorkload) step() (accounts, error) {
+	next := w.committed.clone()
+	accs := w.db.Tables["accounts"]
+	switch op := w.rand.Intn(7); {
+	case op == 0 || len(next) < 2:
+		id := w.newID()
+		owner := w.owner()
+		next[id] = account{owner: owner, balance: 100}
+		_, err := accs.Insert(map[string]interface{}{"id": id, "owner": owner, "balance": int64(100)})
+		return next, err
+	case op == 1:
+		// a new owner of another length relocates the record
+		id, owner := w.pick(next), w.owner()
+		next[id] = account{owner: owner, balance: next[id].balance}
+		_, err := accs.Update(predicate.Eq("id", id), map[string]interface{}{"owner": owner})
+		return next, err
+	case op == 2:
+		id := w.pick(next)
+		delete(next, id)
+		_, err := accs.Delete(predicate.Eq("id", id))
+		return next, err
+	case op == 3:
+		return next, w.transfer(next)
+	case op == 4:
+		return next, w.openAndClose(next)
+	case op == 5:
+		tx, err := w.db.Begin()
+		if err != nil {
+			return next, err
+		}
+		id := w.newID()
+		if _, err := tx.Insert("accounts", map[string]interface{}{"id": id, "owner": w.owner(), "balance": int64(1)}); err != nil {
+			return next, err
+		}
+		return w.committed, tx.Rollback()
+	default:
+		_, err := w.db.Checkpoint()
+		return next, err
+	}
+}
+
+// transfer moves money between two accounts in a transaction.
+func (w *crashWorkload) transfer(next accounts) error {
+	from, to := w.pick(next), w.pick(next)
+	for to == from {
+		to = w.pick(next)
+	}
+	amount := int64(w.rand.Intn(50) + 1)
+	next[from] = account{owner: next[from].owner, balance: next[from].balance - amount}
+	next[to] = account{owner: next[to].owner, balance: next[to].balance + amount}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Update("accounts", predicate.Eq("id", from), map[string]interface{}{"balance": next[from].balance}); err != nil {
+		return err
+	}
+	if _, err := tx.Update("accounts", predicate.Eq("id", to), map[string]interface{}{"balance": next[to].balance}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// openAndClose opens two accounts and closes one in a transaction.
+func (w *crashWorkload) openAndClose(next accounts) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		id, owner := w.newID(), w.owner()
+		next[id] = account{owner: owner, balance: 10}
+		if _, err := tx.Insert("accounts", map[string]interface{}{"id": id, "owner": owner, "balance": int64(10)}); err != nil {
+			return err
+		}
+	}
+	closed := w.pick(next)
+	delete(next, closed)
+	if _, err := tx.Delete("accounts", predicate.Eq("id", closed)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (w *crashWorkload) newID() int32 {
+	w.nextID++
+	return w.nextID
+}
+
+func (w *crashWorkload) owner() string {
+	return crashOwners[w.rand.Intn(len(crashOwners))]
+}
+
+// pick returns a random account of rows.
+func (w *crashWorkload) pick(rows accounts) int32 {
+	ids := make([]int32, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	// map order is random, the workload must only depend on the seed
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids[w.rand.Intn(len(ids))]
+}
+
+func readAccounts(t *testing.T, db *Database) accounts {
+	rows, err := db.Tables["accounts"].Select(nil)
+	require.Nil(t, err)
+	result := make(accounts, len(rows))
+	for _, row := range rows {
+		id := row["id"].(int32)
+		_, dup := result[id]
+		require.False(t, dup, "account %d is duplicated", id)
+		result[id] = account{owner: row["owner"].(string), balance: row["balance"].(int64)}
+	}
+	return result
+}
+
+// TestCrashRecovery crashes the database at a random point of a random
+// workload, with random unsynced writes lost or torn, and checks that
+// recovery restores every committed operation and the interrupted one
+// either entirely or not at all.
+func TestCrashRecovery(t *testing.T) {
+	seeds := 200
+	if testing.Short() {
+		seeds = 20
+	}
+	for seed := int64(1); seed <= int64(seeds); seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			testCrashRecovery(t, seed)
+		})
+	}
+}
+
+func testCrashRecovery(t *testing.T, seed int64) {
+	fsys := vfs.NewMemFS(seed)
+	db := newCrashDatabase(t, fsys)
+	w := &crashWorkload{rand: rand.New(rand.NewSource(seed)), db: db, committed: make(accounts)}
+
+	// interrupted holds the rows of the operation the crash interrupted
+	interrupted := w.committed
+	fsys.CrashAfter(1 + w.rand.Intn(600))
+	for i := 0; i < 60; i++ {
+		next, err := w.step()
+		if fsys.Crashed() {
+			interrupted = next
+			break
+		}
+		require.Nil(t, err, "operation %d", i)
+		w.committed = next
+	}
+	fsys.Crash()
+
+	reopened, err := NewDatabase("crashdb")
+	require.Nil(t, err)
+	recovered := readAccounts(t, reopened)
+	if !assert.ObjectsAreEqual(w.committed, recovered) {
+		require.Equal(t, interrupted, recovered, "the recovered accounts are neither the committed ones nor the interrupted operation")
+	}
+	pending, err := reopened.wal.Pending()
+	require.Nil(t, err)
+	require.Empty(t, pending)
+
+	// recovery is durable and does not need to run again
+	fsys.Crash()
+	reopened, err = NewDatabase("crashdb")
+	require.Nil(t, err)
+	require.Equal(t, recovered, readAccounts(t, reopened))
+
+	// the recovered database keeps working across crashes
+	w.db, w.committed = reopened, recovered
+	for i := 0; i < 5; i++ {
+		next, err := w.step()
+		require.Nil(t, err)
+		w.committed = next
+	}
+	fsys.Crash()
+	reopened, err = NewDatabase("crashdb")
+	require.Nil(t, err)
+	require.Equal(t, w.committed, readAccounts(t, reopened))
+}
@@ -5,24 +5,29 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/9bany/db/internal/platform/parser"
 	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/platform/vfs"
 	"github.com/9bany/db/internal/table"
 	columnio "github.com/9bany/db/internal/table/column/io"
+	"github.com/9bany/db/internal/table/lock"
+	"github.com/9bany/db/internal/table/mvcc"
 	"github.com/9bany/db/internal/table/wal"
 )
 
-const (
-	BaseDir = "./data"
-)
+// BaseDir is the directory holding every database.
+var BaseDir = "./data"
+
+// FS is the file system holding every database.
+var FS vfs.FS = vfs.OS{}
 
 func path(name string) string {
 	return filepath.Join(BaseDir, name)
 }
 
 func exists(name string) bool {
-	_, err := os.Stat(path(name))
+	_, err := FS.Stat(path(name))
 	return !os.IsNotExist(err)
 }
 
@@ -31,7 +36,14 @@ type Tables map[string]*table.Table
 type Database struct {
 	name   string
 	path   string
+	fs     vfs.FS
 	Tables Tables
+	// wal is the log shared by every table
+	wal *wal.WAL
+	// txs hands out the transaction IDs and snapshots of every table
+	txs *mvcc.Manager
+	// locks are the table and record locks of the transactions
+	locks *lock.Manager
 }
 
 func CreateDatabase(name string) (*Database, error) {
@@ -39,18 +51,28 @@ func CreateDatabase(name string) (*Database, error) {
 		return nil, NewDatabaseAlreadyExistsError(name)
 	}
 
-	if err := os.MkdirAll(path(name), 0777); err != nil {
+	if err := FS.MkdirAll(path(name), 0777); err != nil {
 		return nil, fmt.Errorf("CreateDatabase: %w", err)
 	}
-	return &Database{
+	writeAheadLog, err := wal.NewWalFS(FS, path(name), wal.DatabaseLogName)
+	if err != nil {
+		return nil, fmt.Errorf("CreateDatabase: %w", err)
+	}
+	db := &Database{
 		name:   name,
 		path:   path(name),
+		fs:     FS,
 		Tables: make(Tables),
-	}, nil
+		wal:    writeAheadLog,
+		txs:    mvcc.NewManager(),
+		locks:  lock.NewManager(lock.DefaultTimeout),
+	}
+	db.SetCheckpointPolicy(wal.DefaultCheckpointPolicy)
+	return db, nil
 }
 
 func DropDatabase(name string) error {
-	if err := os.RemoveAll(path(name)); err != nil {
+	if err := FS.RemoveAll(path(name)); err != nil {
 		return fmt.Errorf("DropDatabase: %w", err)
 	}
 	return nil
@@ -60,18 +82,37 @@ func NewDatabase(name string) (*Database, error) {
 	if !exists(name) {
 		return nil, NewDatabaseDoesNotExistError(name)
 	}
+	writeAheadLog, err := wal.NewWalFS(FS, path(name), wal.DatabaseLogName)
+	if err != nil {
+		return nil, fmt.Errorf("NewDatabase: %w", err)
+	}
 	db := &Database{
-		name: name,
-		path: path(name),
+		name:  name,
+		path:  path(name),
+		fs:    FS,
+		wal:   writeAheadLog,
+		txs:   mvcc.NewManager(),
+		locks: lock.NewManager(lock.DefaultTimeout),
 	}
 
-	table, err := db.readTables()
+	// spill files only outlive the query that wrote them in a crash
+	if err := db.fs.RemoveAll(filepath.Join(db.path, table.SpillDirName)); err != nil {
+		return nil, fmt.Errorf("NewDatabase: %w", err)
+	}
+	tables, err := db.readTables()
 	if err != nil {
 		return nil, fmt.Errorf("NewDatabase: %w", err)
 	}
-	db.Tables = table
+	db.Tables = tables
+	if err := db.recover(); err != nil {
+		return nil, fmt.Errorf("NewDatabase: %w", err)
+	}
+	db.SetCheckpointPolicy(wal.DefaultCheckpointPolicy)
 	for _, t := range db.Tables {
-		if err := t.RestoreWAL(); err != nil {
+		if err := t.LoadIndexes(); err != nil {
+			return nil, fmt.Errorf("NewDatabase: %w", err)
+		}
+		if err := t.LoadStatistics(); err != nil {
 			return nil, fmt.Errorf("NewDatabase: %w", err)
 		}
 	}
@@ -84,84 +125,187 @@ func (db *Database) CreateTable(name string,
 
 	path := filepath.Join(path(db.name), name+table.FileExtension)
 
-	if _, err := os.Open(path); err == nil {
+	if _, err := db.fs.Stat(path); err == nil {
 		return nil, NewTableAlreadyExistsError(name)
 	}
 
-	f, err := os.Create(path)
+	f, err := db.fs.Create(path)
 	if err != nil {
 		return nil, NewCannotCreateTableError(err, name)
 	}
 
-	recParser := parser.NewRecordParser(f, columnNames)
-
-	t, err := table.NewTableWithColumns(f, columns, columnNames)
+	def, err := table.NewTableWithColumns(f, columns, columnNames)
 	if err != nil {
+		f.Close()
 		return nil, NewCannotCreateTableError(err, name)
 	}
 
-	err = t.WriteColumnDefinitions(f)
+	err = def.WriteColumnDefinitions(f)
 	if err != nil {
+		f.Close()
+		return nil, NewCannotCreateTableError(err, name)
+	}
+	// the log does not cover the column definitions
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return nil, NewCannotCreateTableError(err, name)
+	}
+	if err = f.Close(); err != nil {
 		return nil, NewCannotCreateTableError(err, name)
 	}
-	db.Tables[name] = t
 
-	err = t.SetRecordParser(recParser)
+	t, err := db.openTable(path)
 	if err != nil {
 		return nil, NewCannotCreateTableError(err, name)
 	}
+	db.Tables[name] = t
 
 	return t, nil
 
 }
 
+// Analyze collects planner statistics for the named tables, or for every
+// table when no name is given.
+func (db *Database) Analyze(names ...string) error {
+	if len(names) == 0 {
+		for name := range db.Tables {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		t, ok := db.Tables[name]
+		if !ok {
+			return fmt.Errorf("Database.Analyze: %w", NewTableDoesNotExistError(name))
+		}
+		if _, err := t.Analyze(); err != nil {
+			return fmt.Errorf("Database.Analyze: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetCheckpointPolicy sets when commits trigger a checkpoint.
+func (db *Database) SetCheckpointPolicy(p wal.CheckpointPolicy) {
+	db.wal.SetCheckpointPolicy(p, func() error {
+		_, err := db.Checkpoint()
+		return err
+	})
+}
+
+// SetLockTimeout sets how long a transaction waits for a lock before it is
+// aborted.
+func (db *Database) SetLockTimeout(timeout time.Duration) {
+	db.locks.SetTimeout(timeout)
+}
+
+// SetDurability sets when commits are forced to stable storage.
+func (db *Database) SetDurability(p wal.DurabilityPolicy) error {
+	if err := db.wal.SetDurability(p); err != nil {
+		return fmt.Errorf("Database.SetDurability: %w", err)
+	}
+	return nil
+}
+
+// Close syncs and closes the log. The database must not be used after.
+func (db *Database) Close() error {
+	if err := db.wal.Close(); err != nil {
+		return fmt.Errorf("Database.Close: %w", err)
+	}
+	return nil
+}
+
+// Checkpoint flushes every table to disk and removes the entries they hold
+// from the log. It returns the checkpoint LSN: recovery never goes back
+// past it.
+func (db *Database) Checkpoint() (int64, error) {
+	for _, t := range db.Tables {
+		if err := t.Flush(); err != nil {
+			return 0, fmt.Errorf("Database.Checkpoint: %w", err)
+		}
+	}
+	lsn, err := db.wal.Checkpoint()
+	if err != nil {
+		return 0, fmt.Errorf("Database.Checkpoint: %w", err)
+	}
+	return lsn, nil
+}
+
+// recover brings every table up to date with the log, see WAL.Recover.
+// Entries are redone in LSN order whatever table they belong to.
+func (db *Database) recover() error {
+	err := db.wal.Recover(func(record *wal.Record) error {
+		return db.eachTable(record, func(t *table.Table, ops []wal.Operation) error {
+			return t.RedoOps(record.LSN, ops)
+		})
+	}, func(record *wal.Record, abort int64) error {
+		return db.eachTable(record, func(t *table.Table, ops []wal.Operation) error {
+			return t.UndoOps(abort, ops)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("Database.recover: %w", err)
+	}
+	return nil
+}
+
+// eachTable calls fn with every table changed by record and its
+// operations on the table.
+func (db *Database) eachTable(record *wal.Record, fn func(t *table.Table, ops []wal.Operation) error) error {
+	ops, err := record.Operations()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0)
+	byTable := make(map[string][]wal.Operation)
+	for _, op := range ops {
+		if _, ok := byTable[op.Table]; !ok {
+			names = append(names, op.Table)
+		}
+		byTable[op.Table] = append(byTable[op.Table], op)
+	}
+	for _, name := range names {
+		t, ok := db.Tables[name]
+		if !ok {
+			return NewTableDoesNotExistError(name)
+		}
+		if err := fn(t, byTable[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *Database) readTables() (Tables, error) {
-	entries, err := os.ReadDir(db.path)
+	entries, err := db.fs.ReadDir(db.path)
 	if err != nil {
 		return nil, fmt.Errorf("Database.readTables: %w", err)
 	}
 	tables := make([]*table.Table, 0)
 	for _, e := range entries {
+		// the spill directory of queries
+		if e.IsDir() {
+			continue
+		}
 		if strings.Contains(e.Name(), "_wal") {
 			continue
 		}
 		if strings.Contains(e.Name(), "_idx") {
 			continue
 		}
-		if _, err := e.Info(); err != nil {
-			return nil, fmt.Errorf("Database.readTables: %w", err)
-		}
-
-		f, err := os.OpenFile(filepath.Join(db.path, e.Name()), os.O_RDWR, 0777)
-		if err != nil {
-			return nil, fmt.Errorf("Database.readTables: %w", err)
-		}
-
-		r := parserio.NewReader(f)
-		columnDefReader := columnio.NewColumnDefinitionReader(r)
-
-		tableName, err := table.GetTableName(f)
-		if err != nil {
-			return nil, fmt.Errorf("Database.readTables: %w", err)
+		if strings.Contains(e.Name(), "_stats") {
+			continue
 		}
-
-		writeAheadLog, err := wal.NewWal(db.path, tableName)
-		if err != nil {
-			return nil, fmt.Errorf("Database.readTables: %w", err)
+		if strings.Contains(e.Name(), "_fts") {
+			continue
 		}
-
-		t, err := table.NewTable(f, r, columnDefReader, writeAheadLog)
-		if err != nil {
+		if _, err := e.Info(); err != nil {
 			return nil, fmt.Errorf("Database.readTables: %w", err)
 		}
 
-		err = t.ReadColumnDefinitions()
+		t, err := db.openTable(filepath.Join(db.path, e.Name()))
 		if err != nil {
 			return nil, fmt.Errorf("Database.readTables: %w", err)
 		}
-		if err = t.SetRecordParser(parser.NewRecordParser(f, t.ColumnNames())); err != nil {
-			return nil, fmt.Errorf("Database.readTables: %w", err)
-		}
 		tables = append(tables, t)
 	}
 
@@ -172,3 +316,26 @@ func (db *Database) readTables() (Tables, error) {
 
 	return tablesMap, nil
 }
+
+func (db *Database) openTable(path string) (*table.Table, error) {
+	f, err := db.fs.OpenFile(path, os.O_RDWR, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("Database.openTable: %w", err)
+	}
+
+	r := parserio.NewReader(f)
+	columnDefReader := columnio.NewColumnDefinitionReader(r)
+
+	t, err := table.NewTable(f, r, columnDefReader, db.wal)
+	if err != nil {
+		return nil, fmt.Errorf("Database.openTable: %w", err)
+	}
+
+	err = t.ReadColumnDefinitions()
+	if err != nil {
+		return nil, fmt.Errorf("Database.openTable: %w", err)
+	}
+	t.SetTxManager(db.txs)
+	t.SetFS(db.fs)
+	return t, nil
+}
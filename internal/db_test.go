@@ -5,13 +5,19 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/9bany/db/internal/platform/vfs"
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewDatabase_Success(t *testing.T) {
 	// Create a temporary directory to simulate the database
 	tempDir := t.TempDir()
+	useBaseDir(t, tempDir)
 	dbPath := filepath.Join(tempDir, "testdb")
 	err := os.Mkdir(dbPath, 0777)
 	assert.Nil(t, err)
@@ -30,9 +36,146 @@ func TestNewDatabase_Success(t *testing.T) {
 	assert.Contains(t, db.Tables, "table1")
 }
 
+func useBaseDir(t *testing.T, dir string) {
+	prev := BaseDir
+	BaseDir = dir
+	t.Cleanup(func() { BaseDir = prev })
+}
+
 func TestNewDatabase_DatabaseDoesNotExist(t *testing.T) {
 	// Call NewDatabase with a non-existent database
 	_, err := NewDatabase("nonexistentdb")
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "database nonexistentdb does not exist")
 }
+
+func TestNewDatabase_RecoversSharedLogInLSNOrder(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	snapshot := db.txs.Snapshot()
+	users, orders := db.Tables["users"].NewChanges(snapshot), db.Tables["orders"].NewChanges(snapshot)
+	_, err := orders.Delete(predicate.Eq("user_id", int32(1)))
+	assert.Nil(t, err)
+	_, err = users.Insert(map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+
+	// log changes of both tables as separate entries and crash before
+	// applying any of them
+	var last *wal.Entry
+	for _, c := range []*table.Changes{orders, users} {
+		ops, err := c.Prepare()
+		assert.Nil(t, err)
+		for _, op := range ops {
+			last, err = db.wal.AppendLog(op.Op, op.Table, op.Data)
+			assert.Nil(t, err)
+		}
+	}
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err := reopened.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{12}, selectTxIDs(rows))
+	rows, err = reopened.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4}, selectTxIDs(rows))
+
+	// LSNs keep increasing after the log is reopened
+	_, err = reopened.Tables["users"].Insert(map[string]interface{}{"id": int32(5), "name": "dave"})
+	assert.Nil(t, err)
+	pending, err := reopened.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+	entry, err := reopened.wal.AppendLog("insert", "users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, last.LSN+2, entry.LSN)
+}
+
+func TestNewDatabase_IgnoresLeftoverSpillFiles(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	rows, err := db.Tables["users"].Query(table.Query{OrderBy: []table.OrderBy{table.Desc("name")}, SortMemoryLimit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+
+	// a crash in the middle of a query leaves its spill files behind
+	dir := filepath.Join(db.path, table.SpillDirName)
+	assert.Nil(t, os.MkdirAll(dir, 0777))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "spill_1.bin"), []byte{1, 2, 3}, 0644))
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	assert.Len(t, reopened.Tables, 2)
+	assert.Contains(t, reopened.Tables, "users")
+	assert.Contains(t, reopened.Tables, "orders")
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDatabase_SpillsToItsFS(t *testing.T) {
+	fsys := vfs.NewMemFS(1)
+	db := newCrashDatabase(t, fsys)
+	accounts := db.Tables["accounts"]
+	for i, owner := range []string{"al", "bany", "carol"} {
+		_, err := accounts.Insert(map[string]interface{}{"id": int32(i), "owner": owner, "balance": int64(i)})
+		assert.Nil(t, err)
+	}
+
+	rows, err := accounts.Query(table.Query{OrderBy: []table.OrderBy{table.Desc("owner")}, SortMemoryLimit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+	rows, err = accounts.Aggregate(table.AggregateQuery{GroupBy: []string{"owner"}, MaxGroups: 1})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+
+	// the spill files were created and removed in the file system of the
+	// database
+	entries, err := fsys.ReadDir(filepath.Join(db.path, table.SpillDirName))
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDatabase_Checkpoint(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	size, err := db.wal.Size()
+	assert.Nil(t, err)
+	assert.NotZero(t, size)
+
+	lsn, err := db.Checkpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), lsn)
+	size, err = db.wal.Size()
+	assert.Nil(t, err)
+	assert.Zero(t, size)
+
+	// the tables hold every checkpointed change once reopened
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err := reopened.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{10, 11, 12}, selectTxIDs(rows))
+
+	reopened.SetCheckpointPolicy(wal.CheckpointPolicy{Interval: time.Nanosecond})
+	_, err = reopened.Tables["users"].Insert(map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	checkpoint, err := reopened.wal.CheckpointLSN()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), checkpoint)
+}
+
+func TestDatabase_SetDurability(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	assert.Equal(t, wal.DefaultDurabilityPolicy, db.wal.Durability())
+
+	err := db.SetDurability(wal.DurabilityPolicy{Mode: "sometimes"})
+	assert.ErrorAs(t, err, new(*wal.UnknownDurabilityError))
+
+	assert.Nil(t, db.SetDurability(wal.DurabilityPolicy{Mode: wal.DurabilityGroup, Window: time.Millisecond}))
+	_, err = db.Tables["users"].Insert(map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err := reopened.Tables["users"].Select(predicate.Eq("id", int32(4)))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+}
@@ -76,3 +76,37 @@ type DatabaseDoesNotExistError struct {
 func (e *DatabaseDoesNotExistError) Error() string {
 	return fmt.Sprintf("database %s does not exist", e.name)
 }
+
+func NewTableDoesNotExistError(name string) *TableDoesNotExistError {
+	return &TableDoesNotExistError{name: name}
+}
+
+type TableDoesNotExistError struct {
+	name string
+}
+
+func (e *TableDoesNotExistError) Error() string {
+	return fmt.Sprintf("table %s does not exist", e.name)
+}
+
+func NewTxDoneError() *TxDoneError {
+	return &TxDoneError{}
+}
+
+type TxDoneError struct{}
+
+func (e *TxDoneError) Error() string {
+	return "transaction has already been committed or rolled back"
+}
+
+func NewSavepointDoesNotExistError(name string) *SavepointDoesNotExistError {
+	return &SavepointDoesNotExistError{name: name}
+}
+
+type SavepointDoesNotExistError struct {
+	name string
+}
+
+func (e *SavepointDoesNotExistError) Error() string {
+	return fmt.Sprintf("savepoint %s does not exist", e.name)
+}
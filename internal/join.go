@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/9bany/db/internal/table/join"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// JoinClause joins Table on LeftColumn = RightColumn. LeftColumn is a
+// qualified "table.column" name and RightColumn a column of Table.
+type JoinClause struct {
+	Table       string
+	Type        join.Type
+	LeftColumn  string
+	RightColumn string
+	Strategy    join.Strategy
+}
+
+type JoinQuery struct {
+	From  string
+	Joins []JoinClause
+	Where predicate.Predicate
+}
+
+// Join combines tables of the database. Returned rows are keyed by
+// qualified "table.column" names.
+func (db *Database) Join(q JoinQuery) ([]map[string]interface{}, error) {
+	query, err := db.resolveJoin(q)
+	if err != nil {
+		return nil, fmt.Errorf("Database.Join: %w", err)
+	}
+	rows, err := join.Run(query)
+	if err != nil {
+		return nil, fmt.Errorf("Database.Join: %w", err)
+	}
+	return rows, nil
+}
+
+// ExplainJoin returns the physical plan of q. With analyze the join is
+// executed and every operator reports its actual rows, pages and time.
+func (db *Database) ExplainJoin(q JoinQuery, analyze bool) (*plan.Node, error) {
+	query, err := db.resolveJoin(q)
+	if err != nil {
+		return nil, fmt.Errorf("Database.ExplainJoin: %w", err)
+	}
+	node, err := join.Explain(query, analyze)
+	if err != nil {
+		return nil, fmt.Errorf("Database.ExplainJoin: %w", err)
+	}
+	return node, nil
+}
+
+func (db *Database) resolveJoin(q JoinQuery) (join.Query, error) {
+	from, ok := db.Tables[q.From]
+	if !ok {
+		return join.Query{}, NewTableDoesNotExistError(q.From)
+	}
+	query := join.Query{From: from, Where: q.Where}
+	for _, c := range q.Joins {
+		t, ok := db.Tables[c.Table]
+		if !ok {
+			return join.Query{}, NewTableDoesNotExistError(c.Table)
+		}
+		query.Joins = append(query.Joins, join.Clause{
+			Table:       t,
+			Type:        c.Type,
+			LeftColumn:  c.LeftColumn,
+			RightColumn: c.RightColumn,
+			Strategy:    c.Strategy,
+		})
+	}
+	return query, nil
+}
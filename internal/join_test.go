@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/join"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func newJoinTestDatabase(t *testing.T) *Database {
+	useBaseDir(t, t.TempDir())
+	db, err := CreateDatabase("jointestdb")
+	assert.Nil(t, err)
+
+	users, err := db.CreateTable("users", []string{"id", "name"}, table.Columns{
+		"id":   column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+		"name": column.NewColumn("name", types.TypeString, column.ColumnOptions{}),
+	})
+	assert.Nil(t, err)
+	orders, err := db.CreateTable("orders", []string{"id", "user_id", "total"}, table.Columns{
+		"id":      column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+		"user_id": column.NewColumn("user_id", types.TypeInt32, column.ColumnOptions{}),
+		"total":   column.NewColumn("total", types.TypeInt64, column.ColumnOptions{}),
+	})
+	assert.Nil(t, err)
+
+	for _, u := range []map[string]interface{}{
+		{"id": int32(1), "name": "bany"},
+		{"id": int32(2), "name": "alice"},
+		{"id": int32(3), "name": "bob"},
+	} {
+		_, err := users.Insert(u)
+		assert.Nil(t, err)
+	}
+	for _, o := range []map[string]interface{}{
+		{"id": int32(10), "user_id": int32(1), "total": int64(100)},
+		{"id": int32(11), "user_id": int32(1), "total": int64(50)},
+		{"id": int32(12), "user_id": int32(2), "total": int64(70)},
+	} {
+		_, err := orders.Insert(o)
+		assert.Nil(t, err)
+	}
+	return db
+}
+
+func pairs(rows []map[string]interface{}) [][2]interface{} {
+	result := make([][2]interface{}, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, [2]interface{}{row["users.name"], row["orders.id"]})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, _ := result[i][1].(int32)
+		b, _ := result[j][1].(int32)
+		if a != b {
+			return a < b
+		}
+		return result[i][0].(string) < result[j][0].(string)
+	})
+	return result
+}
+
+func TestJoin_Strategies(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	assert.Nil(t, db.Tables["orders"].CreateIndex("user_id", false))
+
+	expected := [][2]interface{}{{"bany", int32(10)}, {"bany", int32(11)}, {"alice", int32(12)}}
+	for _, strategy := range []join.Strategy{join.Auto, join.NestedLoop, join.HashJoin, join.IndexNestedLoop} {
+		rows, err := db.Join(JoinQuery{
+			From: "users",
+			Joins: []JoinClause{{
+				Table:       "orders",
+				Type:        join.Inner,
+				LeftColumn:  "users.id",
+				RightColumn: "user_id",
+				Strategy:    strategy,
+			}},
+		})
+		assert.Nil(t, err, strategy)
+		assert.Equal(t, expected, pairs(rows), strategy)
+	}
+}
+
+func TestJoin_StrategiesUseCollation(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	tags, err := db.CreateTable("tags", []string{"name", "tag"}, table.Columns{
+		"name": column.NewColumn("name", types.TypeString, column.ColumnOptions{Collation: collate.NoCase}),
+		"tag":  column.NewColumn("tag", types.TypeString, column.ColumnOptions{}),
+	})
+	assert.Nil(t, err)
+	for _, tag := range []map[string]interface{}{
+		{"name": "BANY", "tag": "admin"},
+		{"name": "Alice", "tag": "staff"},
+	} {
+		_, err := tags.Insert(tag)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tags.CreateIndex("name", false))
+
+	for _, strategy := range []join.Strategy{join.NestedLoop, join.HashJoin, join.IndexNestedLoop} {
+		rows, err := db.Join(JoinQuery{
+			From: "users",
+			Joins: []JoinClause{{
+				Table:       "tags",
+				Type:        join.Inner,
+				LeftColumn:  "users.name",
+				RightColumn: "name",
+				Strategy:    strategy,
+			}},
+		})
+		assert.Nil(t, err, strategy)
+		tagged := make(map[interface{}]interface{}, len(rows))
+		for _, row := range rows {
+			tagged[row["users.name"]] = row["tags.tag"]
+		}
+		assert.Equal(t, map[interface{}]interface{}{"bany": "admin", "alice": "staff"}, tagged, strategy)
+	}
+}
+
+func TestJoin_LeftAndCross(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	rows, err := db.Join(JoinQuery{
+		From: "users",
+		Joins: []JoinClause{{
+			Table:       "orders",
+			Type:        join.Left,
+			LeftColumn:  "users.id",
+			RightColumn: "user_id",
+		}},
+		Where: predicate.IsNull("orders.id"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]interface{}{{"bob", nil}}, pairs(rows))
+
+	rows, err = db.Join(JoinQuery{
+		From:  "users",
+		Joins: []JoinClause{{Table: "orders", Type: join.Cross}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 9)
+}
+
+func TestJoin_Invalid(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	_, err := db.Join(JoinQuery{From: "missing"})
+	assert.NotNil(t, err)
+	_, err = db.Join(JoinQuery{
+		From:  "users",
+		Joins: []JoinClause{{Table: "orders", Type: join.Inner, LeftColumn: "users.id", RightColumn: "missing"}},
+	})
+	assert.NotNil(t, err)
+	_, err = db.Join(JoinQuery{
+		From: "users",
+		Joins: []JoinClause{{
+			Table: "orders", Type: join.Inner, LeftColumn: "users.id", RightColumn: "user_id", Strategy: join.IndexNestedLoop,
+		}},
+	})
+	assert.NotNil(t, err)
+	// an int32 key never matches a string one
+	_, err = db.Join(JoinQuery{
+		From:  "users",
+		Joins: []JoinClause{{Table: "orders", Type: join.Inner, LeftColumn: "users.name", RightColumn: "user_id"}},
+	})
+	assert.ErrorContains(t, err, "cannot join users.name")
+	// integers of any width share their keys
+	_, err = db.Join(JoinQuery{
+		From:  "users",
+		Joins: []JoinClause{{Table: "orders", Type: join.Inner, LeftColumn: "users.id", RightColumn: "total"}},
+	})
+	assert.Nil(t, err)
+}
+
+func TestJoin_Explain(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	assert.Nil(t, db.Tables["orders"].CreateIndex("user_id", false))
+
+	q := JoinQuery{
+		From: "users",
+		Joins: []JoinClause{{
+			Table:       "orders",
+			Type:        join.Inner,
+			LeftColumn:  "users.id",
+			RightColumn: "user_id",
+		}},
+		Where: predicate.Gt("orders.total", int64(60)),
+	}
+	node, err := db.ExplainJoin(q, false)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpFilter, node.Operator)
+	joinNode := node.Find(plan.OpJoin)
+	assert.Contains(t, joinNode.Details, "Strategy: "+string(join.IndexNestedLoop))
+	assert.Equal(t, "user_id", joinNode.Children[1].Index)
+
+	node, err = db.ExplainJoin(q, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), node.ActualRows)
+	joinNode = node.Find(plan.OpJoin)
+	assert.Equal(t, int64(3), joinNode.ActualRows)
+	assert.Equal(t, int64(3), joinNode.Children[0].ActualRows)
+	assert.Equal(t, int64(3), joinNode.Children[1].ActualRows)
+}
+
+func TestJoin_OptimizeOrdersInnerJoins(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	vips, err := db.CreateTable("vips", []string{"user_id"}, table.Columns{
+		"user_id": column.NewColumn("user_id", types.TypeInt32, column.ColumnOptions{}),
+	})
+	assert.Nil(t, err)
+	_, err = vips.Insert(map[string]interface{}{"user_id": int32(1)})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Analyze())
+
+	q := JoinQuery{
+		From: "users",
+		Joins: []JoinClause{
+			{Table: "orders", Type: join.Inner, LeftColumn: "users.id", RightColumn: "user_id"},
+			{Table: "vips", Type: join.Inner, LeftColumn: "users.id", RightColumn: "user_id"},
+		},
+	}
+	node, err := db.ExplainJoin(q, false)
+	assert.Nil(t, err)
+	// the most selective join runs first, at the bottom of the tree
+	first := node.Children[0]
+	assert.Equal(t, plan.OpJoin, first.Operator)
+	assert.Equal(t, "vips", first.Children[1].Table)
+
+	rows, err := db.Join(q)
+	assert.Nil(t, err)
+	assert.Equal(t, [][2]interface{}{{"bany", int32(10)}, {"bany", int32(11)}}, pairs(rows))
+}
@@ -0,0 +1,75 @@
+package collate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/9bany/db/internal/platform/types"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Collation defines how the strings of a column are compared. Other values
+// are compared the same way under every collation.
+type Collation byte
+
+const (
+	// Binary compares strings byte by byte.
+	Binary Collation = iota
+	// NoCase compares strings after Unicode case folding.
+	NoCase
+	// Unicode compares strings after NFC normalization, so precomposed and
+	// decomposed forms of a character are equal.
+	Unicode
+)
+
+var names = map[Collation]string{
+	Binary:  "binary",
+	NoCase:  "nocase",
+	Unicode: "unicode",
+}
+
+func Parse(name string) (Collation, error) {
+	for c, n := range names {
+		if strings.EqualFold(n, name) {
+			return c, nil
+		}
+	}
+	return Binary, NewUnknownCollationError(name)
+}
+
+func (c Collation) String() string {
+	if n, ok := names[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("collation(%d)", byte(c))
+}
+
+func (c Collation) Valid() bool {
+	_, ok := names[c]
+	return ok
+}
+
+// Key returns the form of s strings equal under c share.
+func (c Collation) Key(s string) string {
+	switch c {
+	case NoCase:
+		return cases.Fold().String(norm.NFC.String(s))
+	case Unicode:
+		return norm.NFC.String(s)
+	}
+	return s
+}
+
+// Value returns v with strings replaced by their Key.
+func (c Collation) Value(v interface{}) interface{} {
+	if s, ok := v.(string); ok && c != Binary {
+		return c.Key(s)
+	}
+	return v
+}
+
+// Compare is types.Compare honoring c for strings.
+func (c Collation) Compare(a, b interface{}) (int, error) {
+	return types.Compare(c.Value(a), c.Value(b))
+}
@@ -0,0 +1,39 @@
+package collate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		collation Collation
+		a, b      interface{}
+		expected  int
+	}{
+		{Binary, "Bany", "bany", -1},
+		{NoCase, "Bany", "bany", 0},
+		{NoCase, "STRASSE", "straße", 0},
+		{NoCase, "alice", "Bob", -1},
+		{Binary, "e\u0301", "\u00e9", -1},
+		{Unicode, "e\u0301", "\u00e9", 0},
+		{Unicode, "Bany", "bany", -1},
+		{NoCase, int32(1), int64(1), 0},
+	}
+	for _, tt := range tests {
+		cmp, err := tt.collation.Compare(tt.a, tt.b)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, cmp, "%s %v %v", tt.collation, tt.a, tt.b)
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse("NOCASE")
+	assert.Nil(t, err)
+	assert.Equal(t, NoCase, c)
+	_, err = Parse("klingon")
+	var unknown *UnknownCollationError
+	assert.ErrorAs(t, err, &unknown)
+	assert.False(t, Collation(42).Valid())
+}
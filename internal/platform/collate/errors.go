@@ -0,0 +1,15 @@
+package collate
+
+import "fmt"
+
+type UnknownCollationError struct {
+	name string
+}
+
+func NewUnknownCollationError(name string) *UnknownCollationError {
+	return &UnknownCollationError{name: name}
+}
+
+func (e *UnknownCollationError) Error() string {
+	return fmt.Sprintf("unknown collation: %s", e.name)
+}
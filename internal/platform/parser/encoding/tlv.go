@@ -107,7 +107,7 @@ func (m *TLVMarshaler[T]) TLVLength() (uint32, error) {
 		return types.LenMeta + types.LenByte, nil
 	case int32, uint32:
 		return types.LenMeta + types.LenInt32, nil
-	case int64:
+	case int64, float64:
 		return types.LenMeta + types.LenInt64, nil
 	case bool:
 		return types.LenMeta + types.LenByte, nil
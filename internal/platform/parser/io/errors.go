@@ -1,10 +1,12 @@
 package io
 
+import "fmt"
+
 type IncompleteReadError struct {
 	exceptedBytes int
 	actualBytes   int
 }
 
 func (e *IncompleteReadError) Error() string {
-	return "incomplete read: expected " + string(e.exceptedBytes) + " bytes, got " + string(e.actualBytes)
+	return fmt.Sprintf("incomplete read: expected %d bytes, got %d", e.exceptedBytes, e.actualBytes)
 }
@@ -1,10 +1,8 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"io"
-	"os"
 
 	parserio "github.com/9bany/db/internal/platform/parser/io"
 	"github.com/9bany/db/internal/platform/types"
@@ -14,6 +12,9 @@ type RawRecord struct {
 	Size     uint32
 	FullSize uint32
 	Values   map[string]interface{}
+	// Deleted is set for a deleted record returned with KeepDeleted, its
+	// values are not read.
+	Deleted bool
 }
 
 func NewRawRecord(size uint32, record map[string]interface{}) *RawRecord {
@@ -24,7 +25,9 @@ func NewRawRecord(size uint32, record map[string]interface{}) *RawRecord {
 	}
 }
 
-func NewRecordParser(file *os.File, columns []string) *RecordParser {
+// NewRecordParser returns a parser reading records from file. Parsers keep
+// their position in file, so each concurrent reader needs its own.
+func NewRecordParser(file io.ReadSeeker, columns []string) *RecordParser {
 	return &RecordParser{
 		file:    file,
 		columns: columns,
@@ -34,63 +37,58 @@ func NewRecordParser(file *os.File, columns []string) *RecordParser {
 }
 
 type RecordParser struct {
-	file    *os.File
+	file    io.ReadSeeker
 	columns []string
 	Value   *RawRecord
 	Reader  *parserio.Reader
+	// PagesRead counts the page headers crossed while parsing.
+	PagesRead int64
+	// KeepDeleted makes Parse stop at deleted records instead of skipping
+	// them.
+	KeepDeleted bool
 }
 
+// Parse reads the next live record starting at the current file offset.
+// Page headers and deleted records are skipped transparently, deleted
+// records are returned instead with KeepDeleted.
 func (r *RecordParser) Parse() error {
-	read := parserio.NewReader(r.file)
-	t, err := read.ReadByte()
+	deleted, err := r.skipToRecord()
 	if err != nil {
 		if err == io.EOF {
 			return io.EOF
 		}
 		return fmt.Errorf("RecordParser.Parse: %w", err)
 	}
-
-	if t != types.TypeRecord && t != types.TypeDeletedRecord {
-		return fmt.Errorf("RecordParser.Parse: expected TypeRecord, got %d", t)
-	}
-
-	if t == types.TypePage {
-		// length of page which is not important
-		_, err = read.ReadUint32()
-		// type of next "thing"
-		t, err = read.ReadByte()
-	}
-	if t == types.TypeDeletedRecord {
-		if _, err := r.file.Seek(-1*types.LenByte, io.SeekCurrent); err != nil {
-			return fmt.Errorf("RecordParser.Parse: %w", err)
-		}
-
-		err = r.skipDeletedRecords()
-		if err != nil {
-			if err == io.EOF {
-				return err
-			}
-			return fmt.Errorf("RecordParser.Parse: %w", err)
-		}
+	if deleted != nil {
+		r.Value = deleted
+		return nil
 	}
 
 	record := make(map[string]interface{})
 
-	lenRecord, err := read.ReadUint32()
-
+	lenRecord, err := r.Reader.ReadUint32()
 	if err != nil {
 		return fmt.Errorf("RecordParser.Parse: %w", err)
 	}
+	var consumed uint32
 	for i := 0; i < len(r.columns); i++ {
-		tlvParser := NewTLVParser(read)
+		tlvParser := NewTLVParser(r.Reader)
 		value, err := tlvParser.Parse()
-		if errors.Is(err, io.EOF) {
-			r.Value = NewRawRecord(lenRecord, record)
-		}
 		if err != nil {
 			return fmt.Errorf("RecordParser.Parse: %w", err)
 		}
 		record[r.columns[i]] = value
+		length, err := types.LengthData(value)
+		if err != nil {
+			return fmt.Errorf("RecordParser.Parse: %w", err)
+		}
+		consumed += types.LenMeta + length
+	}
+	// records updated in place keep their old size and are padded
+	if consumed < lenRecord {
+		if _, err := r.file.Seek(int64(lenRecord-consumed), io.SeekCurrent); err != nil {
+			return fmt.Errorf("RecordParser.Parse: %w", err)
+		}
 	}
 
 	r.Value = NewRawRecord(
@@ -100,26 +98,42 @@ func (r *RecordParser) Parse() error {
 	return nil
 }
 
-func (r *RecordParser) skipDeletedRecords() error {
+// skipToRecord advances the file until the type flag of a live record has
+// been consumed. With KeepDeleted it returns the first deleted record met,
+// the file positioned after it.
+func (r *RecordParser) skipToRecord() (*RawRecord, error) {
 	for {
 		t, err := r.Reader.ReadByte()
 		if err != nil {
-			if err == io.EOF {
-				return err
-			}
-			return fmt.Errorf("RecordParser.Parse: %w", err)
+			return nil, err
 		}
-		if t == types.TypeDeletedRecord {
+		switch t {
+		case types.TypeRecord:
+			return nil, nil
+		case types.TypePage:
+			r.PagesRead++
+			// length and LSN of the page which are not important
+			if _, err := r.Reader.ReadUint32(); err != nil {
+				return nil, err
+			}
+			if _, err := r.file.Seek(types.LenInt64, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		case types.TypeDeletedRecord:
 			l, err := r.Reader.ReadUint32()
 			if err != nil {
-				return fmt.Errorf("RecordParser.Parse: %w", err)
+				return nil, err
 			}
 			if _, err = r.file.Seek(int64(l), io.SeekCurrent); err != nil {
-				return fmt.Errorf("RecordParser.Parse: %w", err)
+				return nil, err
 			}
-		}
-		if t == types.TypeRecord {
-			return nil
+			if r.KeepDeleted {
+				deleted := NewRawRecord(l, nil)
+				deleted.Deleted = true
+				return deleted, nil
+			}
+		default:
+			return nil, fmt.Errorf("expected TypeRecord, got %d", t)
 		}
 	}
 }
@@ -24,6 +24,8 @@ func (p *TLVParser) Parse() (interface{}, error) {
 	switch data[0] {
 	case types.TypeInt64:
 		return unmarshalValue[int64](data)
+	case types.TypeFloat64:
+		return unmarshalValue[float64](data)
 	case types.TypeInt32:
 		return unmarshalValue[int32](data)
 	case types.TypeByte:
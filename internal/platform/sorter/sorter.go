@@ -0,0 +1,265 @@
+package sorter
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/spill"
+	"github.com/9bany/db/internal/platform/vfs"
+)
+
+// DefaultMemoryLimit is the number of bytes a Sorter buffers before it
+// spills a sorted run to a temporary file.
+const DefaultMemoryLimit = 4 * 1024 * 1024
+
+type Row = map[string]interface{}
+
+// CompareFunc returns a negative number when a sorts before b, a positive
+// number when b sorts before a and zero otherwise.
+type CompareFunc func(a, b Row) (int, error)
+
+// Sorter is an external merge sorter. Rows are buffered in memory and sorted
+// runs are spilled to temporary files whenever the buffer exceeds the memory
+// limit. Sort merges the runs back together.
+type Sorter struct {
+	columns     []string
+	compare     CompareFunc
+	memoryLimit int
+	fs          vfs.FS
+	dir         string
+
+	buf     []Row
+	bufSize int
+	runs    []*spill.File
+	err     error
+}
+
+// NewSorter creates a Sorter for rows made of columns. Spill files are
+// created in dir, or in the default temporary directory when dir is empty.
+func NewSorter(columns []string, compare CompareFunc, memoryLimit int, dir string) *Sorter {
+	return NewSorterFS(vfs.OS{}, columns, compare, memoryLimit, dir)
+}
+
+// NewSorterFS is NewSorter spilling to dir of the file system fsys.
+func NewSorterFS(fsys vfs.FS, columns []string, compare CompareFunc, memoryLimit int, dir string) *Sorter {
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultMemoryLimit
+	}
+	return &Sorter{
+		columns:     columns,
+		compare:     compare,
+		memoryLimit: memoryLimit,
+		fs:          fsys,
+		dir:         dir,
+	}
+}
+
+func (s *Sorter) Add(row Row) error {
+	size, err := spill.RowSize(s.columns, row)
+	if err != nil {
+		return fmt.Errorf("Sorter.Add: %w", err)
+	}
+	s.buf = append(s.buf, row)
+	s.bufSize += int(size)
+	if s.bufSize < s.memoryLimit {
+		return nil
+	}
+	if err := s.spill(); err != nil {
+		return fmt.Errorf("Sorter.Add: %w", err)
+	}
+	return nil
+}
+
+// Close removes spill files that have not been handed to an Iterator. It is
+// only needed when the Sorter is abandoned before Sort is called.
+func (s *Sorter) Close() error {
+	it := &Iterator{runs: s.runs}
+	s.buf = nil
+	s.runs = nil
+	return it.Close()
+}
+
+// Spilled reports how many runs have been written to disk.
+func (s *Sorter) Spilled() int {
+	return len(s.runs)
+}
+
+// Sort returns an iterator over every added row in order. The iterator must
+// be closed to remove the spill files.
+func (s *Sorter) Sort() (*Iterator, error) {
+	if err := s.sortBuffer(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Sorter.Sort: %w", err)
+	}
+
+	// the iterator owns the runs from now on and removes them on failure
+	it := &Iterator{compare: s.compare, runs: s.runs}
+	s.runs = nil
+	for _, f := range it.runs {
+		if err := f.Rewind(); err != nil {
+			it.Close()
+			return nil, fmt.Errorf("Sorter.Sort: %w", err)
+		}
+		it.sources = append(it.sources, f)
+	}
+	// The in-memory rows were added last so they go last to keep the
+	// merge stable.
+	if len(s.buf) > 0 {
+		it.sources = append(it.sources, &memorySource{rows: s.buf})
+	}
+	s.buf = nil
+
+	if err := it.init(); err != nil {
+		it.Close()
+		return nil, fmt.Errorf("Sorter.Sort: %w", err)
+	}
+	return it, nil
+}
+
+func (s *Sorter) sortBuffer() error {
+	sort.SliceStable(s.buf, func(i, j int) bool {
+		if s.err != nil {
+			return false
+		}
+		cmp, err := s.compare(s.buf[i], s.buf[j])
+		if err != nil {
+			s.err = err
+			return false
+		}
+		return cmp < 0
+	})
+	return s.err
+}
+
+func (s *Sorter) spill() error {
+	if err := s.sortBuffer(); err != nil {
+		return fmt.Errorf("Sorter.spill: %w", err)
+	}
+	f, err := spill.CreateFS(s.fs, s.dir, s.columns)
+	if err != nil {
+		return fmt.Errorf("Sorter.spill: %w", err)
+	}
+	s.runs = append(s.runs, f)
+
+	for _, row := range s.buf {
+		if err := f.Write(row); err != nil {
+			return fmt.Errorf("Sorter.spill: %w", err)
+		}
+	}
+	s.buf = s.buf[:0]
+	s.bufSize = 0
+	return nil
+}
+
+type source interface {
+	Read() (Row, error)
+}
+
+type memorySource struct {
+	rows []Row
+	pos  int
+}
+
+func (m *memorySource) Read() (Row, error) {
+	if m.pos >= len(m.rows) {
+		return nil, io.EOF
+	}
+	row := m.rows[m.pos]
+	m.pos++
+	return row, nil
+}
+
+type head struct {
+	row    Row
+	source int
+}
+
+// Iterator yields rows from every sorted run in global order.
+type Iterator struct {
+	compare CompareFunc
+	sources []source
+	runs    []*spill.File
+	heads   []head
+	err     error
+}
+
+func (it *Iterator) init() error {
+	for i, src := range it.sources {
+		row, err := src.Read()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		it.heads = append(it.heads, head{row: row, source: i})
+	}
+	heap.Init(it)
+	return it.err
+}
+
+// Next returns the next row in order or io.EOF when every run is exhausted.
+func (it *Iterator) Next() (Row, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if len(it.heads) == 0 {
+		return nil, io.EOF
+	}
+	top := it.heads[0]
+	row, err := it.sources[top.source].Read()
+	switch {
+	case err == io.EOF:
+		heap.Pop(it)
+	case err != nil:
+		return nil, fmt.Errorf("Iterator.Next: %w", err)
+	default:
+		it.heads[0].row = row
+		heap.Fix(it, 0)
+	}
+	if it.err != nil {
+		return nil, fmt.Errorf("Iterator.Next: %w", it.err)
+	}
+	return top.row, nil
+}
+
+// Close removes the spill files backing the iterator.
+func (it *Iterator) Close() error {
+	var firstErr error
+	for _, f := range it.runs {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	it.runs = nil
+	if firstErr != nil {
+		return fmt.Errorf("Iterator.Close: %w", firstErr)
+	}
+	return nil
+}
+
+func (it *Iterator) Len() int { return len(it.heads) }
+
+func (it *Iterator) Less(i, j int) bool {
+	cmp, err := it.compare(it.heads[i].row, it.heads[j].row)
+	if err != nil && it.err == nil {
+		it.err = err
+	}
+	if cmp == 0 {
+		// keep the merge stable: earlier runs hold earlier rows
+		return it.heads[i].source < it.heads[j].source
+	}
+	return cmp < 0
+}
+
+func (it *Iterator) Swap(i, j int) { it.heads[i], it.heads[j] = it.heads[j], it.heads[i] }
+
+func (it *Iterator) Push(x any) { it.heads = append(it.heads, x.(head)) }
+
+func (it *Iterator) Pop() any {
+	last := it.heads[len(it.heads)-1]
+	it.heads = it.heads[:len(it.heads)-1]
+	return last
+}
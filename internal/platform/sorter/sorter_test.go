@@ -0,0 +1,84 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func byID(a, b Row) (int, error) {
+	return types.Compare(a["id"], b["id"])
+}
+
+func TestSorter_Spill(t *testing.T) {
+	dir := t.TempDir()
+	columns := []string{"id", "name"}
+	// every row is larger than the limit so each one becomes a run
+	s := NewSorter(columns, byID, 1, dir)
+
+	ids := []int32{5, 3, 9, 1, 7, 3}
+	for _, id := range ids {
+		assert.Nil(t, s.Add(Row{"id": id, "name": "row"}))
+	}
+	assert.Equal(t, len(ids), s.Spilled())
+
+	it, err := s.Sort()
+	assert.Nil(t, err)
+	sorted := make([]int32, 0, len(ids))
+	for {
+		row, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, "row", row["name"])
+		sorted = append(sorted, row["id"].(int32))
+	}
+	assert.Equal(t, []int32{1, 3, 3, 5, 7, 9}, sorted)
+
+	assert.Nil(t, it.Close())
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSorter_InMemory(t *testing.T) {
+	s := NewSorter([]string{"id"}, byID, 0, t.TempDir())
+	for _, id := range []int64{3, 1, 2} {
+		assert.Nil(t, s.Add(Row{"id": id}))
+	}
+	assert.Equal(t, 0, s.Spilled())
+
+	it, err := s.Sort()
+	assert.Nil(t, err)
+	defer it.Close()
+	for _, expected := range []int64{1, 2, 3} {
+		row, err := it.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, row["id"])
+	}
+	_, err = it.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSorter_SortFailureRemovesRuns(t *testing.T) {
+	dir := t.TempDir()
+	s := NewSorter([]string{"id"}, byID, 30, dir)
+	for _, id := range []int32{3, 2, 1} {
+		assert.Nil(t, s.Add(Row{"id": id}))
+	}
+	assert.Equal(t, 1, s.Spilled())
+	// the buffered rows cannot be compared
+	assert.Nil(t, s.Add(Row{"id": int32(4)}))
+	assert.Nil(t, s.Add(Row{"id": "five"}))
+	assert.Equal(t, 1, s.Spilled())
+
+	_, err := s.Sort()
+	assert.NotNil(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
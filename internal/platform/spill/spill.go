@@ -0,0 +1,147 @@
+package spill
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/platform/vfs"
+)
+
+type Row = map[string]interface{}
+
+// File is a temporary file of rows used by operators that run out of
+// memory. Rows are encoded the same way records are stored in table files.
+type File struct {
+	fs      vfs.FS
+	f       vfs.File
+	columns []string
+	w       *bufio.Writer
+	r       *parserio.Reader
+}
+
+// Create creates a spill file in dir, which is created when missing, or in
+// the default temporary directory when dir is empty.
+func Create(dir string, columns []string) (*File, error) {
+	return CreateFS(vfs.OS{}, dir, columns)
+}
+
+// CreateFS is Create on the file system fsys.
+func CreateFS(fsys vfs.FS, dir string, columns []string) (*File, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := fsys.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("spill.CreateFS: %w", err)
+	}
+	f, err := fsys.CreateTemp(dir, "spill_*.bin")
+	if err != nil {
+		return nil, fmt.Errorf("spill.CreateFS: %w", err)
+	}
+	return &File{
+		fs:      fsys,
+		f:       f,
+		columns: columns,
+		w:       bufio.NewWriter(f),
+	}, nil
+}
+
+func (f *File) Write(row Row) error {
+	b, err := MarshalRow(f.columns, row)
+	if err != nil {
+		return fmt.Errorf("File.Write: %w", err)
+	}
+	if _, err := f.w.Write(b); err != nil {
+		return fmt.Errorf("File.Write: %w", err)
+	}
+	return nil
+}
+
+// Rewind flushes pending writes and positions the file for reading from the
+// first row.
+func (f *File) Rewind() error {
+	if err := f.w.Flush(); err != nil {
+		return fmt.Errorf("File.Rewind: %w", err)
+	}
+	if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("File.Rewind: %w", err)
+	}
+	f.r = parserio.NewReader(f.f)
+	return nil
+}
+
+// Read returns the next row or io.EOF. Rewind must be called first.
+func (f *File) Read() (Row, error) {
+	t, err := f.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if t != types.TypeRecord {
+		return nil, fmt.Errorf("File.Read: expected TypeRecord, got %d", t)
+	}
+	if _, err := f.r.ReadUint32(); err != nil {
+		return nil, fmt.Errorf("File.Read: %w", err)
+	}
+	row := make(Row, len(f.columns))
+	tlvParser := parser.NewTLVParser(f.r)
+	for _, col := range f.columns {
+		v, err := tlvParser.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("File.Read: %w", err)
+		}
+		row[col] = v
+	}
+	return row, nil
+}
+
+// Close closes and removes the file.
+func (f *File) Close() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("File.Close: %w", err)
+	}
+	if err := f.fs.Remove(f.f.Name()); err != nil {
+		return fmt.Errorf("File.Close: %w", err)
+	}
+	return nil
+}
+
+// RowSize returns the number of bytes row takes once encoded.
+func RowSize(columns []string, row Row) (uint32, error) {
+	var size uint32 = types.LenMeta
+	for _, col := range columns {
+		length, err := encoding.NewTLVMarshaler(row[col]).TLVLength()
+		if err != nil {
+			return 0, err
+		}
+		size += length
+	}
+	return size, nil
+}
+
+func MarshalRow(columns []string, row Row) ([]byte, error) {
+	size, err := RowSize(columns, row)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	buf.WriteByte(types.TypeRecord)
+	lenBuf, err := encoding.NewValueMarshaler(size - types.LenMeta).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(lenBuf)
+	for _, col := range columns {
+		b, err := encoding.NewTLVMarshaler(row[col]).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compare returns -1, 0 or 1 depending on whether a is less than, equal to or
+// greater than b. Numeric types are compared by value regardless of their
+// width. nil sorts before every other value.
+func Compare(a, b any) (int, error) {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0, nil
+		case a == nil:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	}
+
+	if isFloat(a) || isFloat(b) {
+		x, okA := toFloat64(a)
+		y, okB := toFloat64(b)
+		if !okA || !okB {
+			return 0, NewIncomparableValuesError(a, b)
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	if x, ok := toInt64(a); ok {
+		y, ok := toInt64(b)
+		if !ok {
+			return 0, NewIncomparableValuesError(a, b)
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, NewIncomparableValuesError(a, b)
+		}
+		return strings.Compare(x, y), nil
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, NewIncomparableValuesError(a, b)
+		}
+		switch {
+		case x == y:
+			return 0, nil
+		case !x:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, &UnsupportedDataTypeError{DataType: fmt.Sprintf("%T", a)}
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case byte:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func isFloat(v any) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func toFloat64(v any) (float64, bool) {
+	if f, ok := v.(float64); ok {
+		return f, true
+	}
+	n, ok := toInt64(v)
+	return float64(n), ok
+}
@@ -9,3 +9,16 @@ type UnsupportedDataTypeError struct {
 func (u *UnsupportedDataTypeError) Error() string {
 	return fmt.Sprintf("unsupported data type %s", u.DataType)
 }
+
+type IncomparableValuesError struct {
+	a any
+	b any
+}
+
+func NewIncomparableValuesError(a, b any) *IncomparableValuesError {
+	return &IncomparableValuesError{a: a, b: b}
+}
+
+func (e *IncomparableValuesError) Error() string {
+	return fmt.Sprintf("cannot compare %T with %T", e.a, e.b)
+}
@@ -3,12 +3,13 @@ package types
 import "fmt"
 
 const (
-	TypeInt64  byte = 1
-	TypeString byte = 2
-	TypeByte   byte = 3
-	TypeBool   byte = 4
-	TypeInt32  byte = 5
-	TypePage   byte = 255
+	TypeInt64   byte = 1
+	TypeString  byte = 2
+	TypeByte    byte = 3
+	TypeBool    byte = 4
+	TypeInt32   byte = 5
+	TypeFloat64 byte = 6
+	TypePage    byte = 255
 
 	TypeWALEntry      byte = 20
 	TypeWALLastIDItem byte = 21
@@ -33,6 +34,8 @@ func TypeBytes(value any) (byte, error) {
 		return TypeInt32, nil
 	case int64:
 		return TypeInt64, nil
+	case float64:
+		return TypeFloat64, nil
 	case string:
 		return TypeString, nil
 	case bool:
@@ -50,6 +53,8 @@ func TypeName(value any) string {
 		return "TypeInt32"
 	case int64:
 		return "TypeInt64"
+	case float64:
+		return "TypeFloat64"
 	case string:
 		return "TypeString"
 	case bool:
@@ -65,7 +70,7 @@ func LengthData(value any) (uint32, error) {
 		return 1, nil
 	case int32, uint32:
 		return 4, nil
-	case int64:
+	case int64, float64:
 		return 8, nil
 	case string:
 		return uint32(len(v)), nil
@@ -0,0 +1,584 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCrashed is returned by a MemFS once it crashed, until Crash restarts
+// it, and by the files opened before the crash for good.
+var ErrCrashed = errors.New("vfs: crashed")
+
+// MemFS is an in-memory file system simulating crashes. The writes to a
+// file reach stable storage in order, and all of them once the file is
+// synced. A crash keeps a random number of the unsynced writes of every
+// file, the last one kept possibly torn at any byte. Creating, renaming
+// and removing files and directories are durable at once.
+//
+// A crash is injected with CrashAfter: the file system crashes in the
+// middle of one of its next changes and fails every call after, as if the
+// process died. Crash then simulates the restart.
+type MemFS struct {
+	mu    sync.Mutex
+	rand  *rand.Rand
+	files map[string]*memNode
+	dirs  map[string]struct{}
+	// gen is incremented by every crash, the files of older generations
+	// are dead
+	gen int
+	// changes counts the changes made to the files since the last crash
+	changes int
+	// crashAt is the change the file system crashes in, 0 when none
+	crashAt int
+	crashed bool
+	// temps numbers the files of CreateTemp
+	temps int
+}
+
+// NewMemFS returns an empty file system whose faults are drawn from seed.
+func NewMemFS(seed int64) *MemFS {
+	return &MemFS{
+		rand:  rand.New(rand.NewSource(seed)),
+		files: make(map[string]*memNode),
+		dirs:  map[string]struct{}{".": {}, "/": {}},
+	}
+}
+
+// CrashAfter makes the file system crash in its n-th change from now. The
+// change is torn: a write is partly made, the other changes are not made.
+func (m *MemFS) CrashAfter(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.crashAt = m.changes + n
+}
+
+// Changes returns the number of changes made since the last crash: writes,
+// truncates, syncs, renames, creations and removals.
+func (m *MemFS) Changes() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.changes
+}
+
+// Crashed reports whether the file system crashed and was not restarted.
+func (m *MemFS) Crashed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.crashed
+}
+
+// Crash crashes the file system, unless an injected crash did already, and
+// restarts it: every file is left with what reached stable storage and the
+// files opened before are dead.
+func (m *MemFS) Crash() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	// the faults only depend on the seed
+	sort.Strings(names)
+	for _, name := range names {
+		m.files[name].crash(m.rand)
+	}
+	m.gen++
+	m.changes, m.crashAt, m.crashed = 0, 0, false
+}
+
+// change counts a change and returns whether it is the one the file system
+// crashes in. It fails once the file system crashed.
+func (m *MemFS) change() (bool, error) {
+	if m.crashed {
+		return false, ErrCrashed
+	}
+	m.changes++
+	if m.changes == m.crashAt {
+		m.crashed = true
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *MemFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// CreateTemp creates a new file in dir, the default temporary directory
+// when empty, whose name is pattern with its last "*" replaced by a
+// number.
+func (m *MemFS) CreateTemp(dir, pattern string) (File, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		m.mu.Lock()
+		m.temps++
+		name := filepath.Join(dir, fmt.Sprintf("%s%d%s", prefix, m.temps, suffix))
+		m.mu.Unlock()
+		f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.crashed {
+		return nil, ErrCrashed
+	}
+	name = filepath.Clean(name)
+	node, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if _, ok := m.dirs[filepath.Dir(name)]; !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if _, ok := m.dirs[name]; ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		crash, err := m.change()
+		if err != nil || crash {
+			return nil, ErrCrashed
+		}
+		node = &memNode{mode: perm}
+		m.files[name] = node
+	case flag&os.O_TRUNC != 0:
+		crash, err := m.change()
+		if err != nil || crash {
+			return nil, ErrCrashed
+		}
+		node.write(memWrite{truncate: true})
+	}
+	return &memFile{fs: m, node: node, name: name, gen: m.gen, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WriteFile truncates the file and writes data, two changes.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	node, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	crash, err := m.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = node
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.crashed {
+		return nil, ErrCrashed
+	}
+	name = filepath.Clean(name)
+	if node, ok := m.files[name]; ok {
+		return &memInfo{name: filepath.Base(name), size: int64(len(node.data)), mode: node.mode}, nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		return &memInfo{name: filepath.Base(name), mode: fs.ModeDir | 0777}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the entries of the directory name sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.crashed {
+		return nil, ErrCrashed
+	}
+	name = filepath.Clean(name)
+	if _, ok := m.dirs[name]; !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, 0)
+	for path, node := range m.files {
+		if filepath.Dir(path) == name {
+			info := &memInfo{name: filepath.Base(path), size: int64(len(node.data)), mode: node.mode}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	for path := range m.dirs {
+		if path != name && filepath.Dir(path) == name {
+			info := &memInfo{name: filepath.Base(path), mode: fs.ModeDir | 0777}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if _, ok := m.files[path]; ok {
+		return &fs.PathError{Op: "mkdir", Path: path, Err: fs.ErrExist}
+	}
+	if _, ok := m.dirs[path]; ok {
+		return nil
+	}
+	crash, err := m.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	for ; ; path = filepath.Dir(path) {
+		if _, ok := m.dirs[path]; ok {
+			return nil
+		}
+		m.dirs[path] = struct{}{}
+	}
+}
+
+// Remove removes the file or empty directory name.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.crashed {
+		return ErrCrashed
+	}
+	name = filepath.Clean(name)
+	_, isFile := m.files[name]
+	_, isDir := m.dirs[name]
+	if !isFile && !isDir {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if isDir {
+		prefix := name + string(filepath.Separator)
+		for path := range m.files {
+			if strings.HasPrefix(path, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+		for path := range m.dirs {
+			if strings.HasPrefix(path, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+	crash, err := m.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	delete(m.files, name)
+	delete(m.dirs, name)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	crash, err := m.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for name := range m.files {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(m.files, name)
+		}
+	}
+	for name := range m.dirs {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(m.dirs, name)
+		}
+	}
+	return nil
+}
+
+// memWrite is a change to the content of a file: data written at offset,
+// or a truncate to offset.
+type memWrite struct {
+	truncate bool
+	offset   int64
+	data     []byte
+}
+
+func (w memWrite) apply(data []byte) []byte {
+	if w.truncate {
+		if w.offset <= int64(len(data)) {
+			return data[:w.offset]
+		}
+		return append(data, make([]byte, w.offset-int64(len(data)))...)
+	}
+	if end := w.offset + int64(len(w.data)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[w.offset:], w.data)
+	return data
+}
+
+// memNode is the content of a file.
+type memNode struct {
+	// data is the content read
+	data []byte
+	// durable is the content on stable storage
+	durable []byte
+	// unsynced holds the writes made since the last sync in order
+	unsynced []memWrite
+	mode     fs.FileMode
+}
+
+func (n *memNode) write(w memWrite) {
+	n.data = w.apply(n.data)
+	n.unsynced = append(n.unsynced, w)
+}
+
+func (n *memNode) sync() {
+	n.durable = append([]byte(nil), n.data...)
+	n.unsynced = nil
+}
+
+// crash drops the unsynced writes but a random number of the first ones.
+// The write after the ones kept may be kept in part.
+func (n *memNode) crash(r *rand.Rand) {
+	data := append([]byte(nil), n.durable...)
+	kept := r.Intn(len(n.unsynced) + 1)
+	for _, w := range n.unsynced[:kept] {
+		data = w.apply(data)
+	}
+	if kept < len(n.unsynced) && !n.unsynced[kept].truncate && r.Intn(2) == 0 {
+		torn := n.unsynced[kept]
+		torn.data = torn.data[:r.Intn(len(torn.data)+1)]
+		data = torn.apply(data)
+	}
+	n.data = data
+	n.sync()
+}
+
+// memFile is a file of a MemFS opened in the generation gen.
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	gen    int
+	offset int64
+	append bool
+	closed bool
+}
+
+// check fails once the file is closed or the file system crashed since it
+// was opened. The file system must be locked.
+func (f *memFile) check() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	if f.fs.crashed || f.gen != f.fs.gen {
+		return ErrCrashed
+	}
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	return f.readAt(p, off)
+}
+
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	return f.writeAt(p, off)
+}
+
+// writeAt writes p at off. A write the file system crashes in is torn.
+func (f *memFile) writeAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	crash, err := f.fs.change()
+	if err != nil {
+		return 0, err
+	}
+	n := len(p)
+	if crash {
+		n = f.fs.rand.Intn(len(p) + 1)
+	}
+	f.node.write(memWrite{offset: off, data: append([]byte(nil), p[:n]...)})
+	if crash {
+		return n, ErrCrashed
+	}
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return &memInfo{name: filepath.Base(f.name), size: int64(len(f.node.data)), mode: f.node.mode}, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	crash, err := f.fs.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	f.node.write(memWrite{truncate: true, offset: size})
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check(); err != nil {
+		return err
+	}
+	crash, err := f.fs.change()
+	if err != nil || crash {
+		return ErrCrashed
+	}
+	f.node.sync()
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return time.Time{} }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() interface{}   { return nil }
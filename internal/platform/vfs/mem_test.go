@@ -0,0 +1,125 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS_CrashKeepsSyncedWrites(t *testing.T) {
+	m := NewMemFS(1)
+	assert.Nil(t, m.MkdirAll("/db", 0777))
+	f, err := m.Create("/db/t.bin")
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("synced"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	m.Crash()
+	data, err := m.ReadFile("/db/t.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("synced"), data)
+
+	// files opened before the crash are dead
+	_, err = f.Write([]byte("lost"))
+	assert.ErrorIs(t, err, ErrCrashed)
+}
+
+func TestMemFS_CrashKeepsPrefixOfUnsyncedWrites(t *testing.T) {
+	writes := [][]byte{[]byte("aaaa"), []byte("bbbb"), []byte("cccc")}
+	all := bytes.Join(writes, nil)
+	lengths := make(map[int]struct{})
+	for seed := int64(0); seed < 50; seed++ {
+		m := NewMemFS(seed)
+		f, err := m.Create("t.bin")
+		assert.Nil(t, err)
+		for _, w := range writes {
+			_, err := f.Write(w)
+			assert.Nil(t, err)
+		}
+
+		m.Crash()
+		data, err := m.ReadFile("t.bin")
+		assert.Nil(t, err)
+		// writes reach the disk in order, the last one kept may be torn
+		assert.Equal(t, all[:len(data)], data)
+		lengths[len(data)] = struct{}{}
+	}
+	assert.Contains(t, lengths, 0)
+	assert.Contains(t, lengths, len(all))
+	assert.Greater(t, len(lengths), 4, "writes are torn at any byte")
+}
+
+func TestMemFS_CrashAfter(t *testing.T) {
+	m := NewMemFS(3)
+	f, err := m.Create("t.bin")
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("first"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	m.CrashAfter(2)
+	_, err = f.WriteAt([]byte("FI"), 0)
+	assert.Nil(t, err)
+	assert.False(t, m.Crashed())
+	// the sync is the change the file system crashes in
+	assert.ErrorIs(t, f.Sync(), ErrCrashed)
+	assert.True(t, m.Crashed())
+	_, err = m.ReadFile("t.bin")
+	assert.ErrorIs(t, err, ErrCrashed)
+
+	m.Crash()
+	assert.False(t, m.Crashed())
+	data, err := m.ReadFile("t.bin")
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"first", "First", "FIrst"}, string(data))
+}
+
+func TestMemFS_Files(t *testing.T) {
+	m := NewMemFS(1)
+	_, err := m.Create("/db/t.bin")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Nil(t, m.MkdirAll("/db", 0777))
+	assert.Nil(t, m.WriteFile("/db/b.bin", []byte("b"), 0644))
+	assert.Nil(t, m.WriteFile("/db/a.tmp", []byte("a"), 0644))
+	assert.Nil(t, m.Rename("/db/a.tmp", "/db/a.bin"))
+
+	entries, err := m.ReadDir("/db")
+	assert.Nil(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"a.bin", "b.bin"}, names)
+	info, err := m.Stat("/db/a.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), info.Size())
+
+	_, err = m.ReadFile("/db/a.tmp")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Nil(t, m.RemoveAll("/db"))
+	_, err = m.Stat("/db")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestMemFS_CreateTempAndRemove(t *testing.T) {
+	m := NewMemFS(1)
+	assert.Nil(t, m.MkdirAll("/tmp/spill", 0777))
+	a, err := m.CreateTemp("/tmp/spill", "spill_*.bin")
+	assert.Nil(t, err)
+	b, err := m.CreateTemp("/tmp/spill", "spill_*.bin")
+	assert.Nil(t, err)
+	assert.NotEqual(t, a.Name(), b.Name())
+	assert.Regexp(t, `^/tmp/spill/spill_\d+\.bin$`, a.Name())
+
+	assert.NotNil(t, m.Remove("/tmp/spill"), "the directory is not empty")
+	assert.Nil(t, m.Remove(a.Name()))
+	assert.Nil(t, m.Remove(b.Name()))
+	_, err = m.Stat(a.Name())
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.True(t, errors.Is(m.Remove(a.Name()), fs.ErrNotExist))
+	assert.Nil(t, m.Remove("/tmp/spill"))
+}
@@ -0,0 +1,134 @@
+package table
+
+import (
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/aggregate"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// AggregateQuery describes a SELECT with aggregates, GROUP BY and HAVING.
+type AggregateQuery struct {
+	GroupBy    []string
+	Aggregates []aggregate.Aggregate
+	Where      predicate.Predicate
+	// Having filters output rows. It may reference group by columns and
+	// aggregates by their name.
+	Having predicate.Predicate
+	// MaxGroups is the number of groups kept in memory before spilling.
+	// Zero uses the aggregate package default.
+	MaxGroups int
+}
+
+// Aggregate runs q with hash aggregation over a full table scan. Output rows
+// are keyed by group by column and aggregate name and come back in no
+// particular order.
+func (t *Table) Aggregate(q AggregateQuery) ([]map[string]interface{}, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, err := t.validateAggregateQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Aggregate: %w", err)
+	}
+
+	agg := aggregate.NewHashAggregatorFS(t.fs, t.columnNames, q.GroupBy, q.Aggregates, q.MaxGroups, t.spillDir())
+	agg.SetCollations(t.collations())
+	err = t.scan(q.Where, func(_ int64, record *parser.RawRecord) (bool, error) {
+		return true, agg.Add(record.Values)
+	})
+	if err != nil {
+		agg.Close()
+		return nil, fmt.Errorf("Table.Aggregate: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0)
+	err = agg.Results(func(row map[string]interface{}) error {
+		ok, err := predicate.Evaluate(q.Having, row)
+		if err != nil {
+			return err
+		}
+		if ok {
+			results = append(results, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Table.Aggregate: %w", err)
+	}
+	return results, nil
+}
+
+func (t *Table) validateAggregateQuery(q AggregateQuery) (AggregateQuery, error) {
+	if len(q.Aggregates) == 0 && len(q.GroupBy) == 0 {
+		return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: at least one aggregate or group by column is required")
+	}
+
+	// output holds the columns visible to HAVING
+	output := make(map[string]*column.Column)
+	for _, col := range q.GroupBy {
+		c, ok := t.columns[col]
+		if !ok {
+			return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: unknown column in group by: %s", col)
+		}
+		output[col] = c
+	}
+	for _, a := range q.Aggregates {
+		if !a.Func.Valid() {
+			return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: %w", aggregate.NewUnknownFuncError(a.Func))
+		}
+		var columnType byte
+		if a.Column == "" {
+			if a.Func != aggregate.FuncCount {
+				return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: %s requires a column", a.Func)
+			}
+		} else {
+			c, ok := t.columns[a.Column]
+			if !ok {
+				return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: unknown column in %s: %s", a.Func, a.Column)
+			}
+			columnType = c.DataType()
+		}
+		if (a.Func == aggregate.FuncSum || a.Func == aggregate.FuncAvg) && !isNumeric(columnType) {
+			return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: %s requires a numeric column: %s", a.Func, a.Column)
+		}
+		if _, ok := output[a.Name()]; ok {
+			return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: duplicate output column: %s", a.Name())
+		}
+		output[a.Name()] = column.NewColumn(a.Name(), a.ResultType(columnType), column.ColumnOptions{Nullable: true})
+	}
+
+	if err := predicate.Validate(q.Having, output); err != nil {
+		return AggregateQuery{}, fmt.Errorf("Table.validateAggregateQuery: having: %w", err)
+	}
+	q.Having = predicate.Resolve(q.Having, output)
+	where, err := t.validateWhereStmt(q.Where)
+	if err != nil {
+		return AggregateQuery{}, err
+	}
+	q.Where = where
+	return q, nil
+}
+
+func isNumeric(dataType byte) bool {
+	switch dataType {
+	case types.TypeByte, types.TypeInt32, types.TypeInt64, types.TypeFloat64:
+		return true
+	}
+	return false
+}
+
+// collations returns the collation of every column not compared byte by
+// byte.
+func (t *Table) collations() map[string]collate.Collation {
+	collations := make(map[string]collate.Collation)
+	for name, col := range t.columns {
+		if c := col.Collation(); c != collate.Binary {
+			collations[name] = c
+		}
+	}
+	return collations
+}
@@ -0,0 +1,248 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/9bany/db/internal/platform/types"
+)
+
+type Func string
+
+const (
+	FuncCount         Func = "COUNT"
+	FuncCountDistinct Func = "COUNT DISTINCT"
+	FuncSum           Func = "SUM"
+	FuncAvg           Func = "AVG"
+	FuncMin           Func = "MIN"
+	FuncMax           Func = "MAX"
+)
+
+func (f Func) Valid() bool {
+	switch f {
+	case FuncCount, FuncCountDistinct, FuncSum, FuncAvg, FuncMin, FuncMax:
+		return true
+	}
+	return false
+}
+
+// Aggregate is a single aggregate expression such as SUM(age).
+type Aggregate struct {
+	Func Func
+	// Column is the aggregated column. It may be empty for COUNT(*).
+	Column string
+	// Alias is the key of the result in the output row. It defaults to
+	// the lowercase SQL form, e.g. "sum(age)".
+	Alias string
+}
+
+func Count(column string) Aggregate {
+	return Aggregate{Func: FuncCount, Column: column}
+}
+
+func CountDistinct(column string) Aggregate {
+	return Aggregate{Func: FuncCountDistinct, Column: column}
+}
+
+func Sum(column string) Aggregate {
+	return Aggregate{Func: FuncSum, Column: column}
+}
+
+func Avg(column string) Aggregate {
+	return Aggregate{Func: FuncAvg, Column: column}
+}
+
+func Min(column string) Aggregate {
+	return Aggregate{Func: FuncMin, Column: column}
+}
+
+func Max(column string) Aggregate {
+	return Aggregate{Func: FuncMax, Column: column}
+}
+
+// As returns a copy of a with its output key set to alias.
+func (a Aggregate) As(alias string) Aggregate {
+	a.Alias = alias
+	return a
+}
+
+func (a Aggregate) Name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	col := a.Column
+	if col == "" {
+		col = "*"
+	}
+	if a.Func == FuncCountDistinct {
+		return fmt.Sprintf("count(distinct %s)", col)
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToLower(string(a.Func)), col)
+}
+
+// ResultType returns the type of the aggregated value given the type of
+// its input column.
+func (a Aggregate) ResultType(columnType byte) byte {
+	switch a.Func {
+	case FuncCount, FuncCountDistinct:
+		return types.TypeInt64
+	case FuncAvg:
+		return types.TypeFloat64
+	case FuncSum:
+		if columnType == types.TypeFloat64 {
+			return types.TypeFloat64
+		}
+		return types.TypeInt64
+	}
+	return columnType
+}
+
+type accumulator interface {
+	add(v interface{}) error
+	result() interface{}
+}
+
+// newAccumulator returns the accumulator of a, comparing the strings of
+// its column under collation.
+func newAccumulator(a Aggregate, collation collate.Collation) (accumulator, error) {
+	switch a.Func {
+	case FuncCount:
+		return &countAccumulator{star: a.Column == ""}, nil
+	case FuncCountDistinct:
+		return &countDistinctAccumulator{collation: collation, seen: make(map[string]struct{})}, nil
+	case FuncSum:
+		return &sumAccumulator{}, nil
+	case FuncAvg:
+		return &avgAccumulator{}, nil
+	case FuncMin:
+		return &extremeAccumulator{collation: collation, want: -1}, nil
+	case FuncMax:
+		return &extremeAccumulator{collation: collation, want: 1}, nil
+	}
+	return nil, NewUnknownFuncError(a.Func)
+}
+
+type countAccumulator struct {
+	star bool
+	n    int64
+}
+
+func (c *countAccumulator) add(v interface{}) error {
+	if v != nil || c.star {
+		c.n++
+	}
+	return nil
+}
+
+func (c *countAccumulator) result() interface{} { return c.n }
+
+type countDistinctAccumulator struct {
+	collation collate.Collation
+	seen      map[string]struct{}
+}
+
+func (c *countDistinctAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	key, err := encoding.NewTLVMarshaler(c.collation.Value(v)).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("countDistinctAccumulator.add: %w", err)
+	}
+	c.seen[string(key)] = struct{}{}
+	return nil
+}
+
+func (c *countDistinctAccumulator) result() interface{} { return int64(len(c.seen)) }
+
+type sumAccumulator struct {
+	isFloat bool
+	n       int64
+	f       float64
+	seen    bool
+}
+
+func (s *sumAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	s.seen = true
+	switch n := v.(type) {
+	case byte:
+		s.n += int64(n)
+	case int32:
+		s.n += int64(n)
+	case uint32:
+		s.n += int64(n)
+	case int64:
+		s.n += n
+	case float64:
+		s.isFloat = true
+		s.f += n
+	default:
+		return NewNonNumericValueError(v)
+	}
+	return nil
+}
+
+func (s *sumAccumulator) result() interface{} {
+	if !s.seen {
+		return nil
+	}
+	if s.isFloat {
+		return s.f + float64(s.n)
+	}
+	return s.n
+}
+
+type avgAccumulator struct {
+	sum   sumAccumulator
+	count int64
+}
+
+func (a *avgAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if err := a.sum.add(v); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+func (a *avgAccumulator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return (a.sum.f + float64(a.sum.n)) / float64(a.count)
+}
+
+// extremeAccumulator keeps the minimum (want -1) or maximum (want 1) value.
+type extremeAccumulator struct {
+	collation collate.Collation
+	want      int
+	value     interface{}
+}
+
+func (e *extremeAccumulator) add(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if e.value == nil {
+		e.value = v
+		return nil
+	}
+	cmp, err := e.collation.Compare(v, e.value)
+	if err != nil {
+		return err
+	}
+	if cmp == e.want {
+		e.value = v
+	}
+	return nil
+}
+
+func (e *extremeAccumulator) result() interface{} { return e.value }
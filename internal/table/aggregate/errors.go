@@ -0,0 +1,27 @@
+package aggregate
+
+import "fmt"
+
+type NonNumericValueError struct {
+	value interface{}
+}
+
+func NewNonNumericValueError(value interface{}) *NonNumericValueError {
+	return &NonNumericValueError{value: value}
+}
+
+func (e *NonNumericValueError) Error() string {
+	return fmt.Sprintf("cannot aggregate non numeric value of type %T", e.value)
+}
+
+type UnknownFuncError struct {
+	fn Func
+}
+
+func NewUnknownFuncError(fn Func) *UnknownFuncError {
+	return &UnknownFuncError{fn: fn}
+}
+
+func (e *UnknownFuncError) Error() string {
+	return fmt.Sprintf("unknown aggregate function: %s", e.fn)
+}
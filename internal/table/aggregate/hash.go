@@ -0,0 +1,259 @@
+package aggregate
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/9bany/db/internal/platform/spill"
+	"github.com/9bany/db/internal/platform/vfs"
+)
+
+const (
+	// DefaultMaxGroups is the number of groups kept in memory before new
+	// groups are spilled to partition files.
+	DefaultMaxGroups = 64 * 1024
+	partitionCount   = 16
+)
+
+type Row = map[string]interface{}
+
+type group struct {
+	values       Row
+	accumulators []accumulator
+}
+
+// HashAggregator computes aggregates per group using an in-memory hash
+// table. Once the table holds maxGroups groups, rows belonging to groups
+// that are not already in memory are hash-partitioned to spill files and
+// aggregated partition by partition when results are read.
+type HashAggregator struct {
+	columns    []string
+	groupBy    []string
+	aggregates []Aggregate
+	maxGroups  int
+	fs         vfs.FS
+	dir        string
+	level      int
+	// collations holds the collation of the string columns, Binary when
+	// missing
+	collations map[string]collate.Collation
+
+	groups     map[string]*group
+	partitions []*spill.File
+}
+
+// NewHashAggregator creates an aggregator for rows made of columns. Partition
+// files are created in dir, or in the default temporary directory when dir
+// is empty.
+func NewHashAggregator(columns, groupBy []string, aggregates []Aggregate, maxGroups int, dir string) *HashAggregator {
+	return NewHashAggregatorFS(vfs.OS{}, columns, groupBy, aggregates, maxGroups, dir)
+}
+
+// NewHashAggregatorFS is NewHashAggregator spilling to dir of the file
+// system fsys.
+func NewHashAggregatorFS(fsys vfs.FS, columns, groupBy []string, aggregates []Aggregate, maxGroups int, dir string) *HashAggregator {
+	if maxGroups <= 0 {
+		maxGroups = DefaultMaxGroups
+	}
+	return &HashAggregator{
+		columns:    columns,
+		groupBy:    groupBy,
+		aggregates: aggregates,
+		maxGroups:  maxGroups,
+		fs:         fsys,
+		dir:        dir,
+		groups:     make(map[string]*group),
+	}
+}
+
+// SetCollations makes the aggregator group, count distinct and compare the
+// strings of every column of collations under its collation.
+func (h *HashAggregator) SetCollations(collations map[string]collate.Collation) {
+	h.collations = collations
+}
+
+func (h *HashAggregator) Add(row Row) error {
+	key, err := h.groupKey(row)
+	if err != nil {
+		return fmt.Errorf("HashAggregator.Add: %w", err)
+	}
+	g, ok := h.groups[key]
+	if !ok {
+		if len(h.groups) >= h.maxGroups {
+			if err := h.spill(key, row); err != nil {
+				return fmt.Errorf("HashAggregator.Add: %w", err)
+			}
+			return nil
+		}
+		if g, err = h.newGroup(row); err != nil {
+			return fmt.Errorf("HashAggregator.Add: %w", err)
+		}
+		h.groups[key] = g
+	}
+	for i, a := range h.aggregates {
+		var v interface{}
+		if a.Column != "" {
+			v = row[a.Column]
+		}
+		if err := g.accumulators[i].add(v); err != nil {
+			return fmt.Errorf("HashAggregator.Add: %s: %w", a.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Spilled reports whether any rows were written to partition files.
+func (h *HashAggregator) Spilled() bool {
+	return len(h.partitions) > 0
+}
+
+// Results calls fn with one row per group. Each row holds the group by
+// columns and one key per aggregate. Groups are not returned in any
+// particular order.
+func (h *HashAggregator) Results(fn func(Row) error) error {
+	defer h.Close()
+
+	if len(h.groups) == 0 && len(h.groupBy) == 0 && h.level == 0 && !h.Spilled() {
+		// Without GROUP BY an empty input still produces a single row.
+		g, err := h.newGroup(Row{})
+		if err != nil {
+			return fmt.Errorf("HashAggregator.Results: %w", err)
+		}
+		h.groups[""] = g
+	}
+	for _, g := range h.groups {
+		if err := fn(h.result(g)); err != nil {
+			return err
+		}
+	}
+	h.groups = make(map[string]*group)
+
+	for i, p := range h.partitions {
+		if p == nil {
+			continue
+		}
+		if err := h.aggregatePartition(p, fn); err != nil {
+			return fmt.Errorf("HashAggregator.Results: %w", err)
+		}
+		h.partitions[i] = nil
+	}
+	return nil
+}
+
+// Close removes any partition files that have not been consumed.
+func (h *HashAggregator) Close() error {
+	var firstErr error
+	for i, p := range h.partitions {
+		if p == nil {
+			continue
+		}
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		h.partitions[i] = nil
+	}
+	if firstErr != nil {
+		return fmt.Errorf("HashAggregator.Close: %w", firstErr)
+	}
+	return nil
+}
+
+func (h *HashAggregator) aggregatePartition(p *spill.File, fn func(Row) error) error {
+	defer p.Close()
+	if err := p.Rewind(); err != nil {
+		return err
+	}
+	child := NewHashAggregatorFS(h.fs, h.columns, h.groupBy, h.aggregates, h.maxGroups, h.dir)
+	child.level = h.level + 1
+	child.collations = h.collations
+	for {
+		row, err := p.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			child.Close()
+			return err
+		}
+		if err := child.Add(row); err != nil {
+			child.Close()
+			return err
+		}
+	}
+	return child.Results(fn)
+}
+
+func (h *HashAggregator) newGroup(row Row) (*group, error) {
+	g := &group{
+		values:       make(Row, len(h.groupBy)),
+		accumulators: make([]accumulator, len(h.aggregates)),
+	}
+	for _, col := range h.groupBy {
+		g.values[col] = row[col]
+	}
+	for i, a := range h.aggregates {
+		acc, err := newAccumulator(a, h.collations[a.Column])
+		if err != nil {
+			return nil, err
+		}
+		g.accumulators[i] = acc
+	}
+	return g, nil
+}
+
+func (h *HashAggregator) result(g *group) Row {
+	row := make(Row, len(h.groupBy)+len(h.aggregates))
+	for col, v := range g.values {
+		row[col] = v
+	}
+	for i, a := range h.aggregates {
+		row[a.Name()] = g.accumulators[i].result()
+	}
+	return row
+}
+
+func (h *HashAggregator) spill(key string, row Row) error {
+	if h.partitions == nil {
+		h.partitions = make([]*spill.File, partitionCount)
+	}
+	hash := fnv.New32a()
+	// salt the hash with the recursion level so rows that collided in
+	// the parent partition spread out in the child
+	hash.Write([]byte{byte(h.level)})
+	hash.Write([]byte(key))
+	i := hash.Sum32() % partitionCount
+
+	if h.partitions[i] == nil {
+		f, err := spill.CreateFS(h.fs, h.dir, h.columns)
+		if err != nil {
+			return fmt.Errorf("HashAggregator.spill: %w", err)
+		}
+		h.partitions[i] = f
+	}
+	if err := h.partitions[i].Write(row); err != nil {
+		return fmt.Errorf("HashAggregator.spill: %w", err)
+	}
+	return nil
+}
+
+func (h *HashAggregator) groupKey(row Row) (string, error) {
+	buf := bytes.Buffer{}
+	for _, col := range h.groupBy {
+		// values equal under the collation share a group
+		v := h.collations[col].Value(row[col])
+		if v == nil {
+			buf.WriteByte(0)
+			continue
+		}
+		b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+		if err != nil {
+			return "", fmt.Errorf("HashAggregator.groupKey: %w", err)
+		}
+		buf.Write(b)
+	}
+	return buf.String(), nil
+}
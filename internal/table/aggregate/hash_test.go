@@ -0,0 +1,83 @@
+package aggregate
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collect(t *testing.T, h *HashAggregator) []Row {
+	rows := make([]Row, 0)
+	err := h.Results(func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	assert.Nil(t, err)
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i]["k"].(int32) < rows[j]["k"].(int32)
+	})
+	return rows
+}
+
+func TestHashAggregator(t *testing.T) {
+	h := NewHashAggregator([]string{"k", "v"}, []string{"k"}, []Aggregate{
+		Count(""), Sum("v"), Avg("v"), Min("v"), Max("v"), CountDistinct("v").As("distinct"),
+	}, 0, t.TempDir())
+
+	for _, r := range []Row{
+		{"k": int32(1), "v": int64(10)},
+		{"k": int32(2), "v": int64(5)},
+		{"k": int32(1), "v": int64(20)},
+		{"k": int32(1), "v": int64(20)},
+	} {
+		assert.Nil(t, h.Add(r))
+	}
+	assert.False(t, h.Spilled())
+
+	assert.Equal(t, []Row{
+		{"k": int32(1), "count(*)": int64(3), "sum(v)": int64(50), "avg(v)": 50.0 / 3, "min(v)": int64(10), "max(v)": int64(20), "distinct": int64(2)},
+		{"k": int32(2), "count(*)": int64(1), "sum(v)": int64(5), "avg(v)": 5.0, "min(v)": int64(5), "max(v)": int64(5), "distinct": int64(1)},
+	}, collect(t, h))
+}
+
+func TestHashAggregator_Spill(t *testing.T) {
+	dir := t.TempDir()
+	h := NewHashAggregator([]string{"k", "v"}, []string{"k"}, []Aggregate{Sum("v")}, 2, dir)
+
+	for i := 0; i < 3; i++ {
+		for k := int32(0); k < 50; k++ {
+			assert.Nil(t, h.Add(Row{"k": k, "v": int64(k)}))
+		}
+	}
+	assert.True(t, h.Spilled())
+
+	rows := collect(t, h)
+	assert.Len(t, rows, 50)
+	for k, row := range rows {
+		assert.Equal(t, int32(k), row["k"])
+		assert.Equal(t, int64(3*k), row["sum(v)"])
+	}
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestHashAggregator_EmptyInput(t *testing.T) {
+	h := NewHashAggregator([]string{"v"}, nil, []Aggregate{Count(""), Max("v")}, 0, t.TempDir())
+	rows := make([]Row, 0)
+	assert.Nil(t, h.Results(func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	}))
+	assert.Equal(t, []Row{{"count(*)": int64(0), "max(v)": nil}}, rows)
+}
+
+func TestHashAggregator_UnknownFunc(t *testing.T) {
+	h := NewHashAggregator([]string{"v"}, nil, []Aggregate{{Func: "MEDIAN", Column: "v"}}, 0, t.TempDir())
+	var unknown *UnknownFuncError
+	assert.ErrorAs(t, h.Add(Row{"v": int64(1)}), &unknown)
+	assert.ErrorAs(t, h.Results(func(Row) error { return nil }), &unknown)
+}
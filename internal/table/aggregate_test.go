@@ -0,0 +1,73 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/9bany/db/internal/table/aggregate"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate_GroupByHaving(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.Aggregate(AggregateQuery{
+		GroupBy:    []string{"age"},
+		Aggregates: []aggregate.Aggregate{aggregate.Count("").As("n"), aggregate.Min("username")},
+		Having:     predicate.Gt("n", int64(1)),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"age": int64(25), "n": int64(2), "min(username)": "alice"},
+	}, rows)
+
+	rows, err = tb.Aggregate(AggregateQuery{
+		Aggregates: []aggregate.Aggregate{aggregate.Sum("age"), aggregate.Avg("age"), aggregate.CountDistinct("age")},
+		Where:      predicate.HasPrefix("username", "b"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"sum(age)": int64(90), "avg(age)": 30.0, "count(distinct age)": int64(3)},
+	}, rows)
+}
+
+func TestAggregate_SpillsToSpillDir(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.Aggregate(AggregateQuery{
+		GroupBy:    []string{"username"},
+		Aggregates: []aggregate.Aggregate{aggregate.Count("")},
+		MaxGroups:  1,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 5)
+
+	// partitions never land next to the table files
+	info, err := os.Stat(tb.spillDir())
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+	spilled, err := filepath.Glob(filepath.Join(filepath.Dir(tb.file.Name()), "spill_*"))
+	assert.Nil(t, err)
+	assert.Empty(t, spilled)
+}
+
+func TestAggregate_Invalid(t *testing.T) {
+	tb := newTestTable(t)
+
+	_, err := tb.Aggregate(AggregateQuery{Aggregates: []aggregate.Aggregate{aggregate.Sum("username")}})
+	assert.NotNil(t, err)
+	_, err = tb.Aggregate(AggregateQuery{GroupBy: []string{"missing"}})
+	assert.NotNil(t, err)
+	_, err = tb.Aggregate(AggregateQuery{Aggregates: []aggregate.Aggregate{{Func: "MEDIAN", Column: "age"}}})
+	var unknown *aggregate.UnknownFuncError
+	assert.ErrorAs(t, err, &unknown)
+	_, err = tb.Aggregate(AggregateQuery{
+		Aggregates: []aggregate.Aggregate{aggregate.Count("")},
+		Having:     predicate.Gt("count(*)", int32(1)),
+	})
+	assert.NotNil(t, err)
+}
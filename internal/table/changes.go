@@ -0,0 +1,515 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	platformio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/table/mvcc"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// Changes buffers the changes of a transaction to a table. Nothing is
+// written until they are prepared and applied at commit. Reads through
+// Changes see the buffered changes on top of the snapshot of the
+// transaction.
+type Changes struct {
+	table    *Table
+	snapshot *mvcc.Snapshot
+	// lockRow is called with the offset of every record before it is
+	// changed
+	lockRow func(offset int64) error
+	// logUndo is called with how to undo every change before it is made
+	logUndo func(data []byte) error
+	// records holds the changed and inserted records in the order they were
+	// first changed
+	records  []*pendingRecord
+	byOffset map[int64]*pendingRecord
+
+	deleted     []*DeletableRecord
+	updatedOld  []*DeletableRecord
+	updated     []map[string]interface{}
+	afters      [][]byte
+	inserted    []map[string]interface{}
+	insertedRaw [][]byte
+	// ops are the prepared operations
+	ops []wal.Operation
+}
+
+// pendingRecord is the current version of a record changed by a
+// transaction.
+type pendingRecord struct {
+	// old is the record on disk, nil for an inserted record
+	old *DeletableRecord
+	// values is nil once the record is deleted
+	values map[string]interface{}
+	// pos is the position of the record in the changes, -1 until it is
+	// changed
+	pos int
+}
+
+// undoRecord restores a pending record to its version before a change.
+type undoRecord struct {
+	pos int
+	// added is set when the change added the record to the changes, which
+	// is undone by removing it
+	added  bool
+	values map[string]interface{}
+}
+
+// NewChanges returns the changes of a transaction reading snapshot. The
+// snapshot must come from the manager of the table.
+func (t *Table) NewChanges(snapshot *mvcc.Snapshot) *Changes {
+	return &Changes{
+		table:    t,
+		snapshot: snapshot,
+		records:  make([]*pendingRecord, 0),
+		byOffset: make(map[int64]*pendingRecord),
+	}
+}
+
+// SetUndoLog makes the changes call log with how to undo every statement
+// before changing anything, a failing log failing the statement. The data
+// is undone with Revert. A nil log stops the logging.
+func (c *Changes) SetUndoLog(log func(data []byte) error) {
+	c.logUndo = log
+}
+
+// Revert undoes a statement from the data it was logged with by the undo
+// log. Statements are reverted the latest first. The rows they locked stay
+// locked.
+func (c *Changes) Revert(data []byte) error {
+	undo, err := c.decodeUndo(data)
+	if err != nil {
+		return fmt.Errorf("Changes.Revert: %w", err)
+	}
+	for i := len(undo) - 1; i >= 0; i-- {
+		u := undo[i]
+		if !u.added {
+			if u.pos >= len(c.records) {
+				return fmt.Errorf("Changes.Revert: %w", NewInvalidUndoError(fmt.Sprintf("no record at position %d", u.pos)))
+			}
+			c.records[u.pos].values = u.values
+			continue
+		}
+		// records are added in the order of the changes
+		if u.pos != len(c.records)-1 {
+			return fmt.Errorf("Changes.Revert: %w", NewInvalidUndoError(fmt.Sprintf("record at position %d is not the last one", u.pos)))
+		}
+		p := c.records[u.pos]
+		c.records = c.records[:u.pos]
+		p.pos = -1
+		if p.old != nil {
+			delete(c.byOffset, p.old.offset)
+		}
+	}
+	return nil
+}
+
+// SetRowLock makes the changes call lock before changing a record of the
+// table, with its offset. A failing lock fails the change.
+func (c *Changes) SetRowLock(lock func(offset int64) error) {
+	c.lockRow = lock
+}
+
+// Lock locks the table for writing, to be held from Prepare until Apply
+// returns. Tables are locked in name order by every committer so they never
+// wait on each other.
+func (c *Changes) Lock() {
+	c.table.mu.Lock()
+}
+
+func (c *Changes) Unlock() {
+	c.table.mu.Unlock()
+}
+
+// Empty reports whether no record was changed.
+func (c *Changes) Empty() bool {
+	return len(c.records) == 0
+}
+
+func (c *Changes) Insert(record map[string]interface{}) (int, error) {
+	if err := c.table.validateColumns(record); err != nil {
+		return 0, fmt.Errorf("Changes.Insert: %w", err)
+	}
+	values := make(map[string]interface{}, len(record))
+	for col, v := range record {
+		values[col] = v
+	}
+	p := &pendingRecord{pos: -1}
+	if err := c.change([]*pendingRecord{p}, []map[string]interface{}{values}); err != nil {
+		return 0, fmt.Errorf("Changes.Insert: %w", err)
+	}
+	return 1, nil
+}
+
+func (c *Changes) Select(whereStmt predicate.Predicate) ([]map[string]interface{}, error) {
+	matches, err := c.matching(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Changes.Select: %w", err)
+	}
+	results := make([]map[string]interface{}, 0, len(matches))
+	for _, p := range matches {
+		results = append(results, p.values)
+	}
+	return results, nil
+}
+
+func (c *Changes) Update(whereStmt predicate.Predicate, values map[string]interface{}) (int, error) {
+	values, err := c.table.validateAssignments(values)
+	if err != nil {
+		return 0, fmt.Errorf("Changes.Update: %w", err)
+	}
+	matches, err := c.matching(whereStmt)
+	if err != nil {
+		return 0, fmt.Errorf("Changes.Update: %w", err)
+	}
+	// assign every record before changing any so a failing statement
+	// leaves the transaction untouched
+	updated := make([]map[string]interface{}, len(matches))
+	for i, p := range matches {
+		if updated[i], err = c.table.assign(p.values, values); err != nil {
+			return 0, fmt.Errorf("Changes.Update: %w", err)
+		}
+	}
+	if err := c.lock(matches); err != nil {
+		return 0, fmt.Errorf("Changes.Update: %w", err)
+	}
+	if err := c.change(matches, updated); err != nil {
+		return 0, fmt.Errorf("Changes.Update: %w", err)
+	}
+	return len(matches), nil
+}
+
+func (c *Changes) Delete(whereStmt predicate.Predicate) (int, error) {
+	matches, err := c.matching(whereStmt)
+	if err != nil {
+		return 0, fmt.Errorf("Changes.Delete: %w", err)
+	}
+	if err := c.lock(matches); err != nil {
+		return 0, fmt.Errorf("Changes.Delete: %w", err)
+	}
+	if err := c.change(matches, make([]map[string]interface{}, len(matches))); err != nil {
+		return 0, fmt.Errorf("Changes.Delete: %w", err)
+	}
+	return len(matches), nil
+}
+
+// matching returns the current version of every record matching whereStmt:
+// the records of the file, changed or not, followed by the inserted ones.
+func (c *Changes) matching(whereStmt predicate.Predicate) ([]*pendingRecord, error) {
+	c.table.mu.RLock()
+	defer c.table.mu.RUnlock()
+	whereStmt, err := c.table.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Changes.matching: %w", err)
+	}
+	matches := make([]*pendingRecord, 0)
+	match := func(p *pendingRecord) error {
+		if p.values == nil {
+			return nil
+		}
+		ok, err := c.table.evaluateWhereStmt(whereStmt, p.values)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+		return nil
+	}
+	err = c.table.scanSnapshot(c.snapshot, nil, func(offset int64, record *parser.RawRecord) (bool, error) {
+		p, ok := c.byOffset[offset]
+		if !ok {
+			p = &pendingRecord{
+				old:    newDeletableRecord(offset, record.FullSize, record.Values),
+				values: record.Values,
+				pos:    -1,
+			}
+		}
+		return true, match(p)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Changes.matching: %w", err)
+	}
+	for _, p := range c.records {
+		if p.old != nil {
+			continue
+		}
+		if err := match(p); err != nil {
+			return nil, fmt.Errorf("Changes.matching: %w", err)
+		}
+	}
+	return matches, nil
+}
+
+// lock locks the records of the file about to be changed.
+func (c *Changes) lock(matches []*pendingRecord) error {
+	if c.lockRow == nil {
+		return nil
+	}
+	for _, p := range matches {
+		if p.old == nil {
+			continue
+		}
+		if err := c.lockRow(p.old.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// change sets the values of every record of matches to the matching ones
+// of values, nil deleting it, once the undo log recorded how to undo it. A
+// record changed for the first time is added to the changes.
+func (c *Changes) change(matches []*pendingRecord, values []map[string]interface{}) error {
+	if c.logUndo != nil {
+		undo := make([]undoRecord, len(matches))
+		pos := len(c.records)
+		for i, p := range matches {
+			if p.pos >= 0 {
+				undo[i] = undoRecord{pos: p.pos, values: p.values}
+				continue
+			}
+			undo[i] = undoRecord{pos: pos, added: true}
+			pos++
+		}
+		data, err := c.encodeUndo(undo)
+		if err != nil {
+			return fmt.Errorf("Changes.change: %w", err)
+		}
+		if err := c.logUndo(data); err != nil {
+			return fmt.Errorf("Changes.change: %w", err)
+		}
+	}
+	for i, p := range matches {
+		p.values = values[i]
+		if p.pos >= 0 {
+			continue
+		}
+		p.pos = len(c.records)
+		c.records = append(c.records, p)
+		if p.old != nil {
+			c.byOffset[p.old.offset] = p
+		}
+	}
+	return nil
+}
+
+// encodeUndo encodes undo as the number of records followed, for each of
+// them, by its position, whether it was added and, when it was not, its
+// version before the change.
+func (c *Changes) encodeUndo(undo []undoRecord) ([]byte, error) {
+	buf := bytes.Buffer{}
+	count, err := encoding.NewTLVMarshaler(int64(len(undo))).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("Changes.encodeUndo: %w", err)
+	}
+	buf.Write(count)
+	for _, u := range undo {
+		for _, v := range []interface{}{int64(u.pos), u.added} {
+			b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("Changes.encodeUndo: %w", err)
+			}
+			buf.Write(b)
+		}
+		if u.added {
+			continue
+		}
+		record, err := c.table.encodeRecord(u.values)
+		if err != nil {
+			return nil, fmt.Errorf("Changes.encodeUndo: %w", err)
+		}
+		buf.Write(record.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeUndo decodes the undo records encoded by encodeUndo.
+func (c *Changes) decodeUndo(data []byte) ([]undoRecord, error) {
+	r := bytes.NewReader(data)
+	tlvParser := parser.NewTLVParser(platformio.NewReader(r))
+	records := parser.NewRecordParser(r, c.table.columnNames)
+	val, err := tlvParser.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("Changes.decodeUndo: %w", err)
+	}
+	count, ok := val.(int64)
+	if !ok || count < 0 {
+		return nil, fmt.Errorf("Changes.decodeUndo: %w", NewInvalidUndoError(fmt.Sprintf("invalid count %v", val)))
+	}
+	undo := make([]undoRecord, 0, count)
+	for i := int64(0); i < count; i++ {
+		pos, err := tlvParser.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("Changes.decodeUndo: %w", err)
+		}
+		added, err := tlvParser.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("Changes.decodeUndo: %w", err)
+		}
+		u := undoRecord{}
+		p, ok := pos.(int64)
+		if !ok || p < 0 {
+			return nil, fmt.Errorf("Changes.decodeUndo: %w", NewInvalidUndoError(fmt.Sprintf("invalid position %v", pos)))
+		}
+		u.pos = int(p)
+		if u.added, ok = added.(bool); !ok {
+			return nil, fmt.Errorf("Changes.decodeUndo: %w", NewInvalidUndoError(fmt.Sprintf("invalid added flag %v", added)))
+		}
+		if !u.added {
+			if err := records.Parse(); err != nil {
+				return nil, fmt.Errorf("Changes.decodeUndo: %w", err)
+			}
+			u.values = records.Value.Values
+		}
+		undo = append(undo, u)
+	}
+	return undo, nil
+}
+
+// Prepare checks the unique indexes against the changes as a whole and
+// returns the operations redoing them, to be logged before they are
+// applied. A record changed by a transaction committed after the snapshot
+// fails with a WriteConflictError: the first committer wins. The table must
+// be locked with Lock from Prepare until Apply returns.
+func (c *Changes) Prepare() ([]wal.Operation, error) {
+	for _, p := range c.records {
+		if p.old != nil && c.table.versions.Changed(p.old.offset, c.snapshot) {
+			return nil, fmt.Errorf("Changes.Prepare: %w", NewWriteConflictError(c.table.Name, p.old.offset))
+		}
+	}
+
+	c.deleted = make([]*DeletableRecord, 0)
+	c.updatedOld = make([]*DeletableRecord, 0)
+	c.updated = make([]map[string]interface{}, 0)
+	c.inserted = make([]map[string]interface{}, 0)
+	for _, p := range c.records {
+		switch {
+		case p.old == nil:
+			if p.values != nil {
+				c.inserted = append(c.inserted, p.values)
+			}
+		case p.values == nil:
+			c.deleted = append(c.deleted, p.old)
+		default:
+			c.updatedOld = append(c.updatedOld, p.old)
+			c.updated = append(c.updated, p.values)
+		}
+	}
+
+	replaced := append(append([]*DeletableRecord{}, c.deleted...), c.updatedOld...)
+	added := append(append([]map[string]interface{}{}, c.updated...), c.inserted...)
+	if err := c.table.checkUniqueUpdate(replaced, added); err != nil {
+		return nil, fmt.Errorf("Changes.Prepare: %w", err)
+	}
+
+	ops := make([]wal.Operation, 0, 3)
+	if len(c.deleted) > 0 {
+		data, err := c.table.encodeDeletes(c.deleted)
+		if err != nil {
+			return nil, fmt.Errorf("Changes.Prepare: %w", err)
+		}
+		ops = append(ops, wal.Operation{Table: c.table.Name, Op: walencoding.OpDelete, Data: data})
+	}
+	if len(c.updatedOld) > 0 {
+		data, afters, err := c.table.encodeUpdates(c.updatedOld, c.updated)
+		if err != nil {
+			return nil, fmt.Errorf("Changes.Prepare: %w", err)
+		}
+		c.afters = afters
+		ops = append(ops, wal.Operation{Table: c.table.Name, Op: walencoding.OpUpdate, Data: data})
+	}
+	if len(c.inserted) > 0 {
+		c.insertedRaw = make([][]byte, 0, len(c.inserted))
+		for _, record := range c.inserted {
+			buf, err := c.table.encodeRecord(record)
+			if err != nil {
+				return nil, fmt.Errorf("Changes.Prepare: %w", err)
+			}
+			c.insertedRaw = append(c.insertedRaw, buf.Bytes())
+		}
+		base, err := c.insertBase()
+		if err != nil {
+			return nil, fmt.Errorf("Changes.Prepare: %w", err)
+		}
+		data, err := c.table.encodeInsertBatchAt(base, c.insertedRaw)
+		if err != nil {
+			return nil, fmt.Errorf("Changes.Prepare: %w", err)
+		}
+		ops = append(ops, wal.Operation{Table: c.table.Name, Op: walencoding.OpInsertBatch, Data: data})
+	}
+	c.ops = ops
+	return ops, nil
+}
+
+// insertBase returns the offset the inserted records are appended at: the
+// end of the file once the updated records that grew are relocated.
+func (c *Changes) insertBase() (int64, error) {
+	base, err := c.table.appendBase()
+	if err != nil {
+		return 0, fmt.Errorf("Changes.insertBase: %w", err)
+	}
+	relocated := make([][]byte, 0)
+	for i, rec := range c.updatedOld {
+		if uint32(len(c.afters[i])) != rec.l {
+			relocated = append(relocated, c.afters[i])
+		}
+	}
+	if len(relocated) == 0 {
+		return base, nil
+	}
+	p, err := c.table.place(base, relocated)
+	if err != nil {
+		return 0, fmt.Errorf("Changes.insertBase: %w", err)
+	}
+	return p.end, nil
+}
+
+// Apply writes the prepared changes to the table file and its indexes,
+// stamped with the writer tx, and stamps the pages written with lsn, the
+// entry the changes were logged as.
+func (c *Changes) Apply(tx, lsn int64) error {
+	c.table.wal.Dirty(c.table.file)
+	c.table.writeTx, c.table.lsn, c.table.touched = tx, lsn, nil
+	defer func() {
+		c.table.writeTx, c.table.lsn = 0, 0
+	}()
+	if err := c.apply(); err != nil {
+		return fmt.Errorf("Changes.Apply: %w", err)
+	}
+	if err := c.table.stampPages(); err != nil {
+		return fmt.Errorf("Changes.Apply: %w", err)
+	}
+	return nil
+}
+
+func (c *Changes) apply() error {
+	if _, err := c.table.markRecordDeleted(c.deleted); err != nil {
+		return err
+	}
+	if len(c.updatedOld) > 0 {
+		if err := c.table.writeUpdates(c.updatedOld, c.updated, c.afters); err != nil {
+			return err
+		}
+	}
+	if len(c.inserted) == 0 {
+		return nil
+	}
+	return c.table.writeBatch(c.insertedRaw, c.inserted)
+}
+
+// Undo rolls back the changes applied by the writer tx, logged as the
+// entry lsn, once applying the entry failed. The rollback is logged as the
+// entry abort.
+func (c *Changes) Undo(tx, lsn, abort int64) error {
+	if err := c.table.rollback(tx, lsn, abort, c.ops); err != nil {
+		return fmt.Errorf("Changes.Undo: %w", err)
+	}
+	return nil
+}
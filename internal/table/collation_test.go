@@ -0,0 +1,117 @@
+package table
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/aggregate"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollation_NoCase(t *testing.T) {
+	tb := newTestTableWithUsername(t, column.ColumnOptions{Collation: collate.NoCase})
+	insertTestUsers(t, tb)
+	assert.Equal(t, collate.NoCase, tb.Columns()["username"].Collation())
+
+	rows, err := tb.Select(predicate.Eq("username", "BANY"))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, []int32{1, 4}, selectIDs(t, tb, predicate.Like("username", "BA%")))
+
+	_, err = tb.Insert(map[string]interface{}{"id": int32(6), "username": "Zed", "age": int64(1)})
+	assert.Nil(t, err)
+	_, err = tb.Insert(map[string]interface{}{"id": int32(7), "username": "Adam", "age": int64(1)})
+	assert.Nil(t, err)
+	results, err := tb.Query(Query{Columns: []string{"username"}, OrderBy: []OrderBy{Asc("username")}, Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"username": "Adam"}, {"username": "alice"}, {"username": "bany"}}, results)
+
+	// unique indexes treat strings equal under the collation as duplicates
+	assert.Nil(t, tb.CreateIndex("username", true))
+	_, err = tb.Insert(map[string]interface{}{"id": int32(8), "username": "ALICE", "age": int64(1)})
+	var violation *index.UniqueViolationError
+	assert.ErrorAs(t, err, &violation)
+	rows, err = tb.LookupIndex("username", "CaRoL")
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+
+	// the collation is part of the persisted column definition
+	tb.columns = make(Columns)
+	tb.columnNames = nil
+	assert.Nil(t, tb.ReadColumnDefinitions())
+	assert.Equal(t, collate.NoCase, tb.Columns()["username"].Collation())
+	assert.Equal(t, collate.Binary, tb.Columns()["id"].Collation())
+}
+
+func TestCollation_SharedPredicate(t *testing.T) {
+	nocase := newTestTableWithUsername(t, column.ColumnOptions{Collation: collate.NoCase})
+	insertTestUsers(t, nocase)
+	binary := newTestTableWithUsername(t, column.ColumnOptions{})
+	insertTestUsers(t, binary)
+
+	// each table compares under its own collation, whichever ran last
+	where := predicate.Eq("username", "BANY")
+	assert.Equal(t, []int32{1}, selectIDs(t, nocase, where))
+	assert.Empty(t, selectIDs(t, binary, where))
+	assert.Equal(t, []int32{1}, selectIDs(t, nocase, where))
+
+	stmt, err := binary.Prepare(Query{Where: predicate.Eq("username", predicate.Param(1))})
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1}, selectIDs(t, nocase, predicate.Eq("username", "BANY")))
+	rows, err := stmt.Query("BANY")
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestCollation_GroupBy(t *testing.T) {
+	tb := newTestTableWithUsername(t, column.ColumnOptions{Collation: collate.NoCase})
+	for i, name := range []string{"Bany", "bany", "BANY", "alice"} {
+		_, err := tb.Insert(map[string]interface{}{"id": int32(i + 1), "username": name, "age": int64(i)})
+		assert.Nil(t, err)
+	}
+
+	// strings equal under the collation share a group
+	rows, err := tb.Aggregate(AggregateQuery{GroupBy: []string{"username"}, Aggregates: []aggregate.Aggregate{aggregate.Count("")}})
+	assert.Nil(t, err)
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		counts[strings.ToLower(row["username"].(string))] = row["count(*)"].(int64)
+	}
+	assert.Equal(t, map[string]int64{"bany": 3, "alice": 1}, counts)
+
+	rows, err = tb.Aggregate(AggregateQuery{Aggregates: []aggregate.Aggregate{
+		aggregate.CountDistinct("username"),
+		aggregate.Min("username"),
+		aggregate.Max("username"),
+	}})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, int64(2), rows[0]["count(distinct username)"])
+	assert.Equal(t, "alice", rows[0]["min(username)"])
+	assert.Equal(t, "Bany", rows[0]["max(username)"])
+}
+
+func TestCollation_Unicode(t *testing.T) {
+	tb := newTestTableWithUsername(t, column.ColumnOptions{Collation: collate.Unicode})
+	_, err := tb.Insert(map[string]interface{}{"id": int32(1), "username": "cafe\u0301", "age": int64(1)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []int32{1}, selectIDs(t, tb, predicate.Eq("username", "caf\u00e9")))
+	assert.Empty(t, selectIDs(t, tb, predicate.Eq("username", "CAF\u00c9")))
+}
+
+func TestCollation_OnlyStringColumns(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "tb")
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = NewTableWithColumns(f, Columns{
+		"id": column.NewColumn("id", types.TypeInt32, column.ColumnOptions{Collation: collate.NoCase}),
+	}, []string{"id"})
+	assert.NotNil(t, err)
+}
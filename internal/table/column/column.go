@@ -2,6 +2,7 @@ package column
 
 import (
 	"github.com/9bany/db/internal/platform/bytes"
+	"github.com/9bany/db/internal/platform/collate"
 	"github.com/9bany/db/internal/platform/types"
 	"github.com/9bany/db/internal/table/column/encoding"
 )
@@ -12,6 +13,8 @@ const (
 
 type ColumnOptions struct {
 	Nullable bool
+	// Collation applies to string columns, the zero value is binary.
+	Collation collate.Collation
 }
 
 func NewColumn(name string, dataType byte, opts ColumnOptions) *Column {
@@ -34,6 +37,7 @@ type Column struct {
 
 func (c *Column) MarshalBinary() ([]byte, error) {
 	marshaler := encoding.NewColumnDefinitionMarshaler(c.Name, c.dataType, c.opts.Nullable)
+	marshaler.Collation = byte(c.opts.Collation)
 	return marshaler.MarshalBinary()
 }
 
@@ -45,7 +49,10 @@ func (c *Column) UnmarshalBinary(buf []byte) error {
 	}
 	c.Name = marshaler.Name
 	c.dataType = marshaler.DataType
-	c.opts = ColumnOptions{Nullable: marshaler.AllowNull}
+	c.opts = ColumnOptions{
+		Nullable:  marshaler.AllowNull,
+		Collation: collate.Collation(marshaler.Collation),
+	}
 	return nil
 }
 
@@ -62,6 +69,19 @@ func (c *Column) ValidateValue(value interface{}) error {
 	}
 	return nil
 }
+
+func (c *Column) DataType() byte {
+	return c.dataType
+}
+
+func (c *Column) Nullable() bool {
+	return c.opts.Nullable
+}
+
+func (c *Column) Collation() collate.Collation {
+	return c.opts.Collation
+}
+
 func (c *Column) NameToStr() string {
 	trimmed := bytes.TrimZeroBytes(c.Name[:])
 	str := ""
@@ -21,6 +21,9 @@ type ColumnDefinitionMarshaler struct {
 	Name      [64]byte
 	DataType  byte
 	AllowNull bool
+	// Collation is only encoded when it is not binary, so definitions of
+	// binary columns are the same as before collations existed.
+	Collation byte
 }
 
 func (c *ColumnDefinitionMarshaler) MarshalBinary() ([]byte, error) {
@@ -61,6 +64,15 @@ func (c *ColumnDefinitionMarshaler) MarshalBinary() ([]byte, error) {
 	}
 	buf.Write(b)
 
+	if c.Collation != 0 {
+		collation := encoding.NewTLVMarshaler(c.Collation)
+		b, err = collation.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("ColumnDefinitionMarshaler.MarshalBinary: collation: %w", err)
+		}
+		buf.Write(b)
+	}
+
 	return buf.Bytes(), nil
 }
 
@@ -115,15 +127,32 @@ func (c *ColumnDefinitionMarshaler) UnmarshalBinary(data []byte) error {
 	allowNull := allowNullTLV.Value
 	n += allowNullTLV.BytesRead
 
+	var collation byte
+	if n < uint32(len(data)) {
+		collationTLV := encoding.NewTLVUnmarshaler(byteUnmarshaler)
+		if err = collationTLV.UnmarshalBinary(data[n:]); err != nil {
+			return fmt.Errorf("ColumnDefinitionMarshaler.UnmarshalBinary: collation: %w", err)
+		}
+		collation = collationTLV.Value
+	}
+
 	copy(c.Name[:], name)
 	c.DataType = dataTypeVal
 	c.AllowNull = allowNull != 0
+	c.Collation = collation
 
 	return nil
 }
 
 func (c *ColumnDefinitionMarshaler) Size() uint32 {
-	return types.LenByte + // type of col name
+	var collation uint32
+	if c.Collation != 0 {
+		collation = types.LenByte + // type of collation
+			types.LenInt32 + // len of collation
+			uint32(binary.Size(c.Collation)) // value of collation
+	}
+	return collation +
+		types.LenByte + // type of col name
 		types.LenInt32 + // len of col name
 		uint32(len(c.Name)) + // value of col name
 		types.LenByte + // type of data type
@@ -22,3 +22,27 @@ func TestColumnDefMarshal(t *testing.T) {
 	assert.Equal(t, types.TypeInt32, marshaler.DataType)
 	assert.False(t, marshaler.AllowNull)
 }
+
+func TestColumnDefMarshal_Collation(t *testing.T) {
+	var colName [64]byte
+	copy(colName[:], "username")
+	marshaler := NewColumnDefinitionMarshaler(colName, types.TypeString, true)
+	marshaler.Collation = 1
+	data, err := marshaler.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, int(marshaler.Size())+types.LenMeta, len(data))
+
+	decoded := NewColumnDefinitionMarshaler([64]byte{}, 0, false)
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, byte(1), decoded.Collation)
+
+	// binary columns end after allow null
+	marshaler.Collation = 0
+	binaryData, err := marshaler.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, data[types.LenMeta:len(data)-types.LenMeta-1], binaryData[types.LenMeta:])
+	decoded = NewColumnDefinitionMarshaler([64]byte{}, 0, false)
+	assert.Nil(t, decoded.UnmarshalBinary(binaryData))
+	assert.Equal(t, byte(0), decoded.Collation)
+	assert.True(t, decoded.AllowNull)
+}
@@ -32,3 +32,57 @@ func NewInvalidFilename(filename string) *InvalidFilename {
 func (e *InvalidFilename) Error() string {
 	return fmt.Sprintf("invalid filename: %s", e.filename)
 }
+
+type InvalidParameterError struct {
+	param  string
+	reason string
+}
+
+func NewInvalidParameterError(param, reason string) *InvalidParameterError {
+	return &InvalidParameterError{param: param, reason: reason}
+}
+
+func (e *InvalidParameterError) Error() string {
+	return fmt.Sprintf("parameter %s %s", e.param, e.reason)
+}
+
+type NoUniqueConstraintError struct {
+	columns []string
+}
+
+func NewNoUniqueConstraintError(columns []string) *NoUniqueConstraintError {
+	return &NoUniqueConstraintError{columns: columns}
+}
+
+func (e *NoUniqueConstraintError) Error() string {
+	return fmt.Sprintf("no unique constraint matches the conflict target %v", e.columns)
+}
+
+// WriteConflictError reports a record changed by a transaction committed
+// after the snapshot of the one changing it.
+type WriteConflictError struct {
+	table  string
+	offset int64
+}
+
+func NewWriteConflictError(table string, offset int64) *WriteConflictError {
+	return &WriteConflictError{table: table, offset: offset}
+}
+
+func (e *WriteConflictError) Error() string {
+	return fmt.Sprintf("record at offset %d of table %s was changed by a concurrent transaction", e.offset, e.table)
+}
+
+// InvalidUndoError reports undo data that does not match the changes it
+// undoes.
+type InvalidUndoError struct {
+	reason string
+}
+
+func NewInvalidUndoError(reason string) *InvalidUndoError {
+	return &InvalidUndoError{reason: reason}
+}
+
+func (e *InvalidUndoError) Error() string {
+	return fmt.Sprintf("invalid undo: %s", e.reason)
+}
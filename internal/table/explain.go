@@ -0,0 +1,191 @@
+package table
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// Explain returns the physical plan of q. With analyze the query is executed
+// and every node reports its actual rows, pages read and time.
+func (t *Table) Explain(q Query, analyze bool) (*plan.Node, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.explain(q, analyze)
+}
+
+func (t *Table) explain(q Query, analyze bool) (*plan.Node, error) {
+	q, err := t.validateQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Explain: %w", err)
+	}
+
+	nodes := &queryNodes{scan: t.planScan(q.Where)}
+	root := nodes.scan
+	if len(q.OrderBy) > 0 {
+		nodes.sort = plan.NewNode(plan.OpSort, root)
+		nodes.sort.EstimatedRows = root.EstimatedRows
+		nodes.sort.Details = []string{formatOrderBy(q.OrderBy)}
+		root = nodes.sort
+	}
+	if q.Limit > 0 || q.Offset > 0 {
+		nodes.limit = plan.NewNode(plan.OpLimit, root)
+		nodes.limit.EstimatedRows = math.Max(0, root.EstimatedRows-float64(q.Offset))
+		if q.Limit > 0 {
+			nodes.limit.EstimatedRows = math.Min(nodes.limit.EstimatedRows, float64(q.Limit))
+		}
+		nodes.limit.Details = []string{formatLimit(q.Limit, q.Offset)}
+		root = nodes.limit
+	}
+	var projectNode *plan.Node
+	if len(q.Columns) > 0 {
+		projectNode = plan.NewNode(plan.OpProject, root)
+		projectNode.EstimatedRows = root.EstimatedRows
+		projectNode.Details = []string{"Output: " + strings.Join(q.Columns, ", ")}
+		root = projectNode
+	}
+	if !analyze {
+		return root, nil
+	}
+
+	start := time.Now()
+	results, err := t.runQuery(q, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Explain: %w", err)
+	}
+	projectNode.Finish(int64(len(results)), start)
+	return root, nil
+}
+
+// ExplainDelete returns the plan of Delete(whereStmt). With analyze the
+// records are actually deleted.
+func (t *Table) ExplainDelete(whereStmt predicate.Predicate, analyze bool) (*plan.Node, error) {
+	defer t.lock(analyze)()
+	return t.explainDelete(whereStmt, analyze)
+}
+
+func (t *Table) explainDelete(whereStmt predicate.Predicate, analyze bool) (*plan.Node, error) {
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainDelete: %w", err)
+	}
+	scanNode := t.planScan(whereStmt)
+	root := plan.NewNode(plan.OpDelete, scanNode)
+	root.Table = t.Name
+	root.EstimatedRows = scanNode.EstimatedRows
+	if !analyze {
+		return root, nil
+	}
+
+	start := time.Now()
+	deletableRecords, err := t.findDeletableRecords(whereStmt, scanNode)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainDelete: %w", err)
+	}
+	n, err := t.deleteRecords(deletableRecords)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainDelete: %w", err)
+	}
+	root.Finish(int64(n), start)
+	return root, nil
+}
+
+// ExplainUpdate returns the plan of Update(whereStmt, values). With analyze
+// the records are actually updated.
+func (t *Table) ExplainUpdate(
+	whereStmt predicate.Predicate,
+	values map[string]interface{},
+	analyze bool,
+) (*plan.Node, error) {
+	defer t.lock(analyze)()
+	return t.explainUpdate(whereStmt, values, analyze)
+}
+
+func (t *Table) explainUpdate(
+	whereStmt predicate.Predicate,
+	values map[string]interface{},
+	analyze bool,
+) (*plan.Node, error) {
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainUpdate: %w", err)
+	}
+	values, err = t.validateAssignments(values)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainUpdate: %w", err)
+	}
+	scanNode := t.planScan(whereStmt)
+	root := plan.NewNode(plan.OpUpdate, scanNode)
+	root.Table = t.Name
+	root.EstimatedRows = scanNode.EstimatedRows
+	for _, col := range t.columnNames {
+		if v, ok := values[col]; ok {
+			root.Details = append(root.Details, fmt.Sprintf("Set: %s = %v", col, v))
+		}
+	}
+	if !analyze {
+		return root, nil
+	}
+
+	start := time.Now()
+	updated, err := t.update(whereStmt, values, scanNode)
+	if err != nil {
+		return nil, fmt.Errorf("Table.ExplainUpdate: %w", err)
+	}
+	root.Finish(int64(len(updated)), start)
+	return root, nil
+}
+
+// PlanScan returns the scan node Select would run for whereStmt. It is used
+// by operators outside this package that build on table scans.
+func (t *Table) PlanScan(whereStmt predicate.Predicate) *plan.Node {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.planScan(whereStmt)
+}
+
+// SelectAnalyzed is Select recording its actual rows, pages read and time
+// into node.
+func (t *Table) SelectAnalyzed(whereStmt predicate.Predicate, node *plan.Node) ([]map[string]interface{}, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.SelectAnalyzed: %w", err)
+	}
+	results := make([]map[string]interface{}, 0)
+	err = t.scanAnalyzed(whereStmt, node, func(_ int64, record *parser.RawRecord) (bool, error) {
+		results = append(results, record.Values)
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Table.SelectAnalyzed: %w", err)
+	}
+	return results, nil
+}
+
+func formatOrderBy(orderBy []OrderBy) string {
+	s := "Sort Key: "
+	for i, o := range orderBy {
+		if i > 0 {
+			s += ", "
+		}
+		s += o.Column
+		if o.Desc {
+			s += " DESC"
+		}
+	}
+	return s
+}
+
+func formatLimit(limit, offset int) string {
+	if limit == 0 {
+		return fmt.Sprintf("Offset: %d", offset)
+	}
+	return fmt.Sprintf("Limit: %d Offset: %d", limit, offset)
+}
@@ -0,0 +1,83 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain_Query(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	q := Query{
+		Columns: []string{"username"},
+		Where:   predicate.Gt("age", int64(20)),
+		OrderBy: []OrderBy{Desc("age")},
+		Limit:   2,
+	}
+	node, err := tb.Explain(q, false)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpProject, node.Operator)
+	assert.NotNil(t, node.Find(plan.OpLimit))
+	assert.NotNil(t, node.Find(plan.OpSort))
+	scan := node.Find(plan.OpSeqScan)
+	assert.NotNil(t, scan)
+	assert.Equal(t, "age > 20", scan.Filter)
+	assert.False(t, scan.Analyzed)
+	assert.Contains(t, node.String(), "-> Seq Scan on tb_user")
+
+	node, err = tb.Explain(q, true)
+	assert.Nil(t, err)
+	assert.True(t, node.Analyzed)
+	assert.Equal(t, int64(2), node.ActualRows)
+	scan = node.Find(plan.OpSeqScan)
+	assert.Equal(t, int64(4), scan.ActualRows)
+	assert.Greater(t, scan.PagesRead, int64(0))
+	assert.Contains(t, node.String(), "actual rows=4")
+}
+
+func TestExplain_IndexScan(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	where := predicate.And(predicate.Eq("id", int32(3)), predicate.Gt("age", int64(20)))
+	node, err := tb.Explain(Query{Where: where}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpIndexScan, node.Operator)
+	assert.Equal(t, "id", node.Index)
+	assert.InDelta(t, 1, node.EstimatedRows, 1)
+	assert.Equal(t, int64(1), node.ActualRows)
+	assert.Equal(t, int64(1), node.PagesRead)
+
+	rows, err := tb.Select(where)
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": int32(3), "username": "bob", "age": int64(41)},
+	}, rows)
+}
+
+func TestExplain_DeleteAndUpdate(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	node, err := tb.ExplainUpdate(predicate.Eq("age", int64(25)), map[string]interface{}{"age": int64(26)}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpUpdate, node.Operator)
+	assert.Equal(t, []string{"Set: age = 26"}, node.Details)
+	rows, err := tb.Select(predicate.Eq("age", int64(26)))
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+
+	node, err = tb.ExplainDelete(predicate.Eq("age", int64(25)), true)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpDelete, node.Operator)
+	assert.Equal(t, int64(2), node.ActualRows)
+	assert.Equal(t, int64(2), node.Children[0].ActualRows)
+	rows, err = tb.Select(nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+}
@@ -0,0 +1,40 @@
+package expr
+
+import "fmt"
+
+type InvalidExpressionError struct {
+	reason string
+}
+
+func NewInvalidExpressionError(reason string) *InvalidExpressionError {
+	return &InvalidExpressionError{reason: reason}
+}
+
+func (e *InvalidExpressionError) Error() string {
+	return fmt.Sprintf("invalid expression: %s", e.reason)
+}
+
+type DivisionByZeroError struct {
+	expr string
+}
+
+func NewDivisionByZeroError(expr string) *DivisionByZeroError {
+	return &DivisionByZeroError{expr: expr}
+}
+
+func (e *DivisionByZeroError) Error() string {
+	return fmt.Sprintf("division by zero in %s", e.expr)
+}
+
+type OutOfRangeError struct {
+	value    interface{}
+	dataType byte
+}
+
+func NewOutOfRangeError(value interface{}, dataType byte) *OutOfRangeError {
+	return &OutOfRangeError{value: value, dataType: dataType}
+}
+
+func (e *OutOfRangeError) Error() string {
+	return fmt.Sprintf("value %v is out of range for type %d", e.value, e.dataType)
+}
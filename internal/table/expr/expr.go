@@ -0,0 +1,415 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// Expr is a scalar expression evaluated against a single record, like the
+// right hand side of SET age = age + 1.
+type Expr interface {
+	// Type type-checks the expression against the columns of a table and
+	// returns the type of its result. It returns 0 when the result is
+	// always null.
+	Type(columns map[string]*column.Column) (byte, error)
+	Evaluate(record map[string]interface{}) (interface{}, error)
+	String() string
+}
+
+type ColumnRef struct {
+	Name string
+}
+
+// Col refers to the value of a column in the current record.
+func Col(name string) *ColumnRef {
+	return &ColumnRef{Name: name}
+}
+
+func (c *ColumnRef) Type(columns map[string]*column.Column) (byte, error) {
+	col, ok := columns[c.Name]
+	if !ok {
+		return 0, NewInvalidExpressionError(fmt.Sprintf("unknown column %s", c.Name))
+	}
+	return col.DataType(), nil
+}
+
+func (c *ColumnRef) Evaluate(record map[string]interface{}) (interface{}, error) {
+	v, ok := record[c.Name]
+	if !ok {
+		return nil, NewInvalidExpressionError(fmt.Sprintf("unknown column %s", c.Name))
+	}
+	return v, nil
+}
+
+func (c *ColumnRef) String() string {
+	return c.Name
+}
+
+type Literal struct {
+	Value interface{}
+}
+
+// Lit returns a constant. Go ints are stored as int64.
+func Lit(v interface{}) *Literal {
+	if n, ok := v.(int); ok {
+		v = int64(n)
+	}
+	return &Literal{Value: v}
+}
+
+func (l *Literal) Type(map[string]*column.Column) (byte, error) {
+	if l.Value == nil {
+		return 0, nil
+	}
+	t, err := types.TypeBytes(l.Value)
+	if err != nil {
+		return 0, NewInvalidExpressionError(fmt.Sprintf("unsupported literal %v", l.Value))
+	}
+	return t, nil
+}
+
+func (l *Literal) Evaluate(map[string]interface{}) (interface{}, error) {
+	return l.Value, nil
+}
+
+func (l *Literal) String() string {
+	return formatValue(l.Value)
+}
+
+type Operator string
+
+const (
+	OpAdd    Operator = "+"
+	OpSub    Operator = "-"
+	OpMul    Operator = "*"
+	OpDiv    Operator = "/"
+	OpMod    Operator = "%"
+	OpConcat Operator = "||"
+)
+
+// Binary applies an arithmetic operator or string concatenation. Like in
+// SQL the result is null when either operand is null.
+type Binary struct {
+	Op    Operator
+	Left  Expr
+	Right Expr
+}
+
+func Add(l, r Expr) *Binary    { return &Binary{Op: OpAdd, Left: l, Right: r} }
+func Sub(l, r Expr) *Binary    { return &Binary{Op: OpSub, Left: l, Right: r} }
+func Mul(l, r Expr) *Binary    { return &Binary{Op: OpMul, Left: l, Right: r} }
+func Div(l, r Expr) *Binary    { return &Binary{Op: OpDiv, Left: l, Right: r} }
+func Mod(l, r Expr) *Binary    { return &Binary{Op: OpMod, Left: l, Right: r} }
+func Concat(l, r Expr) *Binary { return &Binary{Op: OpConcat, Left: l, Right: r} }
+
+func (b *Binary) Type(columns map[string]*column.Column) (byte, error) {
+	if b.Left == nil || b.Right == nil {
+		return 0, NewInvalidExpressionError(fmt.Sprintf("%s requires two operands", b.Op))
+	}
+	l, err := b.Left.Type(columns)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.Right.Type(columns)
+	if err != nil {
+		return 0, err
+	}
+	switch b.Op {
+	case OpConcat:
+		return types.TypeString, nil
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod:
+		if (l != 0 && !isNumeric(l)) || (r != 0 && !isNumeric(r)) {
+			return 0, NewInvalidExpressionError(fmt.Sprintf("%s expects numeric operands: %s", b.Op, b))
+		}
+		return unify(l, r)
+	}
+	return 0, NewInvalidExpressionError(fmt.Sprintf("unknown operator %s", b.Op))
+}
+
+func (b *Binary) Evaluate(record map[string]interface{}) (interface{}, error) {
+	l, err := b.Left.Evaluate(record)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.Right.Evaluate(record)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	if b.Op == OpConcat {
+		return fmt.Sprint(l) + fmt.Sprint(r), nil
+	}
+
+	if _, ok := l.(float64); ok {
+		return b.evaluateFloat(l, r)
+	}
+	if _, ok := r.(float64); ok {
+		return b.evaluateFloat(l, r)
+	}
+	x, okX := toInt64(l)
+	y, okY := toInt64(r)
+	if !okX || !okY {
+		return nil, NewInvalidExpressionError(fmt.Sprintf("%s expects numeric operands, got %T and %T", b.Op, l, r))
+	}
+	var result int64
+	switch b.Op {
+	case OpAdd:
+		result = x + y
+	case OpSub:
+		result = x - y
+	case OpMul:
+		result = x * y
+	case OpDiv, OpMod:
+		if y == 0 {
+			return nil, NewDivisionByZeroError(b.String())
+		}
+		if b.Op == OpDiv {
+			result = x / y
+		} else {
+			result = x % y
+		}
+	}
+	_, int32L := l.(int32)
+	_, int32R := r.(int32)
+	if int32L && int32R {
+		return Convert(result, types.TypeInt32)
+	}
+	return result, nil
+}
+
+func (b *Binary) evaluateFloat(l, r interface{}) (interface{}, error) {
+	x, okX := toFloat64(l)
+	y, okY := toFloat64(r)
+	if !okX || !okY {
+		return nil, NewInvalidExpressionError(fmt.Sprintf("%s expects numeric operands, got %T and %T", b.Op, l, r))
+	}
+	switch b.Op {
+	case OpAdd:
+		return x + y, nil
+	case OpSub:
+		return x - y, nil
+	case OpMul:
+		return x * y, nil
+	}
+	if y == 0 {
+		return nil, NewDivisionByZeroError(b.String())
+	}
+	if b.Op == OpDiv {
+		return x / y, nil
+	}
+	return math.Mod(x, y), nil
+}
+
+func (b *Binary) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.Left, b.Op, b.Right)
+}
+
+type When struct {
+	Cond predicate.Predicate
+	Then Expr
+}
+
+// CaseExpr returns the Then of the first When whose condition holds, Else
+// otherwise. A missing Else is null.
+type CaseExpr struct {
+	Whens []When
+	Else  Expr
+}
+
+func Case(whens ...When) *CaseExpr {
+	return &CaseExpr{Whens: whens}
+}
+
+func (c *CaseExpr) Otherwise(e Expr) *CaseExpr {
+	c.Else = e
+	return c
+}
+
+func (c *CaseExpr) Type(columns map[string]*column.Column) (byte, error) {
+	if len(c.Whens) == 0 {
+		return 0, NewInvalidExpressionError("CASE requires at least one WHEN")
+	}
+	var result byte
+	branches := make([]Expr, 0, len(c.Whens)+1)
+	for _, w := range c.Whens {
+		if w.Cond == nil || w.Then == nil {
+			return 0, NewInvalidExpressionError("WHEN requires a condition and a result")
+		}
+		if err := w.Cond.Validate(columns); err != nil {
+			return 0, err
+		}
+		branches = append(branches, w.Then)
+	}
+	if c.Else != nil {
+		branches = append(branches, c.Else)
+	}
+	for _, branch := range branches {
+		t, err := branch.Type(columns)
+		if err != nil {
+			return 0, err
+		}
+		if result, err = unify(result, t); err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+func (c *CaseExpr) Evaluate(record map[string]interface{}) (interface{}, error) {
+	for _, w := range c.Whens {
+		ok, err := w.Cond.Evaluate(record)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return w.Then.Evaluate(record)
+		}
+	}
+	if c.Else == nil {
+		return nil, nil
+	}
+	return c.Else.Evaluate(record)
+}
+
+func (c *CaseExpr) String() string {
+	var sb strings.Builder
+	sb.WriteString("CASE")
+	for _, w := range c.Whens {
+		fmt.Fprintf(&sb, " WHEN %s THEN %s", w.Cond, w.Then)
+	}
+	if c.Else != nil {
+		fmt.Fprintf(&sb, " ELSE %s", c.Else)
+	}
+	sb.WriteString(" END")
+	return sb.String()
+}
+
+// Resolve returns a copy of e whose CASE conditions honor the collations of
+// columns, see predicate.Resolve. e must have been type-checked against
+// columns.
+func Resolve(e Expr, columns map[string]*column.Column) Expr {
+	switch v := e.(type) {
+	case *Binary:
+		return &Binary{Op: v.Op, Left: Resolve(v.Left, columns), Right: Resolve(v.Right, columns)}
+	case *Func:
+		args := make([]Expr, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = Resolve(arg, columns)
+		}
+		return &Func{Name: v.Name, Args: args}
+	case *CaseExpr:
+		whens := make([]When, len(v.Whens))
+		for i, w := range v.Whens {
+			whens[i] = When{Cond: predicate.Resolve(w.Cond, columns), Then: Resolve(w.Then, columns)}
+		}
+		resolved := &CaseExpr{Whens: whens}
+		if v.Else != nil {
+			resolved.Else = Resolve(v.Else, columns)
+		}
+		return resolved
+	}
+	return e
+}
+
+// Convert converts v to a value of dataType. Numbers are converted between
+// widths when no precision is lost, any other value must already have the
+// type.
+func Convert(v interface{}, dataType byte) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch dataType {
+	case types.TypeInt32, types.TypeInt64:
+		n, ok := toInt64(v)
+		if !ok {
+			break
+		}
+		if dataType == types.TypeInt64 {
+			return n, nil
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, NewOutOfRangeError(v, dataType)
+		}
+		return int32(n), nil
+	case types.TypeFloat64:
+		if f, ok := toFloat64(v); ok {
+			return f, nil
+		}
+	}
+	t, err := types.TypeBytes(v)
+	if err != nil || t != dataType {
+		return nil, NewInvalidExpressionError(fmt.Sprintf("%v cannot be converted to type %d", v, dataType))
+	}
+	return v, nil
+}
+
+// Assignable reports whether the result of an expression of type from can
+// be stored in a column of type to.
+func Assignable(from, to byte) bool {
+	if from == 0 || from == to {
+		return true
+	}
+	return isNumeric(from) && isNumeric(to) && (from != types.TypeFloat64 || to == types.TypeFloat64)
+}
+
+// unify returns the type of a value that is either of type a or b.
+func unify(a, b byte) (byte, error) {
+	switch {
+	case a == 0:
+		return b, nil
+	case b == 0 || a == b:
+		return a, nil
+	case !isNumeric(a) || !isNumeric(b):
+		return 0, NewInvalidExpressionError(fmt.Sprintf("incompatible types %d and %d", a, b))
+	case a == types.TypeFloat64 || b == types.TypeFloat64:
+		return types.TypeFloat64, nil
+	}
+	return types.TypeInt64, nil
+}
+
+func isNumeric(t byte) bool {
+	switch t {
+	case types.TypeByte, types.TypeInt32, types.TypeInt64, types.TypeFloat64:
+		return true
+	}
+	return false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case byte:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	if f, ok := v.(float64); ok {
+		return f, true
+	}
+	n, ok := toInt64(v)
+	return float64(n), ok
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("'%s'", v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,103 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+var testColumns = map[string]*column.Column{
+	"id":       column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+	"username": column.NewColumn("username", types.TypeString, column.ColumnOptions{}),
+	"age":      column.NewColumn("age", types.TypeInt64, column.ColumnOptions{Nullable: true}),
+	"score":    column.NewColumn("score", types.TypeFloat64, column.ColumnOptions{}),
+}
+
+var testRecord = map[string]interface{}{
+	"id": int32(7), "username": "bany", "age": int64(30), "score": 1.5,
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr     Expr
+		expected interface{}
+		typ      byte
+	}{
+		{Add(Col("age"), Lit(1)), int64(31), types.TypeInt64},
+		{Mul(Col("id"), Col("id")), int32(49), types.TypeInt32},
+		{Sub(Col("id"), Lit(10)), int64(-3), types.TypeInt64},
+		{Div(Col("age"), Lit(4)), int64(7), types.TypeInt64},
+		{Mod(Col("age"), Lit(7)), int64(2), types.TypeInt64},
+		{Add(Col("score"), Col("id")), 8.5, types.TypeFloat64},
+		{Concat(Col("username"), Lit("!")), "bany!", types.TypeString},
+		{Add(Col("age"), Lit(nil)), nil, types.TypeInt64},
+		{Upper(Col("username")), "BANY", types.TypeString},
+		{Length(Col("username")), int64(4), types.TypeInt64},
+		{Abs(Sub(Lit(1), Col("age"))), int64(29), types.TypeInt64},
+		{Coalesce(Lit(nil), Col("age")), int64(30), types.TypeInt64},
+		{
+			Case(
+				When{Cond: predicate.Lt("age", int64(18)), Then: Lit("minor")},
+				When{Cond: predicate.Lt("age", int64(65)), Then: Lit("adult")},
+			).Otherwise(Lit("senior")),
+			"adult", types.TypeString,
+		},
+		{Case(When{Cond: predicate.Gt("age", int64(100)), Then: Lit(1)}), nil, types.TypeInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr.String(), func(t *testing.T) {
+			typ, err := tt.expr.Type(testColumns)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.typ, typ)
+			v, err := tt.expr.Evaluate(testRecord)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestType_Invalid(t *testing.T) {
+	for _, e := range []Expr{
+		Col("missing"),
+		Add(Col("username"), Lit(1)),
+		Upper(Col("age")),
+		Call("nope", Col("age")),
+		Call("upper"),
+		Case(),
+		Case(When{Cond: predicate.Eq("age", int64(1)), Then: Lit("a")}).Otherwise(Lit(1)),
+	} {
+		_, err := e.Type(testColumns)
+		var invalid *InvalidExpressionError
+		assert.True(t, errors.As(err, &invalid), e.String())
+	}
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	_, err := Div(Col("age"), Lit(0)).Evaluate(testRecord)
+	var divByZero *DivisionByZeroError
+	assert.True(t, errors.As(err, &divByZero))
+
+	_, err = Mul(Col("id"), Lit(int32(1<<30))).Evaluate(testRecord)
+	var outOfRange *OutOfRangeError
+	assert.True(t, errors.As(err, &outOfRange))
+}
+
+func TestConvert(t *testing.T) {
+	v, err := Convert(int64(3), types.TypeInt32)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), v)
+	v, err = Convert(int32(3), types.TypeFloat64)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, v)
+
+	_, err = Convert(int64(1<<40), types.TypeInt32)
+	assert.NotNil(t, err)
+	_, err = Convert(1.5, types.TypeInt64)
+	assert.NotNil(t, err)
+	assert.False(t, Assignable(types.TypeFloat64, types.TypeInt64))
+	assert.True(t, Assignable(types.TypeInt64, types.TypeInt32))
+}
@@ -0,0 +1,186 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+)
+
+type function struct {
+	minArgs int
+	// maxArgs is -1 for variadic functions
+	maxArgs int
+	typ     func(args []byte) (byte, error)
+	eval    func(args []interface{}) (interface{}, error)
+	// nullable functions are called with null arguments, the result of
+	// the others is null when an argument is null
+	nullable bool
+}
+
+var functions = map[string]function{
+	"UPPER": {
+		minArgs: 1, maxArgs: 1,
+		typ: stringArgs(types.TypeString),
+		eval: func(args []interface{}) (interface{}, error) {
+			return strings.ToUpper(args[0].(string)), nil
+		},
+	},
+	"LOWER": {
+		minArgs: 1, maxArgs: 1,
+		typ: stringArgs(types.TypeString),
+		eval: func(args []interface{}) (interface{}, error) {
+			return strings.ToLower(args[0].(string)), nil
+		},
+	},
+	"LENGTH": {
+		minArgs: 1, maxArgs: 1,
+		typ: stringArgs(types.TypeInt64),
+		eval: func(args []interface{}) (interface{}, error) {
+			return int64(utf8.RuneCountInString(args[0].(string))), nil
+		},
+	},
+	"ABS": {
+		minArgs: 1, maxArgs: 1,
+		typ: func(args []byte) (byte, error) {
+			if args[0] != 0 && !isNumeric(args[0]) {
+				return 0, NewInvalidExpressionError("ABS expects a numeric argument")
+			}
+			return args[0], nil
+		},
+		eval: func(args []interface{}) (interface{}, error) {
+			switch n := args[0].(type) {
+			case int32:
+				if n < 0 {
+					return Convert(-int64(n), types.TypeInt32)
+				}
+			case int64:
+				if n < 0 {
+					return -n, nil
+				}
+			case float64:
+				if n < 0 {
+					return -n, nil
+				}
+			}
+			return args[0], nil
+		},
+	},
+	"COALESCE": {
+		minArgs: 1, maxArgs: -1,
+		nullable: true,
+		typ: func(args []byte) (byte, error) {
+			var result byte
+			var err error
+			for _, t := range args {
+				if result, err = unify(result, t); err != nil {
+					return 0, err
+				}
+			}
+			return result, nil
+		},
+		eval: func(args []interface{}) (interface{}, error) {
+			for _, v := range args {
+				if v != nil {
+					return v, nil
+				}
+			}
+			return nil, nil
+		},
+	},
+}
+
+func stringArgs(result byte) func(args []byte) (byte, error) {
+	return func(args []byte) (byte, error) {
+		for _, t := range args {
+			if t != 0 && t != types.TypeString {
+				return 0, NewInvalidExpressionError("expected a string argument")
+			}
+		}
+		return result, nil
+	}
+}
+
+// Func calls a builtin function: UPPER, LOWER, LENGTH, ABS or COALESCE.
+type Func struct {
+	Name string
+	Args []Expr
+}
+
+func Call(name string, args ...Expr) *Func {
+	return &Func{Name: strings.ToUpper(name), Args: args}
+}
+
+func Upper(e Expr) *Func          { return Call("UPPER", e) }
+func Lower(e Expr) *Func          { return Call("LOWER", e) }
+func Length(e Expr) *Func         { return Call("LENGTH", e) }
+func Abs(e Expr) *Func            { return Call("ABS", e) }
+func Coalesce(args ...Expr) *Func { return Call("COALESCE", args...) }
+
+func (f *Func) Type(columns map[string]*column.Column) (byte, error) {
+	fn, ok := functions[f.Name]
+	if !ok {
+		return 0, NewInvalidExpressionError(fmt.Sprintf("unknown function %s", f.Name))
+	}
+	if len(f.Args) < fn.minArgs || (fn.maxArgs >= 0 && len(f.Args) > fn.maxArgs) {
+		return 0, NewInvalidExpressionError(fmt.Sprintf("wrong number of arguments for %s: %d", f.Name, len(f.Args)))
+	}
+	argTypes := make([]byte, 0, len(f.Args))
+	for _, arg := range f.Args {
+		if arg == nil {
+			return 0, NewInvalidExpressionError(fmt.Sprintf("%s argument cannot be nil", f.Name))
+		}
+		t, err := arg.Type(columns)
+		if err != nil {
+			return 0, err
+		}
+		argTypes = append(argTypes, t)
+	}
+	t, err := fn.typ(argTypes)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return t, nil
+}
+
+func (f *Func) Evaluate(record map[string]interface{}) (interface{}, error) {
+	fn, ok := functions[f.Name]
+	if !ok {
+		return nil, NewInvalidExpressionError(fmt.Sprintf("unknown function %s", f.Name))
+	}
+	args := make([]interface{}, 0, len(f.Args))
+	for _, arg := range f.Args {
+		v, err := arg.Evaluate(record)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && !fn.nullable {
+			return nil, nil
+		}
+		args = append(args, v)
+	}
+	if !fn.nullable {
+		argTypes := make([]byte, 0, len(args))
+		for _, v := range args {
+			t, err := types.TypeBytes(v)
+			if err != nil {
+				return nil, err
+			}
+			argTypes = append(argTypes, t)
+		}
+		if _, err := fn.typ(argTypes); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return fn.eval(args)
+}
+
+func (f *Func) String() string {
+	args := make([]string, 0, len(f.Args))
+	for _, arg := range f.Args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
+}
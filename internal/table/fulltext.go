@@ -0,0 +1,163 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/fulltext"
+)
+
+const FullTextFilenameTmpl = "%s_fts.bin"
+
+// SearchResult is a record matching a full-text query and its BM25 score.
+type SearchResult struct {
+	Record map[string]interface{}
+	Score  float64
+}
+
+// CreateFullTextIndex builds an inverted index on a string column using the
+// tokenizer registered under tokenizer, and persists its definition.
+func (t *Table) CreateFullTextIndex(column, tokenizer string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	col, ok := t.columns[column]
+	if !ok {
+		return fmt.Errorf("Table.CreateFullTextIndex: unknown column: %s", column)
+	}
+	if col.DataType() != types.TypeString {
+		return fmt.Errorf("Table.CreateFullTextIndex: column %s is not a string column", column)
+	}
+	if _, ok := t.fullText[column]; ok {
+		return fmt.Errorf("Table.CreateFullTextIndex: full-text index on %s already exists", column)
+	}
+
+	idx, err := fulltext.NewIndex(column, tokenizer)
+	if err != nil {
+		return fmt.Errorf("Table.CreateFullTextIndex: %w", err)
+	}
+	if err := t.buildFullTextIndex(idx); err != nil {
+		return fmt.Errorf("Table.CreateFullTextIndex: %w", err)
+	}
+	t.fullText[column] = idx
+
+	if err := t.writeFullTextDefinitions(); err != nil {
+		delete(t.fullText, column)
+		return fmt.Errorf("Table.CreateFullTextIndex: %w", err)
+	}
+	return nil
+}
+
+// FullTextIndex returns the full-text index on column or nil.
+func (t *Table) FullTextIndex(column string) *fulltext.Index {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.fullText[column]
+}
+
+// Search returns the records whose column matches q, best BM25 scores
+// first. A limit of zero returns every match.
+func (t *Table) Search(column string, q fulltext.Query, limit int) ([]SearchResult, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	idx, ok := t.fullText[column]
+	if !ok {
+		return nil, fmt.Errorf("Table.Search: no full-text index on column: %s", column)
+	}
+	matches := idx.Search(q)
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	results := make([]SearchResult, 0, len(matches))
+	for _, m := range matches {
+		rawRecord, err := t.readRecordAt(m.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("Table.Search: %w", err)
+		}
+		results = append(results, SearchResult{Record: rawRecord.Values, Score: m.Score})
+	}
+	return results, nil
+}
+
+// loadFullTextIndexes reads the persisted full-text index definitions and
+// rebuilds every index from the table file.
+func (t *Table) loadFullTextIndexes() error {
+	t.fullText = make(map[string]*fulltext.Index)
+	data, err := t.fs.ReadFile(t.fullTextPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Table.loadFullTextIndexes: %w", err)
+	}
+
+	tlvParser := parser.NewTLVParser(parserio.NewReader(bytes.NewReader(data)))
+	for {
+		col, err := tlvParser.Parse()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("Table.loadFullTextIndexes: %w", err)
+		}
+		tokenizer, err := tlvParser.Parse()
+		if err != nil {
+			return fmt.Errorf("Table.loadFullTextIndexes: %w", err)
+		}
+
+		idx, err := fulltext.NewIndex(col.(string), tokenizer.(string))
+		if err != nil {
+			return fmt.Errorf("Table.loadFullTextIndexes: %w", err)
+		}
+		if err := t.buildFullTextIndex(idx); err != nil {
+			return fmt.Errorf("Table.loadFullTextIndexes: %w", err)
+		}
+		t.fullText[idx.Column] = idx
+	}
+}
+
+func (t *Table) buildFullTextIndex(idx *fulltext.Index) error {
+	idx.Reset()
+	err := t.scan(nil, func(offset int64, record *parser.RawRecord) (bool, error) {
+		return true, idx.Add(record.Values[idx.Column], offset)
+	})
+	if err != nil {
+		return fmt.Errorf("Table.buildFullTextIndex: %w", err)
+	}
+	return nil
+}
+
+func (t *Table) writeFullTextDefinitions() error {
+	columns := make([]string, 0, len(t.fullText))
+	for col := range t.fullText {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	buf := bytes.Buffer{}
+	for _, col := range columns {
+		for _, v := range []interface{}{col, t.fullText[col].Tokenizer} {
+			b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("Table.writeFullTextDefinitions: %w", err)
+			}
+			buf.Write(b)
+		}
+	}
+	if err := t.fs.WriteFile(t.fullTextPath(), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Table.writeFullTextDefinitions: %w", err)
+	}
+	return nil
+}
+
+func (t *Table) fullTextPath() string {
+	return filepath.Join(filepath.Dir(t.file.Name()), fmt.Sprintf(FullTextFilenameTmpl, t.Name))
+}
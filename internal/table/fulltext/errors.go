@@ -0,0 +1,27 @@
+package fulltext
+
+import "fmt"
+
+type UnknownTokenizerError struct {
+	name string
+}
+
+func NewUnknownTokenizerError(name string) *UnknownTokenizerError {
+	return &UnknownTokenizerError{name: name}
+}
+
+func (e *UnknownTokenizerError) Error() string {
+	return fmt.Sprintf("unknown tokenizer: %s", e.name)
+}
+
+type InvalidQueryError struct {
+	reason string
+}
+
+func NewInvalidQueryError(reason string) *InvalidQueryError {
+	return &InvalidQueryError{reason: reason}
+}
+
+func (e *InvalidQueryError) Error() string {
+	return fmt.Sprintf("invalid full-text query: %s", e.reason)
+}
@@ -0,0 +1,79 @@
+package fulltext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWordTokenizer(t *testing.T) {
+	tokens := NewWordTokenizer(EnglishStopWords...).Tokenize("The Quick, brown-fox jumps over the lazy dög!")
+	assert.Equal(t, []Token{
+		{"quick", 1}, {"brown", 2}, {"fox", 3}, {"jumps", 4}, {"over", 5}, {"lazy", 7}, {"dög", 8},
+	}, tokens)
+	assert.Len(t, NewWordTokenizer().Tokenize("the end"), 2)
+}
+
+func newTestIndex(t *testing.T, docs ...string) *Index {
+	idx, err := NewIndex("description", StandardTokenizer)
+	assert.Nil(t, err)
+	for i, doc := range docs {
+		assert.Nil(t, idx.Add(doc, int64(i)))
+	}
+	return idx
+}
+
+func offsets(matches []Match) []int64 {
+	result := make([]int64, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, m.Offset)
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex(t,
+		"a database engine written in Go",
+		"the quick brown fox",
+		"database index, database search and database storage",
+		"brown bread and quick fox recipes",
+		"search engine for a database of foxes",
+	)
+
+	// more occurrences in a shorter record rank first
+	assert.Equal(t, []int64{2, 0, 4}, offsets(idx.Search(Term("Database"))))
+	assert.Equal(t, []int64{2, 4}, offsets(idx.Search(And(Term("database"), Term("search")))))
+	assert.ElementsMatch(t, []int64{0, 1, 3, 4}, offsets(idx.Search(Or(Term("engine"), Term("fox")))))
+	assert.Equal(t, []int64{1}, offsets(idx.Search(Phrase("quick brown fox"))))
+	// stop words keep their place in phrases and are ignored in terms
+	assert.Equal(t, []int64{4}, offsets(idx.Search(Phrase("engine for a database"))))
+	assert.Equal(t, []int64{3}, offsets(idx.Search(And(Term("the"), Term("bread")))))
+	assert.Empty(t, idx.Search(Term("the")))
+
+	assert.Nil(t, idx.Remove("the quick brown fox", 1))
+	assert.Empty(t, idx.Search(Phrase("quick brown")))
+	assert.Equal(t, 4, idx.Len())
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		`database`:                         `database`,
+		`database search`:                  `(database AND search)`,
+		`"quick fox" OR bread AND recipes`: `("quick fox" OR (bread AND recipes))`,
+	}
+	for text, expected := range tests {
+		q, err := Parse(text)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, q.String())
+	}
+	for _, text := range []string{``, `OR fox`, `"unterminated`} {
+		_, err := Parse(text)
+		assert.NotNil(t, err, text)
+	}
+}
+
+func TestNewIndex_UnknownTokenizer(t *testing.T) {
+	_, err := NewIndex("description", "klingon")
+	var unknown *UnknownTokenizerError
+	assert.ErrorAs(t, err, &unknown)
+}
@@ -0,0 +1,175 @@
+package fulltext
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// BM25 parameters.
+const (
+	K1 = 1.2
+	B  = 0.75
+)
+
+// Index is an inverted index mapping the terms of a string column to the
+// positions they appear at in every record. Like hash indexes only its
+// definition is persisted, entries are rebuilt when the table is opened.
+type Index struct {
+	Column    string
+	Tokenizer string
+	tokenizer Tokenizer
+	// postings maps a term to the sorted positions of the term by offset
+	postings map[string]map[int64][]int
+	// lengths holds the number of terms of every indexed record
+	lengths map[int64]int
+	total   int
+}
+
+func NewIndex(column, tokenizer string) (*Index, error) {
+	t, err := LookupTokenizer(tokenizer)
+	if err != nil {
+		return nil, fmt.Errorf("fulltext.NewIndex: %w", err)
+	}
+	return &Index{
+		Column:    column,
+		Tokenizer: tokenizer,
+		tokenizer: t,
+		postings:  make(map[string]map[int64][]int),
+		lengths:   make(map[int64]int),
+	}, nil
+}
+
+// Add indexes the text of the record at offset. Null values are not
+// indexed.
+func (i *Index) Add(v interface{}, offset int64) error {
+	if v == nil {
+		return nil
+	}
+	text, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("Index.Add: full-text index on %s expects strings, got %T", i.Column, v)
+	}
+	tokens := i.tokenizer.Tokenize(text)
+	for _, token := range tokens {
+		docs, ok := i.postings[token.Term]
+		if !ok {
+			docs = make(map[int64][]int)
+			i.postings[token.Term] = docs
+		}
+		docs[offset] = append(docs[offset], token.Position)
+	}
+	i.lengths[offset] = len(tokens)
+	i.total += len(tokens)
+	return nil
+}
+
+func (i *Index) Remove(v interface{}, offset int64) error {
+	text, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	length, ok := i.lengths[offset]
+	if !ok {
+		return nil
+	}
+	for _, token := range i.tokenizer.Tokenize(text) {
+		docs := i.postings[token.Term]
+		delete(docs, offset)
+		if len(docs) == 0 {
+			delete(i.postings, token.Term)
+		}
+	}
+	delete(i.lengths, offset)
+	i.total -= length
+	return nil
+}
+
+// Len returns the number of indexed records.
+func (i *Index) Len() int {
+	return len(i.lengths)
+}
+
+func (i *Index) Reset() {
+	i.postings = make(map[string]map[int64][]int)
+	i.lengths = make(map[int64]int)
+	i.total = 0
+}
+
+// Match is a record matching a query with its BM25 score.
+type Match struct {
+	Offset int64
+	Score  float64
+}
+
+// Search returns the records matching q, best scores first.
+func (i *Index) Search(q Query) []Match {
+	scores, ok := q.match(i)
+	matches := make([]Match, 0, len(scores))
+	if !ok {
+		return matches
+	}
+	for offset, score := range scores {
+		matches = append(matches, Match{Offset: offset, Score: score})
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].Score != matches[b].Score {
+			return matches[a].Score > matches[b].Score
+		}
+		return matches[a].Offset < matches[b].Offset
+	})
+	return matches
+}
+
+// phrase returns the number of occurrences of tokens, at their relative
+// positions, in every record holding them all.
+func (i *Index) phrase(tokens []Token) map[int64]int {
+	frequencies := make(map[int64]int)
+	first := tokens[0]
+	for offset, positions := range i.postings[first.Term] {
+		n := 0
+		for _, start := range positions {
+			if i.phraseAt(tokens, offset, start) {
+				n++
+			}
+		}
+		if n > 0 {
+			frequencies[offset] = n
+		}
+	}
+	return frequencies
+}
+
+func (i *Index) phraseAt(tokens []Token, offset int64, start int) bool {
+	for _, token := range tokens[1:] {
+		positions := i.postings[token.Term][offset]
+		want := start + token.Position - tokens[0].Position
+		k := sort.SearchInts(positions, want)
+		if k == len(positions) || positions[k] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// bm25 scores the records where a term or phrase appears with the given
+// frequencies.
+func (i *Index) bm25(frequencies map[int64]int) map[int64]float64 {
+	scores := make(map[int64]float64, len(frequencies))
+	n := float64(len(i.lengths))
+	if n == 0 {
+		return scores
+	}
+	df := float64(len(frequencies))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	avg := float64(i.total) / n
+	for offset, f := range frequencies {
+		tf := float64(f)
+		norm := 1 - B
+		if avg > 0 {
+			norm += B * float64(i.lengths[offset]) / avg
+		}
+		scores[offset] = idf * tf * (K1 + 1) / (tf + K1*norm)
+	}
+	return scores
+}
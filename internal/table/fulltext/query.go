@@ -0,0 +1,180 @@
+package fulltext
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Query selects and scores records of a full-text index.
+type Query interface {
+	// match returns the score of every matching record. It reports false
+	// when the query holds no term once tokenized, like a query made only
+	// of stop words, so AND and OR can ignore it.
+	match(i *Index) (map[int64]float64, bool)
+	String() string
+}
+
+type TermQuery struct {
+	Text string
+}
+
+// Term matches records containing the word. A text that tokenizes to
+// several terms is matched as a phrase.
+func Term(text string) *TermQuery {
+	return &TermQuery{Text: text}
+}
+
+func (q *TermQuery) match(i *Index) (map[int64]float64, bool) {
+	return (&PhraseQuery{Text: q.Text}).match(i)
+}
+
+func (q *TermQuery) String() string {
+	return q.Text
+}
+
+type PhraseQuery struct {
+	Text string
+}
+
+// Phrase matches records containing the words of text next to each other.
+func Phrase(text string) *PhraseQuery {
+	return &PhraseQuery{Text: text}
+}
+
+func (q *PhraseQuery) match(i *Index) (map[int64]float64, bool) {
+	tokens := i.tokenizer.Tokenize(q.Text)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	if len(tokens) == 1 {
+		frequencies := make(map[int64]int)
+		for offset, positions := range i.postings[tokens[0].Term] {
+			frequencies[offset] = len(positions)
+		}
+		return i.bm25(frequencies), true
+	}
+	return i.bm25(i.phrase(tokens)), true
+}
+
+func (q *PhraseQuery) String() string {
+	return fmt.Sprintf("%q", q.Text)
+}
+
+type LogicalOperator string
+
+const (
+	OpAnd LogicalOperator = "AND"
+	OpOr  LogicalOperator = "OR"
+)
+
+// Logical combines queries. The score of a record is the sum of the scores
+// of the operands it matches.
+type Logical struct {
+	Op       LogicalOperator
+	Operands []Query
+}
+
+func And(operands ...Query) *Logical {
+	return &Logical{Op: OpAnd, Operands: operands}
+}
+
+func Or(operands ...Query) *Logical {
+	return &Logical{Op: OpOr, Operands: operands}
+}
+
+func (q *Logical) match(i *Index) (map[int64]float64, bool) {
+	var scores map[int64]float64
+	for _, operand := range q.Operands {
+		operandScores, ok := operand.match(i)
+		if !ok {
+			continue
+		}
+		if scores == nil {
+			scores = operandScores
+			continue
+		}
+		for offset, score := range operandScores {
+			if _, ok := scores[offset]; ok || q.Op == OpOr {
+				scores[offset] += score
+			}
+		}
+		if q.Op == OpAnd {
+			for offset := range scores {
+				if _, ok := operandScores[offset]; !ok {
+					delete(scores, offset)
+				}
+			}
+		}
+	}
+	return scores, scores != nil
+}
+
+func (q *Logical) String() string {
+	parts := make([]string, 0, len(q.Operands))
+	for _, operand := range q.Operands {
+		parts = append(parts, operand.String())
+	}
+	return "(" + strings.Join(parts, " "+string(q.Op)+" ") + ")"
+}
+
+// Parse reads a query where words and "quoted phrases" must all match and
+// OR separates alternatives, as in: "full text" search OR index. AND may be
+// written explicitly and binds tighter than OR.
+func Parse(text string) (Query, error) {
+	alternatives := make([]Query, 0)
+	group := make([]Query, 0)
+	closeGroup := func() error {
+		if len(group) == 0 {
+			return NewInvalidQueryError(fmt.Sprintf("missing operand in %q", text))
+		}
+		if len(group) == 1 {
+			alternatives = append(alternatives, group[0])
+		} else {
+			alternatives = append(alternatives, And(group...))
+		}
+		group = make([]Query, 0)
+		return nil
+	}
+
+	runes := []rune(text)
+	for pos := 0; pos < len(runes); {
+		switch {
+		case unicode.IsSpace(runes[pos]):
+			pos++
+		case runes[pos] == '"':
+			end := pos + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, NewInvalidQueryError(fmt.Sprintf("unterminated phrase in %q", text))
+			}
+			group = append(group, Phrase(string(runes[pos+1:end])))
+			pos = end + 1
+		default:
+			end := pos
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[pos:end])
+			pos = end
+			switch word {
+			case "AND":
+			case "OR":
+				if err := closeGroup(); err != nil {
+					return nil, err
+				}
+			default:
+				group = append(group, Term(word))
+			}
+		}
+	}
+	if err := closeGroup(); err != nil {
+		return nil, err
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return Or(alternatives...), nil
+}
@@ -0,0 +1,82 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a term of a text with its position. Positions count every word,
+// including dropped stop words, so phrases keep their gaps.
+type Token struct {
+	Term     string
+	Position int
+}
+
+// Tokenizer splits a text into the terms that are indexed and searched.
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// EnglishStopWords are dropped by the standard tokenizer.
+var EnglishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+	"into", "is", "it", "no", "not", "of", "on", "or", "such", "that", "the",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will",
+	"with",
+}
+
+// WordTokenizer lowercases the text, splits it on every character that is
+// neither a letter nor a digit and drops stop words.
+type WordTokenizer struct {
+	stopWords map[string]struct{}
+}
+
+func NewWordTokenizer(stopWords ...string) *WordTokenizer {
+	t := &WordTokenizer{stopWords: make(map[string]struct{}, len(stopWords))}
+	for _, w := range stopWords {
+		t.stopWords[strings.ToLower(w)] = struct{}{}
+	}
+	return t
+}
+
+func (t *WordTokenizer) Tokenize(text string) []Token {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]Token, 0, len(words))
+	for pos, w := range words {
+		if _, ok := t.stopWords[w]; ok {
+			continue
+		}
+		tokens = append(tokens, Token{Term: w, Position: pos})
+	}
+	return tokens
+}
+
+const (
+	// StandardTokenizer splits words and drops English stop words.
+	StandardTokenizer = "standard"
+	// SimpleTokenizer splits words and keeps every one of them.
+	SimpleTokenizer = "simple"
+)
+
+var tokenizers = map[string]Tokenizer{
+	StandardTokenizer: NewWordTokenizer(EnglishStopWords...),
+	SimpleTokenizer:   NewWordTokenizer(),
+}
+
+// RegisterTokenizer makes t available to indexes under name. Index
+// definitions persist the name, so the tokenizer must be registered before
+// the tables using it are opened.
+func RegisterTokenizer(name string, t Tokenizer) {
+	tokenizers[name] = t
+}
+
+// LookupTokenizer returns the tokenizer registered under name.
+func LookupTokenizer(name string) (Tokenizer, error) {
+	t, ok := tokenizers[name]
+	if !ok {
+		return nil, NewUnknownTokenizerError(name)
+	}
+	return t, nil
+}
@@ -0,0 +1,53 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/fulltext"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchIDs(t *testing.T, tb *Table, query string) []int32 {
+	q, err := fulltext.Parse(query)
+	assert.Nil(t, err)
+	results, err := tb.Search("username", q, 0)
+	assert.Nil(t, err)
+	ids := make([]int32, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Record["id"].(int32))
+	}
+	return ids
+}
+
+func TestFullTextIndex(t *testing.T) {
+	tb := newTestTable(t)
+	_, err := tb.InsertMany([]map[string]interface{}{
+		{"id": int32(1), "username": "Quick brown fox", "age": int64(1)},
+		{"id": int32(2), "username": "lazy dog", "age": int64(2)},
+		{"id": int32(3), "username": "the fox and the dog", "age": int64(3)},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, tb.CreateFullTextIndex("age", fulltext.StandardTokenizer))
+	assert.Nil(t, tb.CreateFullTextIndex("username", fulltext.StandardTokenizer))
+
+	assert.ElementsMatch(t, []int32{1, 3}, searchIDs(t, tb, "FOX"))
+	assert.Equal(t, []int32{3}, searchIDs(t, tb, "fox dog"))
+	assert.Equal(t, []int32{1}, searchIDs(t, tb, `"brown fox" OR cat`))
+
+	// the index follows inserts, updates and deletes
+	_, err = tb.Insert(map[string]interface{}{"id": int32(4), "username": "red fox", "age": int64(4)})
+	assert.Nil(t, err)
+	_, err = tb.Update(predicate.Eq("id", int32(2)), map[string]interface{}{"username": "lazy fox"})
+	assert.Nil(t, err)
+	_, err = tb.Delete(predicate.Eq("id", int32(1)))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []int32{2, 3, 4}, searchIDs(t, tb, "fox"))
+	assert.Empty(t, searchIDs(t, tb, "brown"))
+
+	// definitions are persisted and entries rebuilt on load
+	tb.fullText = nil
+	assert.Nil(t, tb.LoadIndexes())
+	assert.Equal(t, fulltext.StandardTokenizer, tb.FullTextIndex("username").Tokenizer)
+	assert.Equal(t, []int32{2}, searchIDs(t, tb, "lazy"))
+}
@@ -0,0 +1,16 @@
+package index
+
+import "fmt"
+
+type UniqueViolationError struct {
+	column string
+	value  interface{}
+}
+
+func NewUniqueViolationError(column string, value interface{}) *UniqueViolationError {
+	return &UniqueViolationError{column: column, value: value}
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("duplicate value %v violates unique index on %s", e.value, e.column)
+}
@@ -0,0 +1,131 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+)
+
+// Index is a secondary hash index mapping the values of one column to the
+// file offsets of the records holding them. Only index definitions are
+// persisted; entries are rebuilt from the table when it is opened.
+type Index struct {
+	Column string
+	Unique bool
+	// Collation of the column, strings equal under it share an entry.
+	Collation collate.Collation
+	entries   map[string][]int64
+	size      int
+}
+
+func NewIndex(column string, unique bool, collation collate.Collation) *Index {
+	return &Index{
+		Column:    column,
+		Unique:    unique,
+		Collation: collation,
+		entries:   make(map[string][]int64),
+	}
+}
+
+// Add records that the record at offset holds value v.
+func (i *Index) Add(v interface{}, offset int64) error {
+	key, err := i.Key(v)
+	if err != nil {
+		return fmt.Errorf("Index.Add: %w", err)
+	}
+	if i.Unique && v != nil && len(i.entries[key]) > 0 {
+		return NewUniqueViolationError(i.Column, v)
+	}
+	i.entries[key] = append(i.entries[key], offset)
+	i.size++
+	return nil
+}
+
+// Conflicts reports whether adding v would violate a unique index.
+func (i *Index) Conflicts(v interface{}) (bool, error) {
+	if !i.Unique || v == nil {
+		return false, nil
+	}
+	offsets, err := i.Lookup(v)
+	if err != nil {
+		return false, fmt.Errorf("Index.Conflicts: %w", err)
+	}
+	return len(offsets) > 0, nil
+}
+
+func (i *Index) Remove(v interface{}, offset int64) error {
+	key, err := i.Key(v)
+	if err != nil {
+		return fmt.Errorf("Index.Remove: %w", err)
+	}
+	offsets := i.entries[key]
+	for n, o := range offsets {
+		if o != offset {
+			continue
+		}
+		offsets = append(offsets[:n], offsets[n+1:]...)
+		i.size--
+		break
+	}
+	if len(offsets) == 0 {
+		delete(i.entries, key)
+		return nil
+	}
+	i.entries[key] = offsets
+	return nil
+}
+
+// Lookup returns the offsets of every record holding v in file order.
+func (i *Index) Lookup(v interface{}) ([]int64, error) {
+	key, err := i.Key(v)
+	if err != nil {
+		return nil, fmt.Errorf("Index.Lookup: %w", err)
+	}
+	offsets := make([]int64, len(i.entries[key]))
+	copy(offsets, i.entries[key])
+	sort.Slice(offsets, func(a, b int) bool { return offsets[a] < offsets[b] })
+	return offsets, nil
+}
+
+// Len returns the number of indexed records.
+func (i *Index) Len() int {
+	return i.size
+}
+
+// Distinct returns the number of distinct indexed values.
+func (i *Index) Distinct() int {
+	return len(i.entries)
+}
+
+func (i *Index) Reset() {
+	i.entries = make(map[string][]int64)
+	i.size = 0
+}
+
+// Key returns the entry key of v under the collation of the index.
+func (i *Index) Key(v interface{}) (string, error) {
+	return Key(i.Collation.Value(v))
+}
+
+// Key encodes v so that values comparing equal share a key. Integers of
+// every width are widened to int64 first.
+func Key(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	switch n := v.(type) {
+	case byte:
+		v = int64(n)
+	case int32:
+		v = int64(n)
+	case uint32:
+		v = int64(n)
+	}
+	b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,270 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/table/index"
+)
+
+const IndexFilenameTmpl = "%s_idx.bin"
+
+// CreateIndex builds a secondary index on column and persists its definition
+// so it is rebuilt whenever the table is opened.
+func (t *Table) CreateIndex(column string, unique bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.columns[column]; !ok {
+		return fmt.Errorf("Table.CreateIndex: unknown column: %s", column)
+	}
+	if _, ok := t.indexes[column]; ok {
+		return fmt.Errorf("Table.CreateIndex: index on %s already exists", column)
+	}
+
+	idx := index.NewIndex(column, unique, t.columns[column].Collation())
+	if err := t.buildIndex(idx); err != nil {
+		return fmt.Errorf("Table.CreateIndex: %w", err)
+	}
+	t.indexes[column] = idx
+
+	if err := t.writeIndexDefinitions(); err != nil {
+		delete(t.indexes, column)
+		return fmt.Errorf("Table.CreateIndex: %w", err)
+	}
+	return nil
+}
+
+// Index returns the index on column or nil when the column is not indexed.
+func (t *Table) Index(column string) *index.Index {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.indexes[column]
+}
+
+// Indexes returns every index of the table ordered by column name.
+func (t *Table) Indexes() []*index.Index {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sortedIndexes()
+}
+
+func (t *Table) sortedIndexes() []*index.Index {
+	indexes := make([]*index.Index, 0, len(t.indexes))
+	for _, idx := range t.indexes {
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Column < indexes[j].Column
+	})
+	return indexes
+}
+
+// LoadIndexes reads the persisted index definitions and rebuilds every index,
+// full-text ones included, from the table file.
+func (t *Table) LoadIndexes() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.loadFullTextIndexes(); err != nil {
+		return fmt.Errorf("Table.LoadIndexes: %w", err)
+	}
+	data, err := t.fs.ReadFile(t.indexPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Table.LoadIndexes: %w", err)
+	}
+
+	r := parserio.NewReader(bytes.NewReader(data))
+	tlvParser := parser.NewTLVParser(r)
+	for {
+		col, err := tlvParser.Parse()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("Table.LoadIndexes: %w", err)
+		}
+		unique, err := tlvParser.Parse()
+		if err != nil {
+			return fmt.Errorf("Table.LoadIndexes: %w", err)
+		}
+
+		name, ok := col.(string)
+		if !ok {
+			return fmt.Errorf("Table.LoadIndexes: invalid index definition: column is %T, not a string", col)
+		}
+		isUnique, ok := unique.(bool)
+		if !ok {
+			return fmt.Errorf("Table.LoadIndexes: invalid index definition: unique is %T, not a bool", unique)
+		}
+		c, ok := t.columns[name]
+		if !ok {
+			return fmt.Errorf("Table.LoadIndexes: unknown column: %s", name)
+		}
+		idx := index.NewIndex(c.NameToStr(), isUnique, c.Collation())
+		if err := t.buildIndex(idx); err != nil {
+			return fmt.Errorf("Table.LoadIndexes: %w", err)
+		}
+		t.indexes[idx.Column] = idx
+	}
+}
+
+// LookupIndex returns the records whose indexed column equals v.
+func (t *Table) LookupIndex(column string, v interface{}) ([]map[string]interface{}, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	idx, ok := t.indexes[column]
+	if !ok {
+		return nil, fmt.Errorf("Table.LookupIndex: no index on column: %s", column)
+	}
+	offsets, err := idx.Lookup(v)
+	if err != nil {
+		return nil, fmt.Errorf("Table.LookupIndex: %w", err)
+	}
+	results := make([]map[string]interface{}, 0, len(offsets))
+	for _, offset := range offsets {
+		rawRecord, err := t.readRecordAt(offset)
+		if err != nil {
+			return nil, fmt.Errorf("Table.LookupIndex: %w", err)
+		}
+		results = append(results, rawRecord.Values)
+	}
+	return results, nil
+}
+
+func (t *Table) readRecordAt(offset int64) (*parser.RawRecord, error) {
+	records, file := t.newCursor()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Table.readRecordAt: %w", err)
+	}
+	if err := records.Parse(); err != nil {
+		return nil, fmt.Errorf("Table.readRecordAt: %w", err)
+	}
+	return records.Value, nil
+}
+
+func (t *Table) buildIndex(idx *index.Index) error {
+	idx.Reset()
+	err := t.scan(nil, func(offset int64, record *parser.RawRecord) (bool, error) {
+		return true, idx.Add(record.Values[idx.Column], offset)
+	})
+	if err != nil {
+		return fmt.Errorf("Table.buildIndex: %w", err)
+	}
+	return nil
+}
+
+func (t *Table) writeIndexDefinitions() error {
+	buf := bytes.Buffer{}
+	for _, idx := range t.sortedIndexes() {
+		col, err := encoding.NewTLVMarshaler(idx.Column).MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("Table.writeIndexDefinitions: %w", err)
+		}
+		buf.Write(col)
+		unique, err := encoding.NewTLVMarshaler(idx.Unique).MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("Table.writeIndexDefinitions: %w", err)
+		}
+		buf.Write(unique)
+	}
+	if err := t.fs.WriteFile(t.indexPath(), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Table.writeIndexDefinitions: %w", err)
+	}
+	return nil
+}
+
+func (t *Table) indexPath() string {
+	return filepath.Join(filepath.Dir(t.file.Name()), fmt.Sprintf(IndexFilenameTmpl, t.Name))
+}
+
+func (t *Table) checkUniqueIndexes(record map[string]interface{}) error {
+	for _, idx := range t.indexes {
+		conflict, err := idx.Conflicts(record[idx.Column])
+		if err != nil {
+			return fmt.Errorf("Table.checkUniqueIndexes: %w", err)
+		}
+		if conflict {
+			return index.NewUniqueViolationError(idx.Column, record[idx.Column])
+		}
+	}
+	return nil
+}
+
+// checkUniqueUpdate verifies that replacing the old records with the updated
+// ones keeps every unique index valid.
+func (t *Table) checkUniqueUpdate(old []*DeletableRecord, updated []map[string]interface{}) error {
+	for _, idx := range t.indexes {
+		if !idx.Unique {
+			continue
+		}
+		replaced := make(map[string]int)
+		for _, rec := range old {
+			key, err := idx.Key(rec.values[idx.Column])
+			if err != nil {
+				return fmt.Errorf("Table.checkUniqueUpdate: %w", err)
+			}
+			replaced[key]++
+		}
+		seen := make(map[string]struct{})
+		for _, record := range updated {
+			v := record[idx.Column]
+			if v == nil {
+				continue
+			}
+			key, err := idx.Key(v)
+			if err != nil {
+				return fmt.Errorf("Table.checkUniqueUpdate: %w", err)
+			}
+			if _, ok := seen[key]; ok {
+				return index.NewUniqueViolationError(idx.Column, v)
+			}
+			seen[key] = struct{}{}
+			offsets, err := idx.Lookup(v)
+			if err != nil {
+				return fmt.Errorf("Table.checkUniqueUpdate: %w", err)
+			}
+			if len(offsets) > replaced[key] {
+				return index.NewUniqueViolationError(idx.Column, v)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Table) addToIndexes(record map[string]interface{}, offset int64) error {
+	for _, idx := range t.indexes {
+		if err := idx.Add(record[idx.Column], offset); err != nil {
+			return fmt.Errorf("Table.addToIndexes: %w", err)
+		}
+	}
+	for _, idx := range t.fullText {
+		if err := idx.Add(record[idx.Column], offset); err != nil {
+			return fmt.Errorf("Table.addToIndexes: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *Table) removeFromIndexes(record map[string]interface{}, offset int64) error {
+	for _, idx := range t.indexes {
+		if err := idx.Remove(record[idx.Column], offset); err != nil {
+			return fmt.Errorf("Table.removeFromIndexes: %w", err)
+		}
+	}
+	for _, idx := range t.fullText {
+		if err := idx.Remove(record[idx.Column], offset); err != nil {
+			return fmt.Errorf("Table.removeFromIndexes: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package table
+
+import (
+	"os"
+	"testing"
+
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsert_UniqueViolationIsNotRestored(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	_, err := tb.Insert(map[string]interface{}{"id": int32(1), "username": "dup", "age": int64(1)})
+	var violation *index.UniqueViolationError
+	assert.ErrorAs(t, err, &violation)
+
+	// the rejected record was never logged
+	assert.Nil(t, tb.RestoreWAL())
+	assert.Equal(t, []int32{1, 2, 3, 4, 5}, selectIDs(t, tb, nil))
+}
+
+func TestLoadIndexes_InvalidDefinitions(t *testing.T) {
+	tb := newTestTable(t)
+	for _, def := range [][]interface{}{
+		{int32(1), true},
+		{"id", "true"},
+	} {
+		data := make([]byte, 0)
+		for _, v := range def {
+			b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+			assert.Nil(t, err)
+			data = append(data, b...)
+		}
+		assert.Nil(t, os.WriteFile(tb.indexPath(), data, 0644))
+		assert.NotNil(t, tb.LoadIndexes())
+	}
+}
@@ -0,0 +1,173 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/9bany/db/internal/table/index"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// InsertMany inserts records as one batch: every record is validated before
+// anything is written, the batch is logged as a single WAL entry, pages are
+// filled sequentially with one write and the batch is committed once.
+// Either every record is inserted or none is.
+func (t *Table) InsertMany(records []map[string]interface{}) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	encoded := make([][]byte, 0, len(records))
+	for i, record := range records {
+		if err := t.validateColumns(record); err != nil {
+			return 0, fmt.Errorf("Table.InsertMany: record %d: %w", i, err)
+		}
+		buf, err := t.encodeRecord(record)
+		if err != nil {
+			return 0, fmt.Errorf("Table.InsertMany: record %d: %w", i, err)
+		}
+		encoded = append(encoded, buf.Bytes())
+	}
+	if err := t.checkUniqueBatch(records); err != nil {
+		return 0, fmt.Errorf("Table.InsertMany: %w", err)
+	}
+
+	data, err := t.encodeInsertBatch(encoded)
+	if err != nil {
+		return 0, fmt.Errorf("Table.InsertMany: %w", err)
+	}
+	entry, err := t.appendLog(walencoding.OpInsertBatch, data)
+	if err != nil {
+		return 0, fmt.Errorf("Table.InsertMany: %w", err)
+	}
+
+	if err := t.writeBatch(encoded, records); err != nil {
+		return 0, fmt.Errorf("Table.InsertMany: %w", t.abort(entry, walencoding.OpInsertBatch, data, err))
+	}
+
+	if err := t.commit(entry); err != nil {
+		return 0, fmt.Errorf("Table.InsertMany: %w", err)
+	}
+	return len(records), nil
+}
+
+// writeBatch stores encoded records in pages and indexes them.
+func (t *Table) writeBatch(encoded [][]byte, records []map[string]interface{}) error {
+	offsets, err := t.writePages(encoded)
+	if err != nil {
+		return fmt.Errorf("Table.writeBatch: %w", err)
+	}
+	for i, record := range records {
+		if err := t.addToIndexes(record, offsets[i]); err != nil {
+			return fmt.Errorf("Table.writeBatch: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeInsertBatch returns the data of the OpInsertBatch entry appending
+// the encoded records at the end of the table file.
+func (t *Table) encodeInsertBatch(encoded [][]byte) ([]byte, error) {
+	base, err := t.appendBase()
+	if err != nil {
+		return nil, fmt.Errorf("Table.encodeInsertBatch: %w", err)
+	}
+	return t.encodeInsertBatchAt(base, encoded)
+}
+
+// encodeInsertBatchAt returns the data of the OpInsertBatch entry appending
+// the encoded records to the table file once it reaches base.
+func (t *Table) encodeInsertBatchAt(base int64, encoded [][]byte) ([]byte, error) {
+	data := bytes.Buffer{}
+	if err := writeLogHeader(&data, base, len(encoded)); err != nil {
+		return nil, fmt.Errorf("Table.encodeInsertBatch: %w", err)
+	}
+	for _, b := range encoded {
+		data.Write(b)
+	}
+	return data.Bytes(), nil
+}
+
+// writeLogHeader writes the size of the table file the records are appended
+// at and the number of records that start the data of an entry appending
+// records. Redo lays the records out again from that size, see place, so
+// records appended before a crash are not duplicated.
+func writeLogHeader(data *bytes.Buffer, base int64, count int) error {
+	for _, v := range []int64{base, int64(count)} {
+		b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("Table.writeLogHeader: %w", err)
+		}
+		data.Write(b)
+	}
+	return nil
+}
+
+// checkUniqueBatch checks the records against unique indexes and against
+// each other.
+func (t *Table) checkUniqueBatch(records []map[string]interface{}) error {
+	for _, idx := range t.indexes {
+		if !idx.Unique {
+			continue
+		}
+		seen := make(map[string]struct{})
+		for _, record := range records {
+			v := record[idx.Column]
+			if v == nil {
+				continue
+			}
+			key, err := idx.Key(v)
+			if err != nil {
+				return fmt.Errorf("Table.checkUniqueBatch: %w", err)
+			}
+			if _, ok := seen[key]; ok {
+				return index.NewUniqueViolationError(idx.Column, v)
+			}
+			seen[key] = struct{}{}
+		}
+	}
+	for _, record := range records {
+		if err := t.checkUniqueIndexes(record); err != nil {
+			return fmt.Errorf("Table.checkUniqueBatch: %w", err)
+		}
+	}
+	return nil
+}
+
+// writePages appends encoded records to the last page while they fit and to
+// new pages afterwards, as laid out by place. The whole batch is written
+// with a single write and the header of the last page is updated once. It
+// returns the offset of every record.
+func (t *Table) writePages(encoded [][]byte) ([]int64, error) {
+	end, err := t.appendBase()
+	if err != nil {
+		return nil, fmt.Errorf("Table.writePages: %w", err)
+	}
+	p, err := t.place(end, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Table.writePages: %w", err)
+	}
+
+	buf := bytes.Buffer{}
+	for _, fill := range p.fills {
+		if fill.fresh {
+			buf.Write(pageHeader(fill.used))
+		}
+		buf.Write(fill.data)
+	}
+	if err := t.writeAt(end, buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("Table.writePages: %w", err)
+	}
+	for _, fill := range p.fills {
+		if err := t.updatePage(fill); err != nil {
+			return nil, fmt.Errorf("Table.writePages: %w", err)
+		}
+	}
+	for _, offset := range p.offsets {
+		t.recordCreated(offset)
+	}
+	return p.offsets, nil
+}
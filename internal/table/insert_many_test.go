@@ -0,0 +1,85 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUsers(from, to int) []map[string]interface{} {
+	records := make([]map[string]interface{}, 0, to-from)
+	for i := from; i < to; i++ {
+		records = append(records, map[string]interface{}{
+			"id": int32(i), "username": fmt.Sprintf("user%d", i), "age": int64(i % 50),
+		})
+	}
+	return records
+}
+
+func TestInsertMany(t *testing.T) {
+	tb := newTestTable(t)
+	_, err := tb.Insert(testUsers(0, 1)[0])
+	assert.Nil(t, err)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	n, err := tb.InsertMany(testUsers(1, 200))
+	assert.Nil(t, err)
+	assert.Equal(t, 199, n)
+	// single inserts keep working on pages written by a batch
+	_, err = tb.Insert(testUsers(200, 201)[0])
+	assert.Nil(t, err)
+
+	rows, err := tb.Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, testUsers(0, 201), rows)
+	rows, err = tb.LookupIndex("id", int32(150))
+	assert.Nil(t, err)
+	assert.Equal(t, testUsers(150, 151), rows)
+
+	node, err := tb.Explain(Query{}, true)
+	assert.Nil(t, err)
+	// every page is filled before the next one is started
+	assert.LessOrEqual(t, node.PagesRead, int64(201/3+1))
+}
+
+func TestInsertMany_AllOrNothing(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	_, err := tb.InsertMany(append(testUsers(10, 20), testUsers(15, 16)...))
+	var violation *index.UniqueViolationError
+	assert.True(t, errors.As(err, &violation))
+	_, err = tb.InsertMany(append(testUsers(10, 20), map[string]interface{}{"id": int32(30)}))
+	assert.NotNil(t, err)
+
+	rows, err := tb.Select(predicate.Ge("id", int32(10)))
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestInsertMany_RestoresFromWAL(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	// log a batch that never reached the table file
+	encoded := make([][]byte, 0)
+	for _, record := range testUsers(10, 12) {
+		buf, err := tb.encodeRecord(record)
+		assert.Nil(t, err)
+		encoded = append(encoded, buf.Bytes())
+	}
+	data, err := tb.encodeInsertBatch(encoded)
+	assert.Nil(t, err)
+	_, err = tb.wal.AppendLog("insert_batch", tb.Name, data)
+	assert.Nil(t, err)
+
+	assert.Nil(t, tb.RestoreWAL())
+	rows, err := tb.Select(predicate.Ge("id", int32(10)))
+	assert.Nil(t, err)
+	assert.Equal(t, testUsers(10, 12), rows)
+}
@@ -0,0 +1,72 @@
+package join
+
+import (
+	"fmt"
+
+	"github.com/9bany/db/internal/table/plan"
+)
+
+// queryPlan keeps the nodes of a join plan that run fills while executing.
+type queryPlan struct {
+	root   *plan.Node
+	from   *plan.Node
+	joins  []*plan.Node
+	filter *plan.Node
+}
+
+// Explain returns the physical plan of q: a left deep tree of joins over
+// table scans. With analyze the query is executed and every node reports its
+// actual rows, pages read and time.
+func Explain(q Query, analyze bool) (*plan.Node, error) {
+	q, err := Validate(q)
+	if err != nil {
+		return nil, fmt.Errorf("join.Explain: %w", err)
+	}
+
+	q = Optimize(q)
+	p := buildPlan(q)
+	if !analyze {
+		return p.root, nil
+	}
+	if _, err := run(q, p); err != nil {
+		return nil, fmt.Errorf("join.Explain: %w", err)
+	}
+	return p.root, nil
+}
+
+func buildPlan(q Query) *queryPlan {
+	tables := tablesOf(q)
+	p := &queryPlan{from: q.From.PlanScan(nil)}
+	p.root = p.from
+	for _, clause := range q.Joins {
+		strategy := ChooseStrategy(clause)
+		right := clause.Table.PlanScan(nil)
+		if strategy == IndexNestedLoop {
+			right.Operator = plan.OpIndexScan
+			right.Index = clause.RightColumn
+			right.Details = []string{fmt.Sprintf("Index Cond: %s = %s", clause.RightColumn, clause.LeftColumn)}
+		}
+
+		node := plan.NewNode(plan.OpJoin, p.root, right)
+		node.Details = []string{"Strategy: " + string(strategy), "Type: " + string(clause.Type)}
+		if clause.Type != Cross {
+			node.Details = append(node.Details, fmt.Sprintf(
+				"Condition: %s = %s", clause.LeftColumn, Qualify(clause.Table.Name, clause.RightColumn),
+			))
+		}
+		node.EstimatedRows = estimateJoin(tables, clause, p.root.EstimatedRows)
+		if strategy == IndexNestedLoop && p.root.EstimatedRows > 0 {
+			// the index is probed once per left row
+			right.EstimatedRows = node.EstimatedRows / p.root.EstimatedRows
+		}
+		p.joins = append(p.joins, node)
+		p.root = node
+	}
+	if q.Where != nil {
+		p.filter = plan.NewNode(plan.OpFilter, p.root)
+		p.filter.Filter = q.Where.String()
+		p.filter.EstimatedRows = p.root.EstimatedRows * plan.Selectivity(q.Where, joinStatistics{tables: tables})
+		p.root = p.filter
+	}
+	return p
+}
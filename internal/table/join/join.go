@@ -0,0 +1,360 @@
+package join
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+type Type string
+
+const (
+	Inner Type = "INNER"
+	Left  Type = "LEFT"
+	Cross Type = "CROSS"
+)
+
+type Strategy string
+
+const (
+	// Auto picks an index nested loop when the joined column is indexed
+	// and a hash join otherwise.
+	Auto            Strategy = ""
+	NestedLoop      Strategy = "NESTED LOOP"
+	HashJoin        Strategy = "HASH JOIN"
+	IndexNestedLoop Strategy = "INDEX NESTED LOOP"
+)
+
+type Row = map[string]interface{}
+
+// Clause joins Table to the rows produced so far. LeftColumn is a qualified
+// "table.column" name already present in those rows and RightColumn is a
+// column of Table. Both are ignored for cross joins. Keys are compared under
+// the collation of RightColumn, the one of its index, whatever the strategy.
+type Clause struct {
+	Table       *table.Table
+	Type        Type
+	LeftColumn  string
+	RightColumn string
+	Strategy    Strategy
+}
+
+// Query joins From with every clause from left to right. Rows are keyed by
+// qualified "table.column" names and Where is evaluated against them.
+type Query struct {
+	From  *table.Table
+	Joins []Clause
+	Where predicate.Predicate
+}
+
+func Qualify(tableName, column string) string {
+	return tableName + "." + column
+}
+
+// Run executes q and returns the joined rows.
+func Run(q Query) ([]Row, error) {
+	q, err := Validate(q)
+	if err != nil {
+		return nil, fmt.Errorf("join.Run: %w", err)
+	}
+	results, err := run(Optimize(q), nil)
+	if err != nil {
+		return nil, fmt.Errorf("join.Run: %w", err)
+	}
+	return results, nil
+}
+
+// run executes q. When p is not nil every operator records its actual rows,
+// pages read and time into the matching plan node.
+func run(q Query, p *queryPlan) ([]Row, error) {
+	if p == nil {
+		p = &queryPlan{}
+	}
+	start := time.Now()
+	rows, err := scanQualified(q.From, p.from)
+	if err != nil {
+		return nil, fmt.Errorf("join.run: %w", err)
+	}
+	for i, clause := range q.Joins {
+		var joinNode, rightNode *plan.Node
+		if p.joins != nil {
+			joinNode, rightNode = p.joins[i], p.joins[i].Children[1]
+		}
+		rows, err = joinClause(rows, clause, rightNode)
+		if err != nil {
+			return nil, fmt.Errorf("join.run: %w", err)
+		}
+		joinNode.Finish(int64(len(rows)), start)
+	}
+
+	results := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		ok, err := predicate.Evaluate(q.Where, row)
+		if err != nil {
+			return nil, fmt.Errorf("join.run: %w", err)
+		}
+		if ok {
+			results = append(results, row)
+		}
+	}
+	p.filter.Finish(int64(len(results)), start)
+	return results, nil
+}
+
+// Validate checks that every referenced table and column exists and that
+// join strategies can be honored. It returns the copy of q to run, whose
+// Where is bound to the collations of the columns.
+func Validate(q Query) (Query, error) {
+	if q.From == nil {
+		return Query{}, fmt.Errorf("join.Validate: missing from table")
+	}
+	columns := QualifiedColumns(q.From)
+	for _, clause := range q.Joins {
+		if clause.Table == nil {
+			return Query{}, fmt.Errorf("join.Validate: missing table in join")
+		}
+		right := QualifiedColumns(clause.Table)
+		for name := range right {
+			if _, ok := columns[name]; ok {
+				return Query{}, fmt.Errorf("join.Validate: table %s is joined more than once", clause.Table.Name)
+			}
+		}
+
+		switch clause.Type {
+		case Inner, Left:
+			leftCol, ok := columns[clause.LeftColumn]
+			if !ok {
+				return Query{}, fmt.Errorf("join.Validate: unknown column: %s", clause.LeftColumn)
+			}
+			rightName := Qualify(clause.Table.Name, clause.RightColumn)
+			rightCol, ok := right[rightName]
+			if !ok {
+				return Query{}, fmt.Errorf("join.Validate: unknown column: %s", rightName)
+			}
+			if !joinable(leftCol.DataType(), rightCol.DataType()) {
+				return Query{}, fmt.Errorf("join.Validate: cannot join %s of type %d with %s of type %d", clause.LeftColumn, leftCol.DataType(), rightName, rightCol.DataType())
+			}
+		case Cross:
+			if clause.Strategy != Auto && clause.Strategy != NestedLoop {
+				return Query{}, fmt.Errorf("join.Validate: cross join only supports nested loops")
+			}
+		default:
+			return Query{}, fmt.Errorf("join.Validate: unknown join type: %s", clause.Type)
+		}
+		if clause.Strategy == IndexNestedLoop && clause.Table.Index(clause.RightColumn) == nil {
+			return Query{}, fmt.Errorf("join.Validate: no index on %s", Qualify(clause.Table.Name, clause.RightColumn))
+		}
+
+		for name, col := range right {
+			columns[name] = col
+		}
+	}
+	if err := predicate.Validate(q.Where, columns); err != nil {
+		return Query{}, err
+	}
+	q.Where = predicate.Resolve(q.Where, columns)
+	return q, nil
+}
+
+// joinable reports whether columns of types a and b can be joined: equal
+// values must share a join key, which only integers of different widths do
+// across types.
+func joinable(a, b byte) bool {
+	return a == b || isInteger(a) && isInteger(b)
+}
+
+func isInteger(dataType byte) bool {
+	switch dataType {
+	case types.TypeByte, types.TypeInt32, types.TypeInt64:
+		return true
+	}
+	return false
+}
+
+// QualifiedColumns returns the columns of t keyed by their qualified name.
+func QualifiedColumns(t *table.Table) map[string]*column.Column {
+	columns := make(map[string]*column.Column)
+	for name, col := range t.Columns() {
+		columns[Qualify(t.Name, name)] = col
+	}
+	return columns
+}
+
+// ChooseStrategy resolves Auto to the strategy that will actually run.
+func ChooseStrategy(clause Clause) Strategy {
+	if clause.Strategy != Auto {
+		return clause.Strategy
+	}
+	if clause.Type == Cross {
+		return NestedLoop
+	}
+	if clause.Table.Index(clause.RightColumn) != nil {
+		return IndexNestedLoop
+	}
+	return HashJoin
+}
+
+func joinClause(left []Row, clause Clause, rightNode *plan.Node) ([]Row, error) {
+	switch ChooseStrategy(clause) {
+	case NestedLoop:
+		return nestedLoop(left, clause, rightNode)
+	case HashJoin:
+		return hashJoin(left, clause, rightNode)
+	case IndexNestedLoop:
+		return indexNestedLoop(left, clause, rightNode)
+	}
+	return nil, fmt.Errorf("join.joinClause: unknown strategy: %s", clause.Strategy)
+}
+
+func nestedLoop(left []Row, clause Clause, rightNode *plan.Node) ([]Row, error) {
+	right, err := scanQualified(clause.Table, rightNode)
+	if err != nil {
+		return nil, fmt.Errorf("join.nestedLoop: %w", err)
+	}
+	rightColumn := Qualify(clause.Table.Name, clause.RightColumn)
+
+	results := make([]Row, 0)
+	for _, l := range left {
+		matched := false
+		for _, r := range right {
+			if clause.Type != Cross {
+				lk, err := joinKey(clause, l[clause.LeftColumn])
+				if err != nil {
+					return nil, fmt.Errorf("join.nestedLoop: %w", err)
+				}
+				rk, err := joinKey(clause, r[rightColumn])
+				if err != nil {
+					return nil, fmt.Errorf("join.nestedLoop: %w", err)
+				}
+				if l[clause.LeftColumn] == nil || lk != rk {
+					continue
+				}
+			}
+			matched = true
+			results = append(results, merge(l, r))
+		}
+		if !matched && clause.Type == Left {
+			results = append(results, merge(l, nullRow(clause.Table)))
+		}
+	}
+	return results, nil
+}
+
+func hashJoin(left []Row, clause Clause, rightNode *plan.Node) ([]Row, error) {
+	right, err := scanQualified(clause.Table, rightNode)
+	if err != nil {
+		return nil, fmt.Errorf("join.hashJoin: %w", err)
+	}
+	rightColumn := Qualify(clause.Table.Name, clause.RightColumn)
+
+	// build on the right side, probe with the left side to keep left order
+	buckets := make(map[string][]Row)
+	for _, r := range right {
+		if r[rightColumn] == nil {
+			continue
+		}
+		key, err := joinKey(clause, r[rightColumn])
+		if err != nil {
+			return nil, fmt.Errorf("join.hashJoin: %w", err)
+		}
+		buckets[key] = append(buckets[key], r)
+	}
+
+	results := make([]Row, 0)
+	for _, l := range left {
+		var matches []Row
+		if l[clause.LeftColumn] != nil {
+			key, err := joinKey(clause, l[clause.LeftColumn])
+			if err != nil {
+				return nil, fmt.Errorf("join.hashJoin: %w", err)
+			}
+			matches = buckets[key]
+		}
+		for _, r := range matches {
+			results = append(results, merge(l, r))
+		}
+		if len(matches) == 0 && clause.Type == Left {
+			results = append(results, merge(l, nullRow(clause.Table)))
+		}
+	}
+	return results, nil
+}
+
+func indexNestedLoop(left []Row, clause Clause, rightNode *plan.Node) ([]Row, error) {
+	results := make([]Row, 0)
+	for _, l := range left {
+		var matches []map[string]interface{}
+		if v := l[clause.LeftColumn]; v != nil {
+			var err error
+			start := time.Now()
+			matches, err = clause.Table.LookupIndex(clause.RightColumn, v)
+			if err != nil {
+				return nil, fmt.Errorf("join.indexNestedLoop: %w", err)
+			}
+			if rightNode != nil {
+				rightNode.Analyzed = true
+				rightNode.ActualRows += int64(len(matches))
+				rightNode.PagesRead += int64(len(matches))
+				rightNode.Duration += time.Since(start)
+			}
+		}
+		for _, r := range matches {
+			results = append(results, merge(l, qualify(clause.Table.Name, r)))
+		}
+		if len(matches) == 0 && clause.Type == Left {
+			results = append(results, merge(l, nullRow(clause.Table)))
+		}
+	}
+	return results, nil
+}
+
+// joinKey returns the key v is matched by in clause, the one an index of
+// the right column stores it under.
+func joinKey(clause Clause, v interface{}) (string, error) {
+	return index.Key(clause.Table.Columns()[clause.RightColumn].Collation().Value(v))
+}
+
+func scanQualified(t *table.Table, node *plan.Node) ([]Row, error) {
+	records, err := t.SelectAnalyzed(nil, node)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]Row, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, qualify(t.Name, record))
+	}
+	return rows, nil
+}
+
+func qualify(tableName string, record map[string]interface{}) Row {
+	row := make(Row, len(record))
+	for col, v := range record {
+		row[Qualify(tableName, col)] = v
+	}
+	return row
+}
+
+func nullRow(t *table.Table) Row {
+	row := make(Row)
+	for _, col := range t.ColumnNames() {
+		row[Qualify(t.Name, col)] = nil
+	}
+	return row
+}
+
+func merge(left, right Row) Row {
+	row := make(Row, len(left)+len(right))
+	for k, v := range left {
+		row[k] = v
+	}
+	for k, v := range right {
+		row[k] = v
+	}
+	return row
+}
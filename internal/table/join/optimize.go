@@ -0,0 +1,143 @@
+package join
+
+import (
+	"math"
+	"strings"
+
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/plan"
+)
+
+// Optimize reorders every run of consecutive inner joins so the smallest
+// intermediate results are produced first. A clause only runs once the table
+// of its LeftColumn has been joined. Left and cross joins keep their place.
+// q must be valid.
+func Optimize(q Query) Query {
+	tables := tablesOf(q)
+	joined := map[string]bool{q.From.Name: true}
+	rows := q.From.EstimateRows()
+
+	optimized := make([]Clause, 0, len(q.Joins))
+	for i := 0; i < len(q.Joins); {
+		if q.Joins[i].Type != Inner {
+			clause := q.Joins[i]
+			rows = estimateJoin(tables, clause, rows)
+			joined[clause.Table.Name] = true
+			optimized = append(optimized, clause)
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(q.Joins) && q.Joins[end].Type == Inner {
+			end++
+		}
+		pending := append([]Clause{}, q.Joins[i:end]...)
+		for len(pending) > 0 {
+			best, bestRows := -1, math.Inf(1)
+			for k, clause := range pending {
+				if !joined[tableOf(clause.LeftColumn)] {
+					continue
+				}
+				if r := estimateJoin(tables, clause, rows); best == -1 || r < bestRows {
+					best, bestRows = k, r
+				}
+			}
+			clause := pending[best]
+			rows = bestRows
+			joined[clause.Table.Name] = true
+			optimized = append(optimized, clause)
+			pending = append(pending[:best], pending[best+1:]...)
+		}
+		i = end
+	}
+	q.Joins = optimized
+	return q
+}
+
+// estimateJoin estimates the rows produced by joining clause to left rows.
+// Equi joins are assumed to match every value of the side with fewer
+// distinct values.
+func estimateJoin(tables map[string]*table.Table, clause Clause, left float64) float64 {
+	right := clause.Table.EstimateRows()
+	if clause.Type == Cross {
+		return left * right
+	}
+
+	var rows float64
+	distinct := math.Max(
+		distinctOf(tables, clause.LeftColumn),
+		clause.Table.EstimateDistinct(clause.RightColumn),
+	)
+	if distinct > 0 {
+		rows = left * right / distinct
+	} else {
+		rows = math.Min(left, right)
+	}
+	if clause.Type == Left {
+		return math.Max(rows, left)
+	}
+	return rows
+}
+
+func distinctOf(tables map[string]*table.Table, qualified string) float64 {
+	t, ok := tables[tableOf(qualified)]
+	if !ok {
+		return 0
+	}
+	return t.EstimateDistinct(strings.TrimPrefix(qualified, t.Name+"."))
+}
+
+func tablesOf(q Query) map[string]*table.Table {
+	tables := map[string]*table.Table{q.From.Name: q.From}
+	for _, clause := range q.Joins {
+		tables[clause.Table.Name] = clause.Table
+	}
+	return tables
+}
+
+// tableOf returns the table part of a qualified column name.
+func tableOf(qualified string) string {
+	if i := strings.LastIndex(qualified, "."); i >= 0 {
+		return qualified[:i]
+	}
+	return ""
+}
+
+// joinStatistics resolves qualified columns of joined rows to the
+// statistics of their table.
+type joinStatistics struct {
+	tables map[string]*table.Table
+}
+
+func (s joinStatistics) resolve(qualified string) (plan.Statistics, string, bool) {
+	t, ok := s.tables[tableOf(qualified)]
+	if !ok {
+		return nil, "", false
+	}
+	return t.PlanStatistics(), strings.TrimPrefix(qualified, t.Name+"."), true
+}
+
+func (s joinStatistics) EqualSelectivity(column string, v interface{}) (float64, bool) {
+	stats, col, ok := s.resolve(column)
+	if !ok {
+		return 0, false
+	}
+	return stats.EqualSelectivity(col, v)
+}
+
+func (s joinStatistics) RangeSelectivity(column string, lo, hi interface{}, loInclusive, hiInclusive bool) (float64, bool) {
+	stats, col, ok := s.resolve(column)
+	if !ok {
+		return 0, false
+	}
+	return stats.RangeSelectivity(col, lo, hi, loInclusive, hiInclusive)
+}
+
+func (s joinStatistics) NullFraction(column string) (float64, bool) {
+	stats, col, ok := s.resolve(column)
+	if !ok {
+		return 0, false
+	}
+	return stats.NullFraction(col)
+}
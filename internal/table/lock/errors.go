@@ -0,0 +1,50 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DeadlockError aborts the lock request of the victim of a deadlock. The
+// victim should roll back and retry.
+type DeadlockError struct {
+	owner    int64
+	resource Resource
+}
+
+func NewDeadlockError(owner int64, resource Resource) *DeadlockError {
+	return &DeadlockError{owner: owner, resource: resource}
+}
+
+func (e *DeadlockError) Error() string {
+	return fmt.Sprintf("deadlock detected: owner %d aborted waiting for %s", e.owner, e.resource)
+}
+
+func (e *DeadlockError) Retryable() bool {
+	return true
+}
+
+type LockTimeoutError struct {
+	owner    int64
+	resource Resource
+	mode     Mode
+}
+
+func NewLockTimeoutError(owner int64, resource Resource, mode Mode) *LockTimeoutError {
+	return &LockTimeoutError{owner: owner, resource: resource, mode: mode}
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("owner %d timed out waiting for lock %s on %s", e.owner, e.mode, e.resource)
+}
+
+func (e *LockTimeoutError) Retryable() bool {
+	return true
+}
+
+// IsRetryable reports whether err, or an error it wraps, says the
+// operation may succeed when retried.
+func IsRetryable(err error) bool {
+	var retryable interface{ Retryable() bool }
+	return errors.As(err, &retryable) && retryable.Retryable()
+}
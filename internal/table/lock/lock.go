@@ -0,0 +1,398 @@
+package lock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Mode is the mode a resource is locked in. Intention modes are taken on a
+// table before locking some of its rows in the matching mode.
+type Mode int
+
+const (
+	IntentionShared Mode = iota
+	IntentionExclusive
+	Shared
+	SharedIntentionExclusive
+	Exclusive
+)
+
+func (m Mode) String() string {
+	switch m {
+	case IntentionShared:
+		return "IS"
+	case IntentionExclusive:
+		return "IX"
+	case Shared:
+		return "S"
+	case SharedIntentionExclusive:
+		return "SIX"
+	case Exclusive:
+		return "X"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// compatible[held][requested]
+var compatible = [5][5]bool{
+	IntentionShared:          {true, true, true, true, false},
+	IntentionExclusive:       {true, true, false, false, false},
+	Shared:                   {true, false, true, false, false},
+	SharedIntentionExclusive: {true, false, false, false, false},
+	Exclusive:                {false, false, false, false, false},
+}
+
+// Compatible reports whether a owner may lock a resource in requested
+// while another holds it in held.
+func Compatible(held, requested Mode) bool {
+	return compatible[held][requested]
+}
+
+// covers reports whether holding held grants everything requested does.
+func covers(held, requested Mode) bool {
+	return supremum(held, requested) == held
+}
+
+// supremum returns the weakest mode granting both a and b.
+func supremum(a, b Mode) Mode {
+	if a == b {
+		return a
+	}
+	if a > b {
+		a, b = b, a
+	}
+	switch {
+	case b == Exclusive:
+		return Exclusive
+	case a == IntentionShared:
+		return b
+	case a == IntentionExclusive && b == Shared:
+		return SharedIntentionExclusive
+	}
+	// IX or S with SIX
+	return b
+}
+
+// Resource is a table or a row of a table, identified by its offset.
+type Resource struct {
+	Table string
+	Row   int64
+	// IsRow tells rows apart from the table itself
+	IsRow bool
+}
+
+func TableResource(table string) Resource {
+	return Resource{Table: table}
+}
+
+func RowResource(table string, offset int64) Resource {
+	return Resource{Table: table, Row: offset, IsRow: true}
+}
+
+func (r Resource) String() string {
+	if r.IsRow {
+		return fmt.Sprintf("%s@%d", r.Table, r.Row)
+	}
+	return r.Table
+}
+
+// DefaultTimeout is how long a lock request waits before it fails.
+const DefaultTimeout = 5 * time.Second
+
+// Manager grants locks to owners, usually transactions identified by their
+// ID. A request conflicting with the locks granted waits in a first come,
+// first served queue until they are released, the timeout expires or it
+// is chosen as the victim of a deadlock. Owners hold their locks until
+// ReleaseAll.
+type Manager struct {
+	mu        sync.Mutex
+	timeout   time.Duration
+	resources map[Resource]*queue
+	held      map[int64]map[Resource]struct{}
+	// waiting holds the pending request of every blocked owner
+	waiting map[int64]*request
+}
+
+type queue struct {
+	granted map[int64]Mode
+	waiting []*request
+}
+
+type request struct {
+	owner    int64
+	resource Resource
+	mode     Mode
+	upgrade  bool
+	// done receives nil once granted or the error aborting the request
+	done chan error
+}
+
+func NewManager(timeout time.Duration) *Manager {
+	return &Manager{
+		timeout:   timeout,
+		resources: make(map[Resource]*queue),
+		held:      make(map[int64]map[Resource]struct{}),
+		waiting:   make(map[int64]*request),
+	}
+}
+
+func (m *Manager) SetTimeout(timeout time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timeout = timeout
+}
+
+// LockTable locks a whole table.
+func (m *Manager) LockTable(owner int64, table string, mode Mode) error {
+	return m.Lock(owner, TableResource(table), mode)
+}
+
+// LockRow locks a row after taking the matching intention lock on its
+// table.
+func (m *Manager) LockRow(owner int64, table string, offset int64, mode Mode) error {
+	intention := IntentionShared
+	if mode != Shared && mode != IntentionShared {
+		intention = IntentionExclusive
+	}
+	if err := m.LockTable(owner, table, intention); err != nil {
+		return err
+	}
+	return m.Lock(owner, RowResource(table, offset), mode)
+}
+
+// Lock locks r in mode for owner, waiting for conflicting locks to be
+// released. A lock already held is upgraded to a mode granting both. It
+// fails with a LockTimeoutError or a DeadlockError, both retryable.
+func (m *Manager) Lock(owner int64, r Resource, mode Mode) error {
+	m.mu.Lock()
+	q := m.queue(r)
+	held, holds := q.granted[owner]
+	if holds {
+		if covers(held, mode) {
+			m.mu.Unlock()
+			return nil
+		}
+		mode = supremum(held, mode)
+	}
+	req := &request{owner: owner, resource: r, mode: mode, upgrade: holds, done: make(chan error, 1)}
+	// upgrades go before the requests of owners holding nothing yet
+	if (holds || len(q.waiting) == 0) && q.grantable(owner, mode) {
+		m.grant(q, req)
+		m.mu.Unlock()
+		return nil
+	}
+	m.enqueue(q, req)
+	if victim := m.findDeadlock(owner); victim != nil {
+		m.abort(victim, NewDeadlockError(victim.owner, victim.resource))
+	}
+	timeout := m.timeout
+	m.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-req.done:
+		return err
+	case <-timer.C:
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case err := <-req.done:
+		// granted or aborted while the timer fired
+		return err
+	default:
+	}
+	m.remove(req)
+	m.wake(r)
+	return NewLockTimeoutError(owner, r, mode)
+}
+
+// Release releases the lock of owner on r.
+func (m *Manager) Release(owner int64, r Resource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(owner, r)
+}
+
+// ReleaseAll releases every lock of owner.
+func (m *Manager) ReleaseAll(owner int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for r := range m.held[owner] {
+		m.release(owner, r)
+	}
+	delete(m.held, owner)
+}
+
+// Held returns the mode owner holds r in.
+func (m *Manager) Held(owner int64, r Resource) (Mode, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.resources[r]
+	if !ok {
+		return 0, false
+	}
+	mode, ok := q.granted[owner]
+	return mode, ok
+}
+
+// Waiting reports whether owner is blocked on a lock request.
+func (m *Manager) Waiting(owner int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.waiting[owner]
+	return ok
+}
+
+func (m *Manager) queue(r Resource) *queue {
+	q, ok := m.resources[r]
+	if !ok {
+		q = &queue{granted: make(map[int64]Mode)}
+		m.resources[r] = q
+	}
+	return q
+}
+
+// grantable reports whether mode is compatible with the locks granted to
+// the other owners.
+func (q *queue) grantable(owner int64, mode Mode) bool {
+	for other, held := range q.granted {
+		if other != owner && !Compatible(held, mode) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) grant(q *queue, req *request) {
+	q.granted[req.owner] = req.mode
+	if _, ok := m.held[req.owner]; !ok {
+		m.held[req.owner] = make(map[Resource]struct{})
+	}
+	m.held[req.owner][req.resource] = struct{}{}
+	req.done <- nil
+}
+
+func (m *Manager) enqueue(q *queue, req *request) {
+	pos := len(q.waiting)
+	if req.upgrade {
+		pos = 0
+		for pos < len(q.waiting) && q.waiting[pos].upgrade {
+			pos++
+		}
+	}
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[pos+1:], q.waiting[pos:])
+	q.waiting[pos] = req
+	m.waiting[req.owner] = req
+}
+
+func (m *Manager) remove(req *request) {
+	q := m.resources[req.resource]
+	for i, w := range q.waiting {
+		if w == req {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	delete(m.waiting, req.owner)
+}
+
+// wake grants the waiting requests of r in order until one conflicts.
+func (m *Manager) wake(r Resource) {
+	q, ok := m.resources[r]
+	if !ok {
+		return
+	}
+	for len(q.waiting) > 0 {
+		req := q.waiting[0]
+		if !q.grantable(req.owner, req.mode) {
+			break
+		}
+		q.waiting = q.waiting[1:]
+		delete(m.waiting, req.owner)
+		m.grant(q, req)
+	}
+	if len(q.granted) == 0 && len(q.waiting) == 0 {
+		delete(m.resources, r)
+	}
+}
+
+func (m *Manager) release(owner int64, r Resource) {
+	q, ok := m.resources[r]
+	if !ok {
+		return
+	}
+	delete(q.granted, owner)
+	delete(m.held[owner], r)
+	m.wake(r)
+}
+
+// abort fails a waiting request with err.
+func (m *Manager) abort(req *request, err error) {
+	m.remove(req)
+	req.done <- err
+	m.wake(req.resource)
+}
+
+// waitsFor returns the owners the waiting request req waits for: the
+// holders of conflicting locks and the requests queued before it.
+func (m *Manager) waitsFor(req *request) []int64 {
+	q := m.resources[req.resource]
+	owners := make([]int64, 0)
+	for owner, held := range q.granted {
+		if owner != req.owner && !Compatible(held, req.mode) {
+			owners = append(owners, owner)
+		}
+	}
+	// requests are granted in order
+	for _, w := range q.waiting {
+		if w == req {
+			break
+		}
+		owners = append(owners, w.owner)
+	}
+	return owners
+}
+
+// findDeadlock looks for a cycle of the wait-for graph going through
+// owner and returns the request of its youngest owner, the one with the
+// highest ID, as the victim. It returns nil without a cycle.
+func (m *Manager) findDeadlock(owner int64) *request {
+	path := make([]int64, 0)
+	visited := make(map[int64]bool)
+	var cycle []int64
+	var visit func(o int64) bool
+	visit = func(o int64) bool {
+		req, ok := m.waiting[o]
+		if !ok {
+			return false
+		}
+		path = append(path, o)
+		for _, next := range m.waitsFor(req) {
+			if next == owner {
+				cycle = path
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if !visit(owner) {
+		return nil
+	}
+	victim := cycle[0]
+	for _, o := range cycle {
+		victim = max(victim, o)
+	}
+	return m.waiting[victim]
+}
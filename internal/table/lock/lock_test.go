@@ -0,0 +1,97 @@
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_SharedAndUpgrade(t *testing.T) {
+	m := NewManager(10 * time.Millisecond)
+	assert.Nil(t, m.LockRow(1, "users", 10, Shared))
+	assert.Nil(t, m.LockRow(2, "users", 10, Shared))
+	mode, ok := m.Held(1, TableResource("users"))
+	assert.True(t, ok)
+	assert.Equal(t, IntentionShared, mode)
+
+	// the other reader blocks the upgrade until it releases
+	err := m.LockRow(1, "users", 10, Exclusive)
+	assert.ErrorAs(t, err, new(*LockTimeoutError))
+	assert.True(t, IsRetryable(err))
+	m.ReleaseAll(2)
+	assert.Nil(t, m.LockRow(1, "users", 10, Exclusive))
+	mode, _ = m.Held(1, TableResource("users"))
+	assert.Equal(t, IntentionExclusive, mode)
+
+	// IS and IX combine into SIX
+	assert.Nil(t, m.LockTable(1, "users", Shared))
+	mode, _ = m.Held(1, TableResource("users"))
+	assert.Equal(t, SharedIntentionExclusive, mode)
+	assert.ErrorAs(t, m.LockTable(2, "users", IntentionExclusive), new(*LockTimeoutError))
+	assert.Nil(t, m.LockTable(2, "users", IntentionShared))
+}
+
+func TestManager_WaitQueue(t *testing.T) {
+	m := NewManager(time.Second)
+	assert.Nil(t, m.LockTable(1, "users", Exclusive))
+
+	granted := make(chan int64, 2)
+	for _, owner := range []int64{2, 3} {
+		go func(owner int64) {
+			assert.Nil(t, m.LockTable(owner, "users", Exclusive))
+			granted <- owner
+			m.ReleaseAll(owner)
+		}(owner)
+		assert.Eventually(t, func() bool { return m.Waiting(owner) }, time.Second, time.Millisecond)
+	}
+	m.ReleaseAll(1)
+	// first come, first served
+	assert.Equal(t, int64(2), <-granted)
+	assert.Equal(t, int64(3), <-granted)
+}
+
+func TestManager_Deadlock(t *testing.T) {
+	m := NewManager(time.Second)
+	assert.Nil(t, m.LockRow(1, "users", 10, Exclusive))
+	assert.Nil(t, m.LockRow(2, "users", 20, Exclusive))
+
+	first := make(chan error, 1)
+	go func() {
+		first <- m.LockRow(1, "users", 20, Exclusive)
+	}()
+	assert.Eventually(t, func() bool { return m.Waiting(1) }, time.Second, time.Millisecond)
+
+	// closing the cycle aborts the youngest owner
+	err := m.LockRow(2, "users", 10, Exclusive)
+	assert.ErrorAs(t, err, new(*DeadlockError))
+	assert.True(t, IsRetryable(err))
+	assert.False(t, m.Waiting(2))
+
+	m.ReleaseAll(2)
+	assert.Nil(t, <-first)
+	mode, ok := m.Held(1, RowResource("users", 20))
+	assert.True(t, ok)
+	assert.Equal(t, Exclusive, mode)
+}
+
+func TestManager_DeadlockVictimWaiting(t *testing.T) {
+	m := NewManager(time.Second)
+	assert.Nil(t, m.LockTable(1, "users", Shared))
+	assert.Nil(t, m.LockTable(2, "users", Shared))
+
+	second := make(chan error, 1)
+	go func() {
+		second <- m.LockTable(2, "users", Exclusive)
+	}()
+	assert.Eventually(t, func() bool { return m.Waiting(2) }, time.Second, time.Millisecond)
+
+	// the waiting younger owner is the victim, the upgrade of 1 goes on
+	done := make(chan error, 1)
+	go func() {
+		done <- m.LockTable(1, "users", Exclusive)
+	}()
+	assert.ErrorAs(t, <-second, new(*DeadlockError))
+	m.ReleaseAll(2)
+	assert.Nil(t, <-done)
+}
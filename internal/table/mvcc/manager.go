@@ -0,0 +1,96 @@
+package mvcc
+
+import "sync"
+
+// Manager hands out transaction IDs to writers and snapshots to readers.
+// IDs start at 1 and increase with every writer, 0 stands for changes
+// older than every snapshot. A writer is committed once it ends.
+type Manager struct {
+	mu        sync.Mutex
+	next      int64
+	active    map[int64]struct{}
+	snapshots map[*Snapshot]struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		next:      1,
+		active:    make(map[int64]struct{}),
+		snapshots: make(map[*Snapshot]struct{}),
+	}
+}
+
+// Begin starts a writer and returns its transaction ID.
+func (m *Manager) Begin() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.next
+	m.next++
+	m.active[id] = struct{}{}
+	return id
+}
+
+// End commits the writer id: snapshots taken from now on see its changes.
+func (m *Manager) End(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, id)
+}
+
+// Snapshot returns a snapshot of the committed writers. It must be
+// released once no longer used so the versions it sees can be collected.
+func (m *Manager) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &Snapshot{
+		xmax:   m.next,
+		active: make(map[int64]struct{}, len(m.active)),
+	}
+	for id := range m.active {
+		s.active[id] = struct{}{}
+	}
+	m.snapshots[s] = struct{}{}
+	return s
+}
+
+func (m *Manager) Release(s *Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.snapshots, s)
+}
+
+// Horizon returns the lowest transaction ID that may be invisible to a
+// snapshot, current or future. Changes of writers below it are seen by
+// every snapshot.
+func (m *Manager) Horizon() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	horizon := m.next
+	for id := range m.active {
+		horizon = min(horizon, id)
+	}
+	for s := range m.snapshots {
+		horizon = min(horizon, s.xmax)
+		for id := range s.active {
+			horizon = min(horizon, id)
+		}
+	}
+	return horizon
+}
+
+// Snapshot is the set of writers committed when it was taken.
+type Snapshot struct {
+	// xmax is the first transaction ID begun after the snapshot
+	xmax   int64
+	active map[int64]struct{}
+}
+
+// Visible reports whether the changes of the writer id are seen by the
+// snapshot.
+func (s *Snapshot) Visible(id int64) bool {
+	if id >= s.xmax {
+		return false
+	}
+	_, ok := s.active[id]
+	return !ok
+}
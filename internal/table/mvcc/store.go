@@ -0,0 +1,170 @@
+package mvcc
+
+import "sync"
+
+// Version is a superseded version of a record, written by Xmin and
+// replaced or deleted by Xmax.
+type Version struct {
+	Values map[string]interface{}
+	Xmin   int64
+	Xmax   int64
+}
+
+// chain holds what is known of the record at an offset of a table file.
+type chain struct {
+	// creator is the writer of the record on disk, 0 when older than every
+	// snapshot
+	creator int64
+	// live is false once the record on disk is deleted
+	live bool
+	// versions holds the superseded versions, newest first
+	versions []Version
+}
+
+// Store keeps the recent versions of the records of a table, keyed by
+// offset. A record without an entry is seen by every snapshot as it is on
+// disk. The file only holds the latest version of every record, older ones
+// are kept in memory until no snapshot can see them.
+type Store struct {
+	mu     sync.Mutex
+	chains map[int64]*chain
+}
+
+func NewStore() *Store {
+	return &Store{chains: make(map[int64]*chain)}
+}
+
+// Create records that the writer tx wrote a record at offset.
+func (s *Store) Create(offset, tx int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.chain(offset)
+	c.creator = tx
+	c.live = true
+}
+
+// Supersede records that the writer tx replaced or deleted the record at
+// offset holding values. A replaced record is created again by the writer.
+func (s *Store) Supersede(offset int64, values map[string]interface{}, tx int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.chain(offset)
+	version := Version{Values: values, Xmin: c.creator, Xmax: tx}
+	c.versions = append([]Version{version}, c.versions...)
+	c.creator = 0
+	c.live = false
+}
+
+// Revert forgets the changes of the writer tx, rolled back on disk: the
+// records it replaced or deleted are current again and the ones it created
+// are gone.
+func (s *Store) Revert(tx int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for offset, c := range s.chains {
+		if c.live && c.creator == tx {
+			c.creator = 0
+			c.live = false
+		}
+		if !c.live && len(c.versions) > 0 && c.versions[0].Xmax == tx {
+			c.creator = c.versions[0].Xmin
+			c.live = true
+			c.versions = c.versions[1:]
+		}
+		if !c.live && len(c.versions) == 0 {
+			delete(s.chains, offset)
+		}
+	}
+}
+
+// Read returns the version of the record at offset seen by snapshot.
+// current holds the values on disk, nil when the record is deleted.
+func (s *Store) Read(offset int64, current map[string]interface{}, snapshot *Snapshot) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.chains[offset]
+	if !ok {
+		return current, current != nil
+	}
+	if c.live && snapshot.Visible(c.creator) {
+		return current, true
+	}
+	for _, v := range c.versions {
+		if snapshot.Visible(v.Xmin) && !snapshot.Visible(v.Xmax) {
+			return v.Values, true
+		}
+	}
+	return nil, false
+}
+
+// Changed reports whether the record at offset was replaced or deleted by
+// a writer snapshot does not see.
+func (s *Store) Changed(offset int64, snapshot *Snapshot) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.chains[offset]
+	if !ok {
+		return false
+	}
+	if c.live {
+		return !snapshot.Visible(c.creator)
+	}
+	return len(c.versions) > 0 && !snapshot.Visible(c.versions[0].Xmax)
+}
+
+// Current reports whether snapshot sees every record as it is on disk.
+func (s *Store) Current(snapshot *Snapshot) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.chains {
+		if c.live && !snapshot.Visible(c.creator) {
+			return false
+		}
+		if !c.live && len(c.versions) > 0 && !snapshot.Visible(c.versions[0].Xmax) {
+			return false
+		}
+	}
+	return true
+}
+
+// Collect drops the versions replaced by writers below horizon: no
+// snapshot can see them anymore.
+func (s *Store) Collect(horizon int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for offset, c := range s.chains {
+		if c.creator < horizon {
+			c.creator = 0
+		}
+		kept := c.versions[:0]
+		for _, v := range c.versions {
+			if v.Xmax >= horizon {
+				kept = append(kept, v)
+			}
+		}
+		c.versions = kept
+		if c.creator == 0 && len(c.versions) == 0 {
+			delete(s.chains, offset)
+		}
+	}
+}
+
+// Len returns the number of superseded versions kept.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.chains {
+		n += len(c.versions)
+	}
+	return n
+}
+
+func (s *Store) chain(offset int64) *chain {
+	c, ok := s.chains[offset]
+	if !ok {
+		c = &chain{live: true}
+		s.chains[offset] = c
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+package mvcc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot_Visible(t *testing.T) {
+	m := NewManager()
+	committed := m.Begin()
+	m.End(committed)
+	running := m.Begin()
+	s := m.Snapshot()
+	later := m.Begin()
+	m.End(running)
+	m.End(later)
+
+	assert.True(t, s.Visible(0))
+	assert.True(t, s.Visible(committed))
+	assert.False(t, s.Visible(running))
+	assert.False(t, s.Visible(later))
+	next := m.Snapshot()
+	assert.True(t, next.Visible(later))
+
+	// s may not see running
+	assert.Equal(t, running, m.Horizon())
+	m.Release(s)
+	m.Release(next)
+	assert.Equal(t, later+1, m.Horizon())
+}
+
+func TestStore(t *testing.T) {
+	m := NewManager()
+	store := NewStore()
+	old := map[string]interface{}{"id": int32(1)}
+	updated := map[string]interface{}{"id": int32(2)}
+
+	before := m.Snapshot()
+	tx := m.Begin()
+	store.Supersede(10, old, tx)
+	store.Create(10, tx)
+	store.Supersede(20, old, tx)
+	m.End(tx)
+	after := m.Snapshot()
+
+	values, ok := store.Read(10, updated, before)
+	assert.True(t, ok)
+	assert.Equal(t, old, values)
+	values, ok = store.Read(10, updated, after)
+	assert.True(t, ok)
+	assert.Equal(t, updated, values)
+	values, ok = store.Read(20, nil, before)
+	assert.True(t, ok)
+	assert.Equal(t, old, values)
+	_, ok = store.Read(20, nil, after)
+	assert.False(t, ok)
+
+	assert.True(t, store.Changed(10, before))
+	assert.False(t, store.Changed(10, after))
+	assert.False(t, store.Current(before))
+	assert.True(t, store.Current(after))
+
+	store.Collect(m.Horizon())
+	assert.Equal(t, 2, store.Len())
+	m.Release(before)
+	m.Release(after)
+	store.Collect(m.Horizon())
+	assert.Zero(t, store.Len())
+}
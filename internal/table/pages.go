@@ -0,0 +1,262 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/types"
+)
+
+// pageHeaderSize is the size of a page header: the page type, the length
+// used by the records of the page and the LSN of the last log entry applied
+// to the page.
+const pageHeaderSize = types.LenMeta + types.LenInt64
+
+// pageFill is the part of an append written to one page.
+type pageFill struct {
+	// page is the offset of the page header
+	page int64
+	// fresh is set for a page created by the append
+	fresh bool
+	// used is the length used by the records of the page once filled
+	used uint32
+	// offset is where data, the records written to the page, starts
+	offset int64
+	data   []byte
+}
+
+// placement lays out records appended to the table file.
+type placement struct {
+	fills []*pageFill
+	// offsets holds the offset of every record
+	offsets []int64
+	// end is the size of the file once the records are written
+	end int64
+}
+
+// place lays out records appended to the file at base: in the page ending
+// at base while they fit, then in new pages. A record larger than a page
+// gets a fresh page of its own. The layout only depends on base and the
+// records, so redoing an append puts every record back where it was.
+func (t *Table) place(base int64, records [][]byte) (*placement, error) {
+	pages, err := t.pageDirectory()
+	if err != nil {
+		return nil, fmt.Errorf("Table.place: %w", err)
+	}
+	p := &placement{offsets: make([]int64, 0, len(records)), end: base}
+	var fill *pageFill
+	if i := sort.Search(len(pages), func(i int) bool { return pages[i] >= base }); i > 0 {
+		page := pages[i-1]
+		fill = &pageFill{page: page, used: uint32(base - page - pageHeaderSize), offset: base}
+	}
+	for _, record := range records {
+		size := uint32(len(record))
+		if fill == nil || fill.used+size > PageSize && fill.used > 0 {
+			if fill != nil && len(fill.data) > 0 {
+				p.fills = append(p.fills, fill)
+			}
+			fill = &pageFill{page: p.end, fresh: true, offset: p.end + pageHeaderSize}
+			p.end += pageHeaderSize
+		}
+		p.offsets = append(p.offsets, p.end)
+		fill.data = append(fill.data, record...)
+		fill.used += size
+		p.end += int64(size)
+	}
+	if fill != nil && len(fill.data) > 0 {
+		p.fills = append(p.fills, fill)
+	}
+	return p, nil
+}
+
+// writeFill writes fill to the file, with the header of the page when it
+// is fresh, and records it with updatePage.
+func (t *Table) writeFill(fill *pageFill) error {
+	if !fill.fresh {
+		if err := t.writeAt(fill.offset, fill.data); err != nil {
+			return fmt.Errorf("Table.writeFill: %w", err)
+		}
+		return t.updatePage(fill)
+	}
+	buf := bytes.Buffer{}
+	buf.Write(pageHeader(fill.used))
+	buf.Write(fill.data)
+	if err := t.writeAt(fill.page, buf.Bytes()); err != nil {
+		return fmt.Errorf("Table.writeFill: %w", err)
+	}
+	return t.updatePage(fill)
+}
+
+// updatePage records that fill was written: the length of an existing page
+// is updated and a fresh page joins the directory. The page is stamped with
+// the others written by the operation.
+func (t *Table) updatePage(fill *pageFill) error {
+	if fill.fresh {
+		t.addPage(fill.page)
+	} else {
+		length := make([]byte, types.LenInt32)
+		binary.LittleEndian.PutUint32(length, fill.used)
+		if err := t.writeAt(fill.page+types.LenByte, length); err != nil {
+			return fmt.Errorf("Table.updatePage: %w", err)
+		}
+	}
+	t.touch(fill.page)
+	return nil
+}
+
+// pageHeader returns the header of a page using used bytes. Its LSN is set
+// when the operation writing the page is stamped.
+func pageHeader(used uint32) []byte {
+	header := make([]byte, pageHeaderSize)
+	header[0] = types.TypePage
+	binary.LittleEndian.PutUint32(header[types.LenByte:], used)
+	return header
+}
+
+// pageDirectory returns the offset of every page of the file in order. It
+// is read from the file on first use and kept up to date by the writers.
+// Bytes past the last complete page, left by a write torn by a crash, are
+// cut: the entry that wrote them is redone from the log.
+func (t *Table) pageDirectory() ([]int64, error) {
+	if t.pages != nil {
+		return t.pages, nil
+	}
+	size, err := t.fileSize()
+	if err != nil {
+		return nil, fmt.Errorf("Table.pageDirectory: %w", err)
+	}
+	pos, err := firstPage(io.NewSectionReader(t.file, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("Table.pageDirectory: %w", err)
+	}
+	pages := make([]int64, 0)
+	header := make([]byte, pageHeaderSize)
+	for pos < size {
+		if _, err := t.file.ReadAt(header, pos); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("Table.pageDirectory: %w", err)
+		}
+		end := pos + pageHeaderSize + int64(binary.LittleEndian.Uint32(header[types.LenByte:]))
+		if header[0] != types.TypePage || end > size {
+			break
+		}
+		pages = append(pages, pos)
+		pos = end
+	}
+	if pos < size {
+		if err := t.file.Truncate(pos); err != nil {
+			return nil, fmt.Errorf("Table.pageDirectory: %w", err)
+		}
+	}
+	t.pages = pages
+	return t.pages, nil
+}
+
+// addPage adds the page at offset to the directory.
+func (t *Table) addPage(offset int64) {
+	i := sort.Search(len(t.pages), func(i int) bool { return t.pages[i] >= offset })
+	if i < len(t.pages) && t.pages[i] == offset {
+		return
+	}
+	t.pages = append(t.pages, 0)
+	copy(t.pages[i+1:], t.pages[i:])
+	t.pages[i] = offset
+}
+
+// pageOf returns the offset of the page holding the record at offset.
+func (t *Table) pageOf(offset int64) (int64, error) {
+	pages, err := t.pageDirectory()
+	if err != nil {
+		return 0, fmt.Errorf("Table.pageOf: %w", err)
+	}
+	i := sort.Search(len(pages), func(i int) bool { return pages[i] > offset })
+	if i == 0 {
+		return 0, fmt.Errorf("Table.pageOf: no page holds offset %d", offset)
+	}
+	return pages[i-1], nil
+}
+
+// touch marks page as written by the current operation.
+func (t *Table) touch(page int64) {
+	if t.touched == nil {
+		t.touched = make(map[int64]struct{})
+	}
+	t.touched[page] = struct{}{}
+}
+
+// stampPages sets the LSN of every page written since the last stamp to
+// the LSN of the current operation. Pages written without one, by an
+// operation that was not logged, are left as they are.
+func (t *Table) stampPages() error {
+	defer func() {
+		t.touched = nil
+	}()
+	if t.lsn == 0 {
+		return nil
+	}
+	lsn := make([]byte, types.LenInt64)
+	binary.LittleEndian.PutUint64(lsn, uint64(t.lsn))
+	for page := range t.touched {
+		if err := t.writeAt(page+types.LenMeta, lsn); err != nil {
+			return fmt.Errorf("Table.stampPages: %w", err)
+		}
+	}
+	return nil
+}
+
+// pageLSN returns the LSN of the page at offset, 0 when the page is not
+// on disk.
+func (t *Table) pageLSN(offset int64) (int64, error) {
+	header := make([]byte, pageHeaderSize)
+	if _, err := t.file.ReadAt(header, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Table.pageLSN: %w", err)
+	}
+	if header[0] != types.TypePage {
+		return 0, nil
+	}
+	return int64(binary.LittleEndian.Uint64(header[types.LenMeta:])), nil
+}
+
+// shouldWrite reports whether the current operation writes page. Every
+// page is written at runtime. While an entry is redone or undone, only the
+// pages older than it are: the others already hold its changes.
+func (t *Table) shouldWrite(page int64) (bool, error) {
+	if t.stale == nil {
+		return true, nil
+	}
+	if stale, ok := t.stale[page]; ok {
+		return stale, nil
+	}
+	lsn, err := t.pageLSN(page)
+	if err != nil {
+		return false, fmt.Errorf("Table.shouldWrite: %w", err)
+	}
+	t.stale[page] = lsn < t.lsn
+	return t.stale[page], nil
+}
+
+// appendBase returns the offset records are appended at: the end of the
+// file, cut after the last page.
+func (t *Table) appendBase() (int64, error) {
+	if _, err := t.pageDirectory(); err != nil {
+		return 0, fmt.Errorf("Table.appendBase: %w", err)
+	}
+	return t.fileSize()
+}
+
+func (t *Table) fileSize() (int64, error) {
+	stat, err := t.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("Table.fileSize: %w", err)
+	}
+	return stat.Size(), nil
+}
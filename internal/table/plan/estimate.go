@@ -0,0 +1,128 @@
+package plan
+
+import (
+	"math"
+	"strings"
+
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// Default selectivities used when nothing better is known about a column.
+const (
+	EqSelectivity    = 0.1
+	RangeSelectivity = 1.0 / 3
+	LikeSelectivity  = 0.25
+	NullSelectivity  = 0.05
+)
+
+// Statistics supplies per column selectivities. Every method reports false
+// when it knows nothing about the column or value.
+type Statistics interface {
+	EqualSelectivity(column string, v interface{}) (float64, bool)
+	// RangeSelectivity estimates lo < column < hi, a nil bound is unbounded.
+	RangeSelectivity(column string, lo, hi interface{}, loInclusive, hiInclusive bool) (float64, bool)
+	NullFraction(column string) (float64, bool)
+}
+
+// Selectivity estimates the fraction of rows matching p. stats may be nil.
+func Selectivity(p predicate.Predicate, stats Statistics) float64 {
+	switch v := p.(type) {
+	case nil:
+		return 1
+	case *predicate.Logical:
+		s := 1.0
+		if v.Op == predicate.OpOr {
+			s = 0
+		}
+		for _, operand := range v.Operands {
+			o := Selectivity(operand, stats)
+			if v.Op == predicate.OpAnd {
+				s *= o
+			} else {
+				s = s + o - s*o
+			}
+		}
+		return s
+	case *predicate.Negation:
+		return 1 - Selectivity(v.Operand, stats)
+	case *predicate.Comparison:
+		return comparisonSelectivity(v, stats)
+	}
+	return 1
+}
+
+func comparisonSelectivity(c *predicate.Comparison, stats Statistics) float64 {
+	if stats == nil {
+		stats = noStatistics{}
+	}
+	eq := func(v interface{}) float64 {
+		if s, ok := stats.EqualSelectivity(c.Column, v); ok {
+			return s
+		}
+		return EqSelectivity
+	}
+	between := func(lo, hi interface{}, loInclusive, hiInclusive bool) float64 {
+		if s, ok := stats.RangeSelectivity(c.Column, lo, hi, loInclusive, hiInclusive); ok {
+			return s
+		}
+		if lo != nil && hi != nil {
+			return RangeSelectivity * RangeSelectivity * 2
+		}
+		return RangeSelectivity
+	}
+
+	switch c.Op {
+	case predicate.OpEq:
+		return eq(c.Values[0])
+	case predicate.OpNe:
+		return 1 - eq(c.Values[0])
+	case predicate.OpIn:
+		s := 0.0
+		for _, v := range c.Values {
+			s += eq(v)
+		}
+		return math.Min(1, s)
+	case predicate.OpLt:
+		return between(nil, c.Values[0], false, false)
+	case predicate.OpLe:
+		return between(nil, c.Values[0], false, true)
+	case predicate.OpGt:
+		return between(c.Values[0], nil, false, false)
+	case predicate.OpGe:
+		return between(c.Values[0], nil, true, false)
+	case predicate.OpBetween:
+		return between(c.Values[0], c.Values[1], true, true)
+	case predicate.OpLike:
+		pattern, ok := c.Values[0].(string)
+		if !ok {
+			return LikeSelectivity
+		}
+		prefix := pattern
+		if i := strings.IndexAny(pattern, "%_"); i >= 0 {
+			prefix = pattern[:i]
+		}
+		if prefix == pattern {
+			return eq(pattern)
+		}
+		if prefix != "" {
+			if s, ok := stats.RangeSelectivity(c.Column, prefix, prefix+string(rune(0x10FFFF)), true, false); ok {
+				return s
+			}
+		}
+		return LikeSelectivity
+	case predicate.OpIsNull:
+		if s, ok := stats.NullFraction(c.Column); ok {
+			return s
+		}
+		return NullSelectivity
+	}
+	return 1
+}
+
+type noStatistics struct{}
+
+func (noStatistics) EqualSelectivity(string, interface{}) (float64, bool) { return 0, false }
+func (noStatistics) NullFraction(string) (float64, bool)                  { return 0, false }
+func (noStatistics) RangeSelectivity(string, interface{}, interface{}, bool, bool) (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,121 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Operator string
+
+const (
+	OpSeqScan       Operator = "Seq Scan"
+	OpIndexScan     Operator = "Index Scan"
+	OpSort          Operator = "Sort"
+	OpLimit         Operator = "Limit"
+	OpProject       Operator = "Project"
+	OpHashAggregate Operator = "Hash Aggregate"
+	OpJoin          Operator = "Join"
+	OpFilter        Operator = "Filter"
+	OpUpdate        Operator = "Update"
+	OpDelete        Operator = "Delete"
+)
+
+// Node is one operator of a physical plan. The Actual* fields are only set
+// once the plan has been executed by EXPLAIN ANALYZE.
+type Node struct {
+	Operator Operator
+	Table    string
+	// Index is the indexed column used by an index scan.
+	Index string
+	// Filter is the predicate evaluated by the operator, if any.
+	Filter string
+	// Details holds operator specific properties such as sort keys or the
+	// join strategy.
+	Details       []string
+	EstimatedRows float64
+	Children      []*Node
+
+	Analyzed   bool
+	ActualRows int64
+	PagesRead  int64
+	Duration   time.Duration
+}
+
+func NewNode(op Operator, children ...*Node) *Node {
+	return &Node{Operator: op, Children: children}
+}
+
+// Walk calls fn for n and every descendant in depth first order.
+func (n *Node) Walk(fn func(*Node)) {
+	fn(n)
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Find returns the first node in the tree running op or nil.
+func (n *Node) Find(op Operator) *Node {
+	var found *Node
+	n.Walk(func(node *Node) {
+		if found == nil && node.Operator == op {
+			found = node
+		}
+	})
+	return found
+}
+
+// Finish marks n as analyzed with rows produced since start. Pages read are
+// inherited from its children. Finish on a nil node does nothing.
+func (n *Node) Finish(rows int64, start time.Time) {
+	if n == nil {
+		return
+	}
+	n.Analyzed = true
+	n.ActualRows = rows
+	n.Duration = time.Since(start)
+	for _, c := range n.Children {
+		n.PagesRead += c.PagesRead
+	}
+}
+
+// String renders the operator tree, one operator per line.
+func (n *Node) String() string {
+	var sb strings.Builder
+	n.write(&sb, 0)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func (n *Node) write(sb *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	if depth > 0 {
+		sb.WriteString(indent)
+		sb.WriteString("-> ")
+	}
+	sb.WriteString(string(n.Operator))
+	if n.Table != "" {
+		sb.WriteString(" on " + n.Table)
+	}
+	if n.Index != "" {
+		sb.WriteString(" using " + n.Index)
+	}
+	fmt.Fprintf(sb, " (rows=%.0f)", n.EstimatedRows)
+	if n.Analyzed {
+		fmt.Fprintf(sb, " (actual rows=%d pages=%d time=%s)", n.ActualRows, n.PagesRead, n.Duration)
+	}
+	sb.WriteString("\n")
+
+	detailIndent := indent + "     "
+	if depth == 0 {
+		detailIndent = "  "
+	}
+	if n.Filter != "" {
+		sb.WriteString(detailIndent + "Filter: " + n.Filter + "\n")
+	}
+	for _, d := range n.Details {
+		sb.WriteString(detailIndent + d + "\n")
+	}
+	for _, c := range n.Children {
+		c.write(sb, depth+1)
+	}
+}
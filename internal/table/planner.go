@@ -0,0 +1,144 @@
+package table
+
+import (
+	"math"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// estimatedStringLength is the assumed average length of string values.
+const estimatedStringLength = 16
+
+// accessPath describes how a scan reaches the records of a table. A nil
+// index means a sequential scan.
+type accessPath struct {
+	index *index.Index
+	value interface{}
+}
+
+// randomPageCost is the cost of fetching a page through an index relative
+// to reading the next page of a sequential scan.
+const randomPageCost = 2
+
+// chooseAccessPath picks an index scan when whereStmt requires an indexed
+// column to equal a value. Without statistics unique indexes are preferred
+// and any index beats a sequential scan; once the table is analyzed the
+// cheapest path by estimated pages read wins.
+func (t *Table) chooseAccessPath(whereStmt predicate.Predicate) *accessPath {
+	best := &accessPath{}
+	bestCost := t.estimatePages()
+	for _, c := range conjuncts(whereStmt) {
+		cmp, ok := c.(*predicate.Comparison)
+		if !ok || cmp.Op != predicate.OpEq || cmp.Values[0] == nil {
+			continue
+		}
+		idx := t.indexes[cmp.Column]
+		if idx == nil {
+			continue
+		}
+		if t.stats == nil {
+			if best.index == nil || (idx.Unique && !best.index.Unique) {
+				best = &accessPath{index: idx, value: cmp.Values[0]}
+			}
+			continue
+		}
+		cost := randomPageCost * t.estimateRowCount() * t.estimateSelectivity(cmp)
+		if idx.Unique {
+			cost = math.Min(cost, randomPageCost)
+		}
+		if cost < bestCost {
+			best = &accessPath{index: idx, value: cmp.Values[0]}
+			bestCost = cost
+		}
+	}
+	return best
+}
+
+// conjuncts flattens the top level ANDs of p.
+func conjuncts(p predicate.Predicate) []predicate.Predicate {
+	if p == nil {
+		return nil
+	}
+	l, ok := p.(*predicate.Logical)
+	if !ok || l.Op != predicate.OpAnd {
+		return []predicate.Predicate{p}
+	}
+	result := make([]predicate.Predicate, 0, len(l.Operands))
+	for _, operand := range l.Operands {
+		result = append(result, conjuncts(operand)...)
+	}
+	return result
+}
+
+// planScan describes the scan SelectRows performs for whereStmt.
+func (t *Table) planScan(whereStmt predicate.Predicate) *plan.Node {
+	path := t.chooseAccessPath(whereStmt)
+	node := plan.NewNode(plan.OpSeqScan)
+	if path.index != nil {
+		node.Operator = plan.OpIndexScan
+		node.Index = path.index.Column
+	}
+	node.Table = t.Name
+	if whereStmt != nil {
+		node.Filter = whereStmt.String()
+	}
+	node.EstimatedRows = t.estimateRowCount() * t.estimateSelectivity(whereStmt)
+	return node
+}
+
+// estimateRowCount returns the number of live records. Indexes know it
+// exactly, analyzed tables remember it; otherwise it is derived from the file
+// size.
+func (t *Table) estimateRowCount() float64 {
+	for _, idx := range t.indexes {
+		return float64(idx.Len())
+	}
+	if t.stats != nil {
+		return float64(t.stats.RowCount)
+	}
+	stat, err := t.file.Stat()
+	if err != nil {
+		return 0
+	}
+	var headerSize, recordSize int64 = 0, types.LenMeta
+	for _, name := range t.columnNames {
+		b, err := t.columns[name].MarshalBinary()
+		if err == nil {
+			headerSize += int64(len(b))
+		}
+		recordSize += types.LenMeta + columnWidth(t.columns[name].DataType())
+	}
+	if stat.Size() <= headerSize {
+		return 0
+	}
+	return math.Ceil(float64(stat.Size()-headerSize) / float64(recordSize))
+}
+
+func columnWidth(dataType byte) int64 {
+	switch dataType {
+	case types.TypeByte, types.TypeBool:
+		return types.LenByte
+	case types.TypeInt32:
+		return types.LenInt32
+	case types.TypeInt64, types.TypeFloat64:
+		return types.LenInt64
+	}
+	return estimatedStringLength
+}
+
+// estimatePages returns the number of pages a sequential scan reads.
+func (t *Table) estimatePages() float64 {
+	stat, err := t.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return math.Ceil(float64(stat.Size()) / PageSize)
+}
+
+// estimateSelectivity returns the fraction of records expected to match p.
+func (t *Table) estimateSelectivity(p predicate.Predicate) float64 {
+	return plan.Selectivity(p, tableStatistics{t: t})
+}
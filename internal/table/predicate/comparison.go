@@ -0,0 +1,240 @@
+package predicate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+)
+
+type Operator string
+
+const (
+	OpEq      Operator = "="
+	OpNe      Operator = "!="
+	OpLt      Operator = "<"
+	OpLe      Operator = "<="
+	OpGt      Operator = ">"
+	OpGe      Operator = ">="
+	OpIn      Operator = "IN"
+	OpBetween Operator = "BETWEEN"
+	OpLike    Operator = "LIKE"
+	OpIsNull  Operator = "IS NULL"
+)
+
+// Comparison compares a single column against one or more literal values.
+type Comparison struct {
+	Column string
+	Op     Operator
+	Values []interface{}
+	// collation of the column, bound by Resolve
+	collation collate.Collation
+}
+
+func newComparison(col string, op Operator, values ...interface{}) *Comparison {
+	return &Comparison{Column: col, Op: op, Values: values}
+}
+
+func Eq(col string, v interface{}) *Comparison { return newComparison(col, OpEq, v) }
+func Ne(col string, v interface{}) *Comparison { return newComparison(col, OpNe, v) }
+func Lt(col string, v interface{}) *Comparison { return newComparison(col, OpLt, v) }
+func Le(col string, v interface{}) *Comparison { return newComparison(col, OpLe, v) }
+func Gt(col string, v interface{}) *Comparison { return newComparison(col, OpGt, v) }
+func Ge(col string, v interface{}) *Comparison { return newComparison(col, OpGe, v) }
+
+func In(col string, values ...interface{}) *Comparison {
+	return newComparison(col, OpIn, values...)
+}
+
+// Between matches values in the closed interval [lo, hi].
+func Between(col string, lo, hi interface{}) *Comparison {
+	return newComparison(col, OpBetween, lo, hi)
+}
+
+// Like matches string columns against an SQL pattern where % matches any
+// sequence of characters and _ matches exactly one.
+func Like(col string, pattern string) *Comparison {
+	return newComparison(col, OpLike, pattern)
+}
+
+// HasPrefix is a shorthand for Like(col, prefix+"%") that escapes nothing;
+// prefix must not contain wildcard characters.
+func HasPrefix(col string, prefix string) *Comparison {
+	return Like(col, prefix+"%")
+}
+
+func IsNull(col string) *Comparison {
+	return newComparison(col, OpIsNull)
+}
+
+// Validate type-checks the comparison.
+func (c *Comparison) Validate(columns map[string]*column.Column) error {
+	col, ok := columns[c.Column]
+	if !ok {
+		return NewUnknownColumnError(c.Column)
+	}
+
+	switch c.Op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpLike:
+		if len(c.Values) != 1 {
+			return NewInvalidPredicateError(fmt.Sprintf("%s expects exactly one value", c.Op))
+		}
+	case OpBetween:
+		if len(c.Values) != 2 {
+			return NewInvalidPredicateError("BETWEEN expects exactly two values")
+		}
+	case OpIn:
+		if len(c.Values) == 0 {
+			return NewInvalidPredicateError("IN expects at least one value")
+		}
+	case OpIsNull:
+		if len(c.Values) != 0 {
+			return NewInvalidPredicateError("IS NULL does not take values")
+		}
+		return nil
+	default:
+		return NewInvalidPredicateError(fmt.Sprintf("unknown operator %s", c.Op))
+	}
+
+	if c.Op == OpLike && col.DataType() != types.TypeString {
+		return NewTypeMismatchError(c.Column, col.DataType(), c.Values[0])
+	}
+	for _, v := range c.Values {
+		// parameters are type checked when they are bound
+		if _, ok := v.(*Parameter); ok {
+			continue
+		}
+		if err := col.ValidateValue(v); err != nil {
+			return NewTypeMismatchError(c.Column, col.DataType(), v)
+		}
+	}
+	return nil
+}
+
+func (c *Comparison) Evaluate(record map[string]interface{}) (bool, error) {
+	actual, ok := record[c.Column]
+	if !ok {
+		return false, NewUnknownColumnError(c.Column)
+	}
+
+	if c.Op == OpIsNull {
+		return actual == nil, nil
+	}
+	for _, v := range c.Values {
+		if p, ok := v.(*Parameter); ok {
+			return false, NewUnboundParameterError(p.String())
+		}
+	}
+	// Like in SQL, comparisons against null never match.
+	if actual == nil {
+		return false, nil
+	}
+
+	switch c.Op {
+	case OpIn:
+		for _, v := range c.Values {
+			cmp, err := c.collation.Compare(actual, v)
+			if err != nil {
+				return false, err
+			}
+			if cmp == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case OpBetween:
+		lo, err := c.collation.Compare(actual, c.Values[0])
+		if err != nil {
+			return false, err
+		}
+		hi, err := c.collation.Compare(actual, c.Values[1])
+		if err != nil {
+			return false, err
+		}
+		return lo >= 0 && hi <= 0, nil
+	case OpLike:
+		s, ok := actual.(string)
+		if !ok {
+			return false, nil
+		}
+		pattern, _ := c.Values[0].(string)
+		return matchLike(c.collation.Key(s), c.collation.Key(pattern)), nil
+	}
+
+	cmp, err := c.collation.Compare(actual, c.Values[0])
+	if err != nil {
+		return false, err
+	}
+	switch c.Op {
+	case OpEq:
+		return cmp == 0, nil
+	case OpNe:
+		return cmp != 0, nil
+	case OpLt:
+		return cmp < 0, nil
+	case OpLe:
+		return cmp <= 0, nil
+	case OpGt:
+		return cmp > 0, nil
+	case OpGe:
+		return cmp >= 0, nil
+	}
+	return false, NewInvalidPredicateError(fmt.Sprintf("unknown operator %s", c.Op))
+}
+
+func (c *Comparison) String() string {
+	switch c.Op {
+	case OpIsNull:
+		return fmt.Sprintf("%s IS NULL", c.Column)
+	case OpBetween:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", c.Column, formatValue(c.Values[0]), formatValue(c.Values[1]))
+	case OpIn:
+		parts := make([]string, 0, len(c.Values))
+		for _, v := range c.Values {
+			parts = append(parts, formatValue(v))
+		}
+		return fmt.Sprintf("%s IN (%s)", c.Column, strings.Join(parts, ", "))
+	}
+	if len(c.Values) == 0 {
+		return fmt.Sprintf("%s %s", c.Column, c.Op)
+	}
+	return fmt.Sprintf("%s %s %s", c.Column, c.Op, formatValue(c.Values[0]))
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("'%s'", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// matchLike implements SQL LIKE matching with backtracking on the last %.
+func matchLike(s, pattern string) bool {
+	str := []rune(s)
+	pat := []rune(pattern)
+	i, j := 0, 0
+	star, match := -1, 0
+	for i < len(str) {
+		switch {
+		case j < len(pat) && (pat[j] == '_' || pat[j] == str[i]):
+			i++
+			j++
+		case j < len(pat) && pat[j] == '%':
+			star = j
+			match = i
+			j++
+		case star != -1:
+			j = star + 1
+			match++
+			i = match
+		default:
+			return false
+		}
+	}
+	for j < len(pat) && pat[j] == '%' {
+		j++
+	}
+	return j == len(pat)
+}
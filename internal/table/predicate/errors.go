@@ -0,0 +1,53 @@
+package predicate
+
+import "fmt"
+
+type UnknownColumnError struct {
+	column string
+}
+
+func NewUnknownColumnError(column string) *UnknownColumnError {
+	return &UnknownColumnError{column: column}
+}
+
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf("unknown column in where statement: %s", e.column)
+}
+
+type TypeMismatchError struct {
+	column   string
+	dataType byte
+	value    interface{}
+}
+
+func NewTypeMismatchError(column string, dataType byte, value interface{}) *TypeMismatchError {
+	return &TypeMismatchError{column: column, dataType: dataType, value: value}
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("type mismatch in where statement: column %s has type %d, got %T", e.column, e.dataType, e.value)
+}
+
+type InvalidPredicateError struct {
+	reason string
+}
+
+func NewInvalidPredicateError(reason string) *InvalidPredicateError {
+	return &InvalidPredicateError{reason: reason}
+}
+
+func (e *InvalidPredicateError) Error() string {
+	return fmt.Sprintf("invalid where statement: %s", e.reason)
+}
+
+type UnboundParameterError struct {
+	param string
+}
+
+func NewUnboundParameterError(param string) *UnboundParameterError {
+	return &UnboundParameterError{param: param}
+}
+
+func (e *UnboundParameterError) Error() string {
+	return fmt.Sprintf("parameter %s is not bound", e.param)
+}
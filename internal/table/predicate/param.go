@@ -0,0 +1,60 @@
+package predicate
+
+import "fmt"
+
+// Parameter is a placeholder for a value bound when a prepared statement is
+// executed. Positional parameters are numbered from 1, named parameters
+// have a Name instead.
+type Parameter struct {
+	Position int
+	Name     string
+}
+
+// Param returns the positional parameter $n.
+func Param(n int) *Parameter {
+	return &Parameter{Position: n}
+}
+
+// Named returns the named parameter :name.
+func Named(name string) *Parameter {
+	return &Parameter{Name: name}
+}
+
+func (p *Parameter) String() string {
+	if p.Name != "" {
+		return ":" + p.Name
+	}
+	return fmt.Sprintf("$%d", p.Position)
+}
+
+// Comparisons returns every comparison of p in depth first order.
+func Comparisons(p Predicate) []*Comparison {
+	comparisons := make([]*Comparison, 0)
+	walk(p, func(c *Comparison) {
+		comparisons = append(comparisons, c)
+	})
+	return comparisons
+}
+
+// Bind returns a copy of p with every parameter replaced by the value
+// returned by resolve. The values are not type checked.
+func Bind(p Predicate, resolve func(*Parameter) (interface{}, error)) (Predicate, error) {
+	return rebuild(p, func(c *Comparison) (*Comparison, error) {
+		values := make([]interface{}, len(c.Values))
+		for i, value := range c.Values {
+			param, ok := value.(*Parameter)
+			if !ok {
+				values[i] = value
+				continue
+			}
+			bound, err := resolve(param)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = bound
+		}
+		bound := newComparison(c.Column, c.Op, values...)
+		bound.collation = c.collation
+		return bound, nil
+	})
+}
@@ -0,0 +1,211 @@
+package predicate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/9bany/db/internal/table/column"
+)
+
+// Predicate is a boolean expression evaluated against a single record.
+// A nil Predicate matches every record.
+type Predicate interface {
+	// Validate type-checks the predicate against the columns of a table.
+	// It is called once before a scan starts and leaves the predicate
+	// untouched, see Resolve.
+	Validate(columns map[string]*column.Column) error
+	// Evaluate reports whether record satisfies the predicate.
+	Evaluate(record map[string]interface{}) (bool, error)
+	String() string
+}
+
+// Columns returns the names of every column referenced by p.
+func Columns(p Predicate) []string {
+	seen := make(map[string]struct{})
+	walk(p, func(c *Comparison) {
+		seen[c.Column] = struct{}{}
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func walk(p Predicate, fn func(*Comparison)) {
+	switch v := p.(type) {
+	case *Comparison:
+		fn(v)
+	case *Logical:
+		for _, operand := range v.Operands {
+			walk(operand, fn)
+		}
+	case *Negation:
+		walk(v.Operand, fn)
+	}
+}
+
+// rebuild returns a copy of p with every comparison replaced by fn.
+func rebuild(p Predicate, fn func(*Comparison) (*Comparison, error)) (Predicate, error) {
+	switch v := p.(type) {
+	case *Comparison:
+		return fn(v)
+	case *Logical:
+		operands := make([]Predicate, len(v.Operands))
+		for i, operand := range v.Operands {
+			rebuilt, err := rebuild(operand, fn)
+			if err != nil {
+				return nil, err
+			}
+			operands[i] = rebuilt
+		}
+		return &Logical{Op: v.Op, Operands: operands}, nil
+	case *Negation:
+		operand, err := rebuild(v.Operand, fn)
+		if err != nil {
+			return nil, err
+		}
+		return Not(operand), nil
+	}
+	return p, nil
+}
+
+// FromMap builds the conjunction of column = value equalities.
+// It mirrors the semantics of the original map based where statements.
+func FromMap(whereStmt map[string]interface{}) Predicate {
+	if len(whereStmt) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(whereStmt))
+	for name := range whereStmt {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	preds := make([]Predicate, 0, len(names))
+	for _, name := range names {
+		preds = append(preds, Eq(name, whereStmt[name]))
+	}
+	if len(preds) == 1 {
+		return preds[0]
+	}
+	return And(preds...)
+}
+
+type LogicalOperator string
+
+const (
+	OpAnd LogicalOperator = "AND"
+	OpOr  LogicalOperator = "OR"
+)
+
+type Logical struct {
+	Op       LogicalOperator
+	Operands []Predicate
+}
+
+func And(operands ...Predicate) *Logical {
+	return &Logical{Op: OpAnd, Operands: operands}
+}
+
+func Or(operands ...Predicate) *Logical {
+	return &Logical{Op: OpOr, Operands: operands}
+}
+
+func (l *Logical) Validate(columns map[string]*column.Column) error {
+	if len(l.Operands) == 0 {
+		return NewInvalidPredicateError(fmt.Sprintf("%s requires at least one operand", l.Op))
+	}
+	for _, operand := range l.Operands {
+		if operand == nil {
+			return NewInvalidPredicateError(fmt.Sprintf("%s operand cannot be nil", l.Op))
+		}
+		if err := operand.Validate(columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Logical) Evaluate(record map[string]interface{}) (bool, error) {
+	for _, operand := range l.Operands {
+		ok, err := operand.Evaluate(record)
+		if err != nil {
+			return false, err
+		}
+		if l.Op == OpAnd && !ok {
+			return false, nil
+		}
+		if l.Op == OpOr && ok {
+			return true, nil
+		}
+	}
+	return l.Op == OpAnd, nil
+}
+
+func (l *Logical) String() string {
+	parts := make([]string, 0, len(l.Operands))
+	for _, operand := range l.Operands {
+		parts = append(parts, operand.String())
+	}
+	return "(" + strings.Join(parts, " "+string(l.Op)+" ") + ")"
+}
+
+type Negation struct {
+	Operand Predicate
+}
+
+func Not(operand Predicate) *Negation {
+	return &Negation{Operand: operand}
+}
+
+func (n *Negation) Validate(columns map[string]*column.Column) error {
+	if n.Operand == nil {
+		return NewInvalidPredicateError("NOT operand cannot be nil")
+	}
+	return n.Operand.Validate(columns)
+}
+
+func (n *Negation) Evaluate(record map[string]interface{}) (bool, error) {
+	ok, err := n.Operand.Evaluate(record)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+func (n *Negation) String() string {
+	return "NOT " + n.Operand.String()
+}
+
+// Evaluate is a helper that treats a nil predicate as always true.
+func Evaluate(p Predicate, record map[string]interface{}) (bool, error) {
+	if p == nil {
+		return true, nil
+	}
+	return p.Evaluate(record)
+}
+
+// Validate is a helper that treats a nil predicate as always valid.
+func Validate(p Predicate, columns map[string]*column.Column) error {
+	if p == nil {
+		return nil
+	}
+	return p.Validate(columns)
+}
+
+// Resolve returns a copy of p whose string comparisons honor the collation
+// of their column. p must have been validated against columns. The copy is
+// the one to evaluate, p itself can be shared by concurrent queries.
+func Resolve(p Predicate, columns map[string]*column.Column) Predicate {
+	resolved, _ := rebuild(p, func(c *Comparison) (*Comparison, error) {
+		bound := newComparison(c.Column, c.Op, c.Values...)
+		if col, ok := columns[c.Column]; ok {
+			bound.collation = col.Collation()
+		}
+		return bound, nil
+	})
+	return resolved
+}
@@ -0,0 +1,88 @@
+package predicate
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/platform/collate"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchLike(t *testing.T) {
+	assert.True(t, matchLike("bany", "b%"))
+	assert.True(t, matchLike("bany", "%an%"))
+	assert.True(t, matchLike("bany", "b_n_"))
+	assert.True(t, matchLike("", "%"))
+	assert.False(t, matchLike("bany", "b_n"))
+	assert.False(t, matchLike("bany", "%x%"))
+}
+
+func TestEvaluate(t *testing.T) {
+	record := map[string]interface{}{"id": int32(7), "name": "bany", "deleted_at": nil}
+
+	cases := []struct {
+		pred     Predicate
+		expected bool
+	}{
+		{Eq("id", int32(7)), true},
+		{Ne("id", int32(7)), false},
+		{Lt("id", int32(8)), true},
+		{Ge("id", int32(8)), false},
+		{In("name", "alice", "bany"), true},
+		{Between("id", int32(1), int32(7)), true},
+		{IsNull("deleted_at"), true},
+		{Eq("deleted_at", int32(1)), false},
+		{Not(Eq("name", "bany")), false},
+		{And(Eq("id", int32(7)), Like("name", "%y")), true},
+		{Or(Eq("id", int32(1)), Eq("name", "x")), false},
+	}
+	for _, c := range cases {
+		ok, err := c.pred.Evaluate(record)
+		assert.Nil(t, err, c.pred.String())
+		assert.Equal(t, c.expected, ok, c.pred.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	columns := map[string]*column.Column{
+		"id":   column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+		"name": column.NewColumn("name", types.TypeString, column.ColumnOptions{}),
+	}
+
+	assert.Nil(t, Validate(nil, columns))
+	assert.Nil(t, And(Eq("id", int32(1)), Like("name", "b%")).Validate(columns))
+
+	var unknown *UnknownColumnError
+	assert.ErrorAs(t, Eq("missing", int32(1)).Validate(columns), &unknown)
+
+	var mismatch *TypeMismatchError
+	assert.ErrorAs(t, Eq("id", "1").Validate(columns), &mismatch)
+	assert.ErrorAs(t, Like("id", "1%").Validate(columns), &mismatch)
+
+	var invalid *InvalidPredicateError
+	assert.ErrorAs(t, And().Validate(columns), &invalid)
+}
+
+func TestResolve(t *testing.T) {
+	columns := map[string]*column.Column{
+		"name": column.NewColumn("name", types.TypeString, column.ColumnOptions{Collation: collate.NoCase}),
+	}
+	record := map[string]interface{}{"name": "bany"}
+
+	p := Not(Eq("name", "BANY"))
+	assert.Nil(t, p.Validate(columns))
+	ok, err := p.Evaluate(record)
+	assert.Nil(t, err)
+	assert.True(t, ok, "validating leaves the predicate untouched")
+
+	ok, err = Resolve(p, columns).Evaluate(record)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, Resolve(nil, columns))
+}
+
+func TestString(t *testing.T) {
+	p := Or(Between("id", int32(1), int32(3)), Not(In("name", "a", "b")))
+	assert.Equal(t, "(id BETWEEN 1 AND 3 OR NOT name IN ('a', 'b'))", p.String())
+}
@@ -0,0 +1,271 @@
+package table
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/9bany/db/internal/table/column"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+type stmtKind int
+
+const (
+	stmtSelect stmtKind = iota
+	stmtUpdate
+	stmtDelete
+)
+
+// NamedArg binds a value to a named parameter when a statement is executed.
+type NamedArg struct {
+	Name  string
+	Value interface{}
+}
+
+func Named(name string, value interface{}) NamedArg {
+	return NamedArg{Name: name, Value: value}
+}
+
+// Stmt is a statement validated and planned once against the table schema.
+// Where statements and update values may contain predicate.Param and
+// predicate.Named placeholders that are bound on every execution.
+//
+//	stmt, err := t.Prepare(Query{Where: predicate.Eq("id", predicate.Param(1))})
+//	...
+//	rows, err := stmt.Query(int32(1))
+type Stmt struct {
+	table  *Table
+	kind   stmtKind
+	query  Query
+	values map[string]interface{}
+	plan   *plan.Node
+
+	// params maps every placeholder to the columns its value must fit
+	params     map[string][]*column.Column
+	positional int
+	named      []string
+}
+
+// Prepare validates and plans q once so it can be executed repeatedly.
+func (t *Table) Prepare(q Query) (*Stmt, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, err := t.validateQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Prepare: %w", err)
+	}
+	node, err := t.explain(q, false)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Prepare: %w", err)
+	}
+	s, err := t.newStmt(stmtSelect, q, nil, node)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Prepare: %w", err)
+	}
+	return s, nil
+}
+
+// PrepareUpdate prepares Update(whereStmt, values). Values may be parameters.
+func (t *Table) PrepareUpdate(whereStmt predicate.Predicate, values map[string]interface{}) (*Stmt, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, err := t.explainUpdate(whereStmt, values, false)
+	if err != nil {
+		return nil, fmt.Errorf("Table.PrepareUpdate: %w", err)
+	}
+	s, err := t.newStmt(stmtUpdate, Query{Where: whereStmt}, values, node)
+	if err != nil {
+		return nil, fmt.Errorf("Table.PrepareUpdate: %w", err)
+	}
+	return s, nil
+}
+
+// PrepareDelete prepares Delete(whereStmt).
+func (t *Table) PrepareDelete(whereStmt predicate.Predicate) (*Stmt, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, err := t.explainDelete(whereStmt, false)
+	if err != nil {
+		return nil, fmt.Errorf("Table.PrepareDelete: %w", err)
+	}
+	s, err := t.newStmt(stmtDelete, Query{Where: whereStmt}, nil, node)
+	if err != nil {
+		return nil, fmt.Errorf("Table.PrepareDelete: %w", err)
+	}
+	return s, nil
+}
+
+// newStmt returns the statement of an already validated query, with q and
+// values bound to the collations of the columns.
+func (t *Table) newStmt(kind stmtKind, q Query, values map[string]interface{}, node *plan.Node) (*Stmt, error) {
+	q.Where = predicate.Resolve(q.Where, t.columns)
+	values = t.resolveAssignments(values)
+	s := &Stmt{
+		table:  t,
+		kind:   kind,
+		query:  q,
+		values: values,
+		plan:   node,
+		params: make(map[string][]*column.Column),
+	}
+	for _, c := range predicate.Comparisons(q.Where) {
+		for _, v := range c.Values {
+			if param, ok := v.(*predicate.Parameter); ok {
+				if err := s.addParam(param, t.columns[c.Column]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for col, v := range values {
+		if param, ok := v.(*predicate.Parameter); ok {
+			if err := s.addParam(param, t.columns[col]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := t.validateAssignment(col, v); err != nil {
+			return nil, err
+		}
+	}
+	for i := 1; i <= s.positional; i++ {
+		if _, ok := s.params[predicate.Param(i).String()]; !ok {
+			return nil, NewInvalidParameterError(predicate.Param(i).String(), "is never used")
+		}
+	}
+	sort.Strings(s.named)
+	return s, nil
+}
+
+func (s *Stmt) addParam(param *predicate.Parameter, col *column.Column) error {
+	if param.Name == "" && param.Position < 1 {
+		return NewInvalidParameterError(param.String(), "positions start at 1")
+	}
+	key := param.String()
+	if _, ok := s.params[key]; !ok {
+		if param.Name != "" {
+			s.named = append(s.named, param.Name)
+		} else if param.Position > s.positional {
+			s.positional = param.Position
+		}
+	}
+	s.params[key] = append(s.params[key], col)
+	return nil
+}
+
+// Plan returns the plan chosen when the statement was prepared.
+func (s *Stmt) Plan() *plan.Node {
+	return s.plan
+}
+
+// NumInput returns the number of positional parameters.
+func (s *Stmt) NumInput() int {
+	return s.positional
+}
+
+// Query executes a prepared Select. args holds the positional parameters in
+// order followed by any NamedArg.
+func (s *Stmt) Query(args ...interface{}) ([]map[string]interface{}, error) {
+	if s.kind != stmtSelect {
+		return nil, fmt.Errorf("Stmt.Query: statement does not return rows, use Exec")
+	}
+	q, _, err := s.bind(args)
+	if err != nil {
+		return nil, fmt.Errorf("Stmt.Query: %w", err)
+	}
+	s.table.mu.RLock()
+	defer s.table.mu.RUnlock()
+	results, err := s.table.runQuery(q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Stmt.Query: %w", err)
+	}
+	return results, nil
+}
+
+// Exec executes a prepared Update or Delete and returns the number of
+// affected records.
+func (s *Stmt) Exec(args ...interface{}) (int, error) {
+	q, values, err := s.bind(args)
+	if err != nil {
+		return 0, fmt.Errorf("Stmt.Exec: %w", err)
+	}
+
+	s.table.mu.Lock()
+	defer s.table.mu.Unlock()
+	var n int
+	switch s.kind {
+	case stmtUpdate:
+		var updated []map[string]interface{}
+		updated, err = s.table.update(q.Where, values, nil)
+		n = len(updated)
+	case stmtDelete:
+		var deletableRecords []*DeletableRecord
+		deletableRecords, err = s.table.findDeletableRecords(q.Where, nil)
+		if err == nil {
+			n, err = s.table.deleteRecords(deletableRecords)
+		}
+	default:
+		return 0, fmt.Errorf("Stmt.Exec: statement returns rows, use Query")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Stmt.Exec: %w", err)
+	}
+	return n, nil
+}
+
+// bind type checks args and substitutes them for the parameters of the
+// statement.
+func (s *Stmt) bind(args []interface{}) (Query, map[string]interface{}, error) {
+	bound := make(map[string]interface{}, len(s.params))
+	positional := 0
+	for _, arg := range args {
+		named, ok := arg.(NamedArg)
+		if !ok {
+			positional++
+			bound[predicate.Param(positional).String()] = arg
+			continue
+		}
+		key := predicate.Named(named.Name).String()
+		if _, ok := s.params[key]; !ok {
+			return Query{}, nil, NewInvalidParameterError(key, "is not used by the statement")
+		}
+		bound[key] = named.Value
+	}
+	if positional != s.positional {
+		return Query{}, nil, fmt.Errorf("expected %d positional arguments, got %d", s.positional, positional)
+	}
+	for key, columns := range s.params {
+		v, ok := bound[key]
+		if !ok {
+			return Query{}, nil, NewInvalidParameterError(key, "is not bound")
+		}
+		for _, col := range columns {
+			if err := col.ValidateValue(v); err != nil {
+				return Query{}, nil, NewInvalidParameterError(key, fmt.Sprintf("does not fit column %s: %s", col.NameToStr(), err))
+			}
+		}
+	}
+
+	resolve := func(p *predicate.Parameter) (interface{}, error) {
+		return bound[p.String()], nil
+	}
+	q := s.query
+	where, err := predicate.Bind(q.Where, resolve)
+	if err != nil {
+		return Query{}, nil, err
+	}
+	q.Where = where
+
+	var values map[string]interface{}
+	if s.values != nil {
+		values = make(map[string]interface{}, len(s.values))
+		for col, v := range s.values {
+			if param, ok := v.(*predicate.Parameter); ok {
+				v = bound[param.String()]
+			}
+			values[col] = v
+		}
+	}
+	return q, values, nil
+}
@@ -0,0 +1,88 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrepare_Query(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	stmt, err := tb.Prepare(Query{
+		Columns: []string{"username"},
+		Where: predicate.And(
+			predicate.Gt("age", predicate.Param(1)),
+			predicate.Like("username", "b%"),
+			predicate.Ne("id", predicate.Named("skip")),
+		),
+		OrderBy: []OrderBy{Asc("age")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stmt.NumInput())
+	assert.NotNil(t, stmt.Plan().Find(plan.OpSeqScan))
+
+	rows, err := stmt.Query(int64(20), Named("skip", int32(3)))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"username": "bany"}}, rows)
+
+	rows, err = stmt.Query(int64(10), Named("skip", int32(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"username": "barbara"}, {"username": "bob"}}, rows)
+
+	// arguments are type checked against the column
+	_, err = stmt.Query(int32(20), Named("skip", int32(3)))
+	assert.NotNil(t, err)
+	_, err = stmt.Query(int64(20))
+	assert.NotNil(t, err)
+	_, err = stmt.Query(Named("skip", int32(3)))
+	assert.NotNil(t, err)
+	_, err = stmt.Query(int64(20), Named("skip", int32(3)), Named("other", 1))
+	assert.NotNil(t, err)
+}
+
+func TestPrepare_UpdateAndDelete(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	update, err := tb.PrepareUpdate(
+		predicate.Eq("id", predicate.Param(1)),
+		map[string]interface{}{"age": predicate.Param(2)},
+	)
+	assert.Nil(t, err)
+	n, err := update.Exec(int32(2), int64(26))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = update.Query(int32(2), int64(26))
+	assert.NotNil(t, err)
+
+	del, err := tb.PrepareDelete(predicate.Eq("age", predicate.Named("age")))
+	assert.Nil(t, err)
+	n, err = del.Exec(Named("age", int64(26)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	rows, err := tb.Select(predicate.Eq("id", int32(2)))
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestPrepare_Invalid(t *testing.T) {
+	tb := newTestTable(t)
+
+	_, err := tb.Prepare(Query{Where: predicate.Eq("missing", predicate.Param(1))})
+	assert.NotNil(t, err)
+	_, err = tb.Prepare(Query{Where: predicate.Eq("id", predicate.Param(2))})
+	assert.NotNil(t, err)
+	_, err = tb.PrepareUpdate(nil, map[string]interface{}{"age": "old"})
+	assert.NotNil(t, err)
+
+	// an unbound parameter never matches silently
+	_, err = tb.Insert(map[string]interface{}{"id": int32(1), "username": "bany", "age": int64(30)})
+	assert.Nil(t, err)
+	_, err = tb.Select(predicate.Eq("id", predicate.Param(1)))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,186 @@
+package table
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/sorter"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// SpillDirName is the directory of a database where queries spill the rows
+// that do not fit in memory. It only holds temporary files, left behind
+// after a crash at most.
+const SpillDirName = "spill"
+
+type OrderBy struct {
+	Column string
+	Desc   bool
+}
+
+func Asc(column string) OrderBy {
+	return OrderBy{Column: column}
+}
+
+func Desc(column string) OrderBy {
+	return OrderBy{Column: column, Desc: true}
+}
+
+// Query describes a Select with projection, ordering and paging.
+type Query struct {
+	// Columns to return. Every column is returned when empty.
+	Columns []string
+	Where   predicate.Predicate
+	OrderBy []OrderBy
+	// Limit caps the number of returned rows. Zero means no limit.
+	Limit  int
+	Offset int
+	// SortMemoryLimit is the number of bytes ORDER BY keeps in memory
+	// before spilling sorted runs to disk. Zero uses the sorter default.
+	SortMemoryLimit int
+}
+
+func (t *Table) Query(q Query) ([]map[string]interface{}, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	q, err := t.validateQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Query: %w", err)
+	}
+	results, err := t.runQuery(q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Query: %w", err)
+	}
+	return results, nil
+}
+
+// queryNodes are the plan nodes EXPLAIN ANALYZE fills while a query runs.
+// Nodes of operators the query does not use are nil.
+type queryNodes struct {
+	scan  *plan.Node
+	sort  *plan.Node
+	limit *plan.Node
+}
+
+func (t *Table) runQuery(q Query, nodes *queryNodes) ([]map[string]interface{}, error) {
+	if nodes == nil {
+		nodes = &queryNodes{}
+	}
+	start := time.Now()
+	results := make([]map[string]interface{}, 0)
+	if len(q.OrderBy) == 0 {
+		skipped := 0
+		err := t.scanAnalyzed(q.Where, nodes.scan, func(_ int64, record *parser.RawRecord) (bool, error) {
+			if skipped < q.Offset {
+				skipped++
+				return true, nil
+			}
+			results = append(results, project(record.Values, q.Columns))
+			return q.Limit == 0 || len(results) < q.Limit, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Table.runQuery: %w", err)
+		}
+		nodes.limit.Finish(int64(len(results)), start)
+		return results, nil
+	}
+
+	s := sorter.NewSorterFS(t.fs, t.columnNames, t.compareRecords(q.OrderBy), q.SortMemoryLimit, t.spillDir())
+	err := t.scanAnalyzed(q.Where, nodes.scan, func(_ int64, record *parser.RawRecord) (bool, error) {
+		return true, s.Add(record.Values)
+	})
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Table.runQuery: %w", err)
+	}
+	it, err := s.Sort()
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Table.runQuery: %w", err)
+	}
+	defer it.Close()
+
+	sorted := int64(0)
+	for i := 0; q.Limit == 0 || len(results) < q.Limit; i++ {
+		record, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Table.runQuery: %w", err)
+		}
+		sorted++
+		if i < q.Offset {
+			continue
+		}
+		results = append(results, project(record, q.Columns))
+	}
+	nodes.sort.Finish(sorted, start)
+	nodes.limit.Finish(int64(len(results)), start)
+	return results, nil
+}
+
+// spillDir returns the directory next to the table file that queries spill
+// their rows to, see SpillDirName.
+func (t *Table) spillDir() string {
+	return filepath.Join(filepath.Dir(t.file.Name()), SpillDirName)
+}
+
+// validateQuery type-checks q and returns the copy of it to run.
+func (t *Table) validateQuery(q Query) (Query, error) {
+	for _, col := range q.Columns {
+		if _, ok := t.columns[col]; !ok {
+			return Query{}, fmt.Errorf("Table.validateQuery: unknown column in projection: %s", col)
+		}
+	}
+	for _, o := range q.OrderBy {
+		if _, ok := t.columns[o.Column]; !ok {
+			return Query{}, fmt.Errorf("Table.validateQuery: unknown column in order by: %s", o.Column)
+		}
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return Query{}, fmt.Errorf("Table.validateQuery: limit and offset cannot be negative")
+	}
+	where, err := t.validateWhereStmt(q.Where)
+	if err != nil {
+		return Query{}, err
+	}
+	q.Where = where
+	return q, nil
+}
+
+// compareRecords orders records by orderBy, comparing strings under the
+// collation of their column.
+func (t *Table) compareRecords(orderBy []OrderBy) sorter.CompareFunc {
+	return func(a, b map[string]interface{}) (int, error) {
+		for _, o := range orderBy {
+			cmp, err := t.columns[o.Column].Collation().Compare(a[o.Column], b[o.Column])
+			if err != nil {
+				return 0, err
+			}
+			if cmp == 0 {
+				continue
+			}
+			if o.Desc {
+				return -cmp, nil
+			}
+			return cmp, nil
+		}
+		return 0, nil
+	}
+}
+
+func project(record map[string]interface{}, columns []string) map[string]interface{} {
+	if len(columns) == 0 {
+		return record
+	}
+	projected := make(map[string]interface{}, len(columns))
+	for _, col := range columns {
+		projected[col] = record[col]
+	}
+	return projected
+}
@@ -0,0 +1,53 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_ProjectionOrderLimit(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.Query(Query{
+		Columns: []string{"username"},
+		OrderBy: []OrderBy{Asc("age"), Desc("id")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"username": "barbara"},
+		{"username": "carol"},
+		{"username": "alice"},
+		{"username": "bany"},
+		{"username": "bob"},
+	}, rows)
+
+	rows, err = tb.Query(Query{
+		Columns: []string{"id"},
+		Where:   predicate.Gt("age", int64(20)),
+		OrderBy: []OrderBy{Desc("age")},
+		Limit:   2,
+		Offset:  1,
+		// force the sorter to spill every row
+		SortMemoryLimit: 1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int32(1)}, {"id": int32(2)}}, rows)
+
+	rows, err = tb.Query(Query{Columns: []string{"id"}, Limit: 2, Offset: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int32(4)}, {"id": int32(5)}}, rows)
+}
+
+func TestQuery_Invalid(t *testing.T) {
+	tb := newTestTable(t)
+
+	_, err := tb.Query(Query{Columns: []string{"missing"}})
+	assert.NotNil(t, err)
+	_, err = tb.Query(Query{OrderBy: []OrderBy{Asc("missing")}})
+	assert.NotNil(t, err)
+	_, err = tb.Query(Query{Limit: -1})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,242 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/wal"
+)
+
+// RestoreWAL recovers the table from a log written by this table only, see
+// WAL.Recover. The tables of a database share its log and are recovered
+// together by the database.
+func (t *Table) RestoreWAL() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.wal.Recover(func(record *wal.Record) error {
+		ops, err := t.ownOperations(record)
+		if err != nil {
+			return err
+		}
+		return t.redoOps(record.LSN, ops)
+	}, func(record *wal.Record, abort int64) error {
+		ops, err := t.ownOperations(record)
+		if err != nil {
+			return err
+		}
+		return t.undoOps(abort, ops)
+	})
+	if err != nil {
+		return fmt.Errorf("Table.RestoreWAL: %w", err)
+	}
+	return nil
+}
+
+// ownOperations returns the operations of record, which must all be on the
+// table.
+func (t *Table) ownOperations(record *wal.Record) ([]wal.Operation, error) {
+	ops, err := record.Operations()
+	if err != nil {
+		return nil, fmt.Errorf("Table.ownOperations: %w", err)
+	}
+	for _, op := range ops {
+		if op.Table != t.Name {
+			return nil, fmt.Errorf("Table.ownOperations: entry of table %s", op.Table)
+		}
+	}
+	return ops, nil
+}
+
+// RedoOps redoes the operations on the table of the log entry lsn. Only the
+// pages older than the entry are written, so redoing an entry that was
+// partly or entirely applied before a crash neither loses nor duplicates
+// records. Indexes are not maintained, they are loaded afterwards.
+func (t *Table) RedoOps(lsn int64, ops []wal.Operation) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.redoOps(lsn, ops)
+}
+
+// UndoOps rolls back the operations on the table of an entry rolled back
+// by the abort entry lsn. The entry must be redone first. Only the pages
+// older than the abort entry are written.
+func (t *Table) UndoOps(lsn int64, ops []wal.Operation) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.undoOps(lsn, ops)
+}
+
+func (t *Table) redoOps(lsn int64, ops []wal.Operation) error {
+	if err := t.replay(lsn, ops, t.redo); err != nil {
+		return fmt.Errorf("Table.RedoOps: %w", err)
+	}
+	return nil
+}
+
+func (t *Table) undoOps(lsn int64, ops []wal.Operation) error {
+	reversed := make([]wal.Operation, 0, len(ops))
+	for i := len(ops) - 1; i >= 0; i-- {
+		reversed = append(reversed, ops[i])
+	}
+	if err := t.replay(lsn, reversed, t.undo); err != nil {
+		return fmt.Errorf("Table.UndoOps: %w", err)
+	}
+	return nil
+}
+
+// replay calls apply with the data of every operation as the log entry
+// lsn: the pages holding the entry already are skipped, the others are
+// stamped with it once written.
+func (t *Table) replay(lsn int64, ops []wal.Operation, apply func(r *wal.RestorableData) error) error {
+	t.lsn, t.stale, t.touched = lsn, make(map[int64]bool), nil
+	defer func() {
+		t.lsn, t.stale = 0, nil
+	}()
+	t.wal.Dirty(t.file)
+	for _, op := range ops {
+		restorable := &wal.RestorableData{}
+		if err := restorable.Add(op.Op, op.Data); err != nil {
+			return fmt.Errorf("Table.replay: %w", err)
+		}
+		if err := apply(restorable); err != nil {
+			return fmt.Errorf("Table.replay: %w", err)
+		}
+	}
+	return t.stampPages()
+}
+
+// redo writes restored data to the table file: records updated in place
+// are overwritten, deleted ones are flagged and the others appended where
+// they were laid out.
+func (t *Table) redo(restorable *wal.RestorableData) error {
+	for _, overwrite := range restorable.Overwrites {
+		if err := t.overwrite(overwrite.Offset, overwrite.Data); err != nil {
+			return fmt.Errorf("Table.redo: %w", err)
+		}
+	}
+	for _, offset := range restorable.Deleted {
+		if err := t.markDeletedAt(offset); err != nil {
+			return fmt.Errorf("Table.redo: %w", err)
+		}
+	}
+	records := splitRecords(restorable.Data)
+	if len(records) == 0 {
+		return nil
+	}
+	base := restorable.Base
+	if base == 0 {
+		// the records of an OpInsert entry go to the end of the file
+		var err error
+		if base, err = t.appendBase(); err != nil {
+			return fmt.Errorf("Table.redo: %w", err)
+		}
+	}
+	p, err := t.place(base, records)
+	if err != nil {
+		return fmt.Errorf("Table.redo: %w", err)
+	}
+	for _, fill := range p.fills {
+		write, err := t.shouldWrite(fill.page)
+		if err != nil {
+			return fmt.Errorf("Table.redo: %w", err)
+		}
+		if !write {
+			continue
+		}
+		if err := t.writeFill(fill); err != nil {
+			return fmt.Errorf("Table.redo: %w", err)
+		}
+	}
+	return nil
+}
+
+// undo rolls back restored data, redone before: appended records are
+// deleted and the before images of the others written back.
+func (t *Table) undo(restorable *wal.RestorableData) error {
+	if records := splitRecords(restorable.Data); len(records) > 0 {
+		if restorable.Base == 0 {
+			return fmt.Errorf("Table.undo: unknown offset of the appended records")
+		}
+		p, err := t.place(restorable.Base, records)
+		if err != nil {
+			return fmt.Errorf("Table.undo: %w", err)
+		}
+		for i := len(p.offsets) - 1; i >= 0; i-- {
+			if err := t.markDeletedAt(p.offsets[i]); err != nil {
+				return fmt.Errorf("Table.undo: %w", err)
+			}
+		}
+	}
+	for i := len(restorable.Befores) - 1; i >= 0; i-- {
+		before := restorable.Befores[i]
+		if err := t.overwrite(before.Offset, before.Data); err != nil {
+			return fmt.Errorf("Table.undo: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitRecords splits consecutive encoded records.
+func splitRecords(data []byte) [][]byte {
+	records := make([][]byte, 0)
+	for len(data) >= types.LenMeta {
+		size := types.LenMeta + int(binary.LittleEndian.Uint32(data[types.LenByte:]))
+		records = append(records, data[:size])
+		data = data[size:]
+	}
+	return records
+}
+
+// abort rolls back the operation logged as entry once applying it failed
+// with cause, and returns cause. The rollback is logged as an abort entry.
+// Should the rollback fail too, both entries are left to recovery.
+func (t *Table) abort(entry *wal.Entry, op string, data []byte, cause error) error {
+	defer t.endWrite()
+	abort, err := t.wal.Abort(entry, t.Name)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	ops := []wal.Operation{{Table: t.Name, Op: op, Data: data}}
+	if err := t.rollback(t.writeTx, entry.LSN, abort.LSN, ops); err != nil {
+		return errors.Join(cause, err)
+	}
+	if err := t.wal.Commit(abort); err != nil {
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+// rollback undoes ops, written by the writer tx and logged as the entry
+// lsn, after applying them failed part way. They are redone first so every
+// change is in place, then undone as the abort entry abort. The versions
+// of the writer are forgotten and the indexes rebuilt.
+func (t *Table) rollback(tx, lsn, abort int64, ops []wal.Operation) error {
+	if err := t.redoOps(lsn, ops); err != nil {
+		return fmt.Errorf("Table.rollback: %w", err)
+	}
+	if err := t.undoOps(abort, ops); err != nil {
+		return fmt.Errorf("Table.rollback: %w", err)
+	}
+	t.versions.Revert(tx)
+	if err := t.rebuildIndexes(); err != nil {
+		return fmt.Errorf("Table.rollback: %w", err)
+	}
+	return nil
+}
+
+// rebuildIndexes builds every index of the table again from the file.
+func (t *Table) rebuildIndexes() error {
+	for _, idx := range t.indexes {
+		if err := t.buildIndex(idx); err != nil {
+			return fmt.Errorf("Table.rebuildIndexes: %w", err)
+		}
+	}
+	for _, idx := range t.fullText {
+		if err := t.buildFullTextIndex(idx); err != nil {
+			return fmt.Errorf("Table.rebuildIndexes: %w", err)
+		}
+	}
+	return nil
+}
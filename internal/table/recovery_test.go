@@ -0,0 +1,143 @@
+package table
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	columnio "github.com/9bany/db/internal/table/column/io"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+// reopenTestTable opens the files of tb again, as after a crash.
+func reopenTestTable(t *testing.T, tb *Table) *Table {
+	f, err := os.OpenFile(tb.file.Name(), os.O_RDWR, 0777)
+	assert.Nil(t, err)
+	t.Cleanup(func() { f.Close() })
+	writeAheadLog, err := wal.NewWal(filepath.Dir(tb.file.Name()), "tb_user")
+	assert.Nil(t, err)
+	r := parserio.NewReader(f)
+	reopened, err := NewTable(f, r, columnio.NewColumnDefinitionReader(r), writeAheadLog)
+	assert.Nil(t, err)
+	assert.Nil(t, reopened.ReadColumnDefinitions())
+	return reopened
+}
+
+// logInsert logs the insert of the user id and writes it to the table
+// file without committing it.
+func logInsert(t *testing.T, tb *Table, id int32) (*wal.Entry, []byte) {
+	buf, err := tb.encodeRecord(map[string]interface{}{"id": id, "username": "dave", "age": int64(50)})
+	assert.Nil(t, err)
+	encoded := [][]byte{buf.Bytes()}
+	data, err := tb.encodeInsertBatch(encoded)
+	assert.Nil(t, err)
+	entry, err := tb.appendLog(walencoding.OpInsertBatch, data)
+	assert.Nil(t, err)
+	_, err = tb.writePages(encoded)
+	assert.Nil(t, err)
+	return entry, data
+}
+
+func TestRestoreWAL_RedoesAppliedInsertOnce(t *testing.T) {
+	for name, stamped := range map[string]bool{
+		// the crash happens before the commit marker is written
+		"stamped": true,
+		// the crash happens before the page LSN is written
+		"written": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			tb := newTestTable(t)
+			insertTestUsers(t, tb)
+			entry, _ := logInsert(t, tb, 6)
+			if stamped {
+				assert.Nil(t, tb.stampPages())
+			}
+
+			reopened := reopenTestTable(t, tb)
+			assert.Nil(t, reopened.RestoreWAL())
+			assert.Equal(t, []int32{1, 2, 3, 4, 5, 6}, selectIDs(t, reopened, nil))
+			pages, err := reopened.pageDirectory()
+			assert.Nil(t, err)
+			lsn, err := reopened.pageLSN(pages[len(pages)-1])
+			assert.Nil(t, err)
+			assert.Equal(t, entry.LSN, lsn)
+
+			// pages stay consistent for the next insert
+			_, err = reopened.Insert(map[string]interface{}{"id": int32(7), "username": "erin", "age": int64(33)})
+			assert.Nil(t, err)
+			assert.Equal(t, []int32{1, 2, 3, 4, 5, 6, 7}, selectIDs(t, reopened, nil))
+		})
+	}
+}
+
+func TestRestoreWAL_UndoesAbortedEntries(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	entry, _ := logInsert(t, tb, 6)
+	_, err := tb.wal.Abort(entry, tb.Name)
+	assert.Nil(t, err)
+
+	// a relocated update, half applied when it is aborted
+	old, _, afters := logUpdate(t, tb, 2, map[string]interface{}{"username": "alice-the-second"})
+	pending, err := tb.wal.Pending()
+	assert.Nil(t, err)
+	_, err = tb.markRecordDeleted(old)
+	assert.Nil(t, err)
+	assert.NotEqual(t, len(afters[0]), old[0].l)
+	_, err = tb.wal.Abort(pending[len(pending)-1].Entry, tb.Name)
+	assert.Nil(t, err)
+
+	// the crash happens before either entry is undone
+	reopened := reopenTestTable(t, tb)
+	assert.Nil(t, reopened.RestoreWAL())
+	rows, err := reopened.Select(nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, []int32{1, 2, 3, 4, 5}, selectIDs(t, reopened, nil))
+	assert.Equal(t, []int32{2}, selectIDs(t, reopened, predicate.Eq("username", "alice")))
+	pending, err = reopened.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestAbort_RollsBackFailedInsert(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+	entry, data := logInsert(t, tb, 6)
+
+	cause := errors.New("disk full")
+	err := tb.abort(entry, walencoding.OpInsertBatch, data, cause)
+	assert.Equal(t, cause, err)
+	assert.Equal(t, []int32{1, 2, 3, 4, 5}, selectIDs(t, tb, nil))
+	rows, err := tb.LookupIndex("id", int32(6))
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+	pending, err := tb.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	// the id is free again
+	_, err = tb.Insert(map[string]interface{}{"id": int32(6), "username": "erin", "age": int64(33)})
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4, 5, 6}, selectIDs(t, tb, nil))
+}
+
+func TestAppendLog_FailureEndsWriter(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.wal.Close())
+
+	_, err := tb.Insert(map[string]interface{}{"id": int32(6), "username": "erin", "age": int64(33)})
+	assert.NotNil(t, err)
+	// the writer started for the failed write holds no version back
+	assert.Zero(t, tb.writeTx)
+	id := tb.txs.Begin()
+	tb.txs.End(id)
+	assert.Equal(t, id+1, tb.txs.Horizon())
+}
@@ -0,0 +1,92 @@
+package table
+
+import (
+	"fmt"
+
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// The Returning variants of Insert, Update and Delete give back the affected
+// records projected on columns, like a RETURNING clause. Every column is
+// returned when columns is empty.
+
+// InsertReturning inserts record and returns it.
+func (t *Table) InsertReturning(record map[string]interface{}, columns ...string) (map[string]interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.validateReturning(columns); err != nil {
+		return nil, fmt.Errorf("Table.InsertReturning: %w", err)
+	}
+	if _, err := t.insert(record); err != nil {
+		return nil, fmt.Errorf("Table.InsertReturning: %w", err)
+	}
+	return project(record, columns), nil
+}
+
+// UpdateReturning runs Update and returns the records after the update.
+func (t *Table) UpdateReturning(
+	whereStmt predicate.Predicate,
+	values map[string]interface{},
+	columns ...string,
+) ([]map[string]interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.validateReturning(columns); err != nil {
+		return nil, fmt.Errorf("Table.UpdateReturning: %w", err)
+	}
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.UpdateReturning: %w", err)
+	}
+	values, err = t.validateAssignments(values)
+	if err != nil {
+		return nil, fmt.Errorf("Table.UpdateReturning: %w", err)
+	}
+	updated, err := t.update(whereStmt, values, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Table.UpdateReturning: %w", err)
+	}
+	return projectAll(updated, columns), nil
+}
+
+// DeleteReturning runs Delete and returns the deleted records.
+func (t *Table) DeleteReturning(whereStmt predicate.Predicate, columns ...string) ([]map[string]interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.validateReturning(columns); err != nil {
+		return nil, fmt.Errorf("Table.DeleteReturning: %w", err)
+	}
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.DeleteReturning: %w", err)
+	}
+	deletableRecords, err := t.findDeletableRecords(whereStmt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Table.DeleteReturning: %w", err)
+	}
+	if _, err := t.deleteRecords(deletableRecords); err != nil {
+		return nil, fmt.Errorf("Table.DeleteReturning: %w", err)
+	}
+	deleted := make([]map[string]interface{}, 0, len(deletableRecords))
+	for _, rec := range deletableRecords {
+		deleted = append(deleted, rec.values)
+	}
+	return projectAll(deleted, columns), nil
+}
+
+func (t *Table) validateReturning(columns []string) error {
+	for _, col := range columns {
+		if _, ok := t.columns[col]; !ok {
+			return fmt.Errorf("Table.validateReturning: unknown column in returning: %s", col)
+		}
+	}
+	return nil
+}
+
+func projectAll(records []map[string]interface{}, columns []string) []map[string]interface{} {
+	projected := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		projected = append(projected, project(record, columns))
+	}
+	return projected
+}
@@ -0,0 +1,289 @@
+package table
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/table/mvcc"
+	"github.com/9bany/db/internal/table/predicate"
+)
+
+// Rows is a cursor over the records of a table matching a where statement.
+// Records are read lazily, one per call to Next. The cursor reads the file
+// through an offset of its own so other table operations, including other
+// cursors in other goroutines, may run between and during calls. It
+// reads a snapshot of the table taken when it was opened: changes committed
+// afterwards are not seen, and the snapshot holds the versions it sees
+// until the cursor is closed or exhausted.
+//
+//	rows, err := t.SelectRows(where)
+//	...
+//	defer rows.Close()
+//	for rows.Next() {
+//		record := rows.Values()
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type Rows struct {
+	table     *Table
+	whereStmt predicate.Predicate
+
+	// offsets is set when the cursor follows an index instead of scanning
+	// the whole file.
+	offsets   []int64
+	indexed   bool
+	pagesRead int64
+
+	// snapshot is nil when the cursor reads the latest version of every
+	// record, as writers do
+	snapshot *mvcc.Snapshot
+	// ownSnapshot is set when the cursor releases snapshot once closed
+	ownSnapshot bool
+
+	// records parses the file read through file at pos
+	records *parser.RecordParser
+	file    io.ReadSeeker
+
+	pos     int64
+	offset  int64
+	current *parser.RawRecord
+	err     error
+	closed  bool
+}
+
+// SelectRows returns a cursor over every record matching whereStmt.
+func (t *Table) SelectRows(whereStmt predicate.Predicate) (*Rows, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.selectRows(whereStmt)
+}
+
+func (t *Table) selectRows(whereStmt predicate.Predicate) (*Rows, error) {
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Table.SelectRows: %w", err)
+	}
+	snapshot := t.txs.Snapshot()
+	rows, err := t.openRows(whereStmt, snapshot)
+	if err != nil {
+		t.txs.Release(snapshot)
+		return nil, fmt.Errorf("Table.SelectRows: %w", err)
+	}
+	rows.ownSnapshot = true
+	return rows, nil
+}
+
+// openRows returns a cursor for an already validated where statement,
+// reading snapshot or the latest records when it is nil.
+func (t *Table) openRows(whereStmt predicate.Predicate, snapshot *mvcc.Snapshot) (*Rows, error) {
+	records, file := t.newCursor()
+	rows := &Rows{
+		table:     t,
+		whereStmt: whereStmt,
+		snapshot:  snapshot,
+		records:   records,
+		file:      file,
+	}
+	// the indexes hold the latest records only
+	current := snapshot == nil || t.versions.Current(snapshot)
+	if path := t.chooseAccessPath(whereStmt); current && path.index != nil {
+		offsets, err := path.index.Lookup(path.value)
+		if err != nil {
+			return nil, fmt.Errorf("Table.openRows: %w", err)
+		}
+		rows.offsets = offsets
+		rows.indexed = true
+		return rows, nil
+	}
+	pos, err := firstPage(file)
+	if err != nil {
+		return nil, fmt.Errorf("Table.openRows: %w", err)
+	}
+	rows.pos = pos
+	return rows, nil
+}
+
+// Next advances to the next matching record. It returns false when the
+// cursor is exhausted, closed or an error occurred.
+func (r *Rows) Next() bool {
+	r.table.mu.RLock()
+	defer r.table.mu.RUnlock()
+	return r.next()
+}
+
+// next is Next for callers already holding the lock of the table.
+func (r *Rows) next() bool {
+	if r.closed || r.err != nil {
+		return false
+	}
+	t := r.table
+	for {
+		if r.indexed {
+			if len(r.offsets) == 0 {
+				r.Close()
+				return false
+			}
+			r.pos = r.offsets[0]
+			r.offsets = r.offsets[1:]
+			// every index lookup lands on a page of its own
+			r.pagesRead++
+		}
+		if _, err := r.file.Seek(r.pos, io.SeekStart); err != nil {
+			r.err = fmt.Errorf("Rows.Next: %w", err)
+			return false
+		}
+		pagesBefore := r.records.PagesRead
+		r.records.KeepDeleted = r.snapshot != nil
+		err := r.records.Parse()
+		if !r.indexed {
+			r.pagesRead += r.records.PagesRead - pagesBefore
+		}
+		if err == io.EOF {
+			r.Close()
+			return false
+		}
+		if err != nil {
+			r.err = fmt.Errorf("Rows.Next: %w", err)
+			return false
+		}
+		pos, err := r.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			r.err = fmt.Errorf("Rows.Next: %w", err)
+			return false
+		}
+		r.pos = pos
+
+		rawRecord := r.records.Value
+		if r.snapshot != nil {
+			var visible bool
+			if rawRecord, visible = r.version(pos-int64(rawRecord.FullSize), rawRecord); !visible {
+				continue
+			}
+		}
+		if err = t.ensureColumnLength(rawRecord.Values); err != nil {
+			r.err = fmt.Errorf("Rows.Next: %w", err)
+			return false
+		}
+		ok, err := t.evaluateWhereStmt(r.whereStmt, rawRecord.Values)
+		if err != nil {
+			r.err = fmt.Errorf("Rows.Next: %w", err)
+			return false
+		}
+		if ok {
+			r.current = rawRecord
+			r.offset = pos - int64(rawRecord.FullSize)
+			return true
+		}
+	}
+}
+
+// version returns the version of the record at offset seen by the
+// snapshot of the cursor.
+func (r *Rows) version(offset int64, record *parser.RawRecord) (*parser.RawRecord, bool) {
+	values, ok := r.table.versions.Read(offset, record.Values, r.snapshot)
+	if !ok {
+		return nil, false
+	}
+	return &parser.RawRecord{
+		Size:     record.Size,
+		FullSize: record.FullSize,
+		Values:   values,
+	}, true
+}
+
+// Values returns the current record keyed by column name.
+func (r *Rows) Values() map[string]interface{} {
+	if r.current == nil {
+		return nil
+	}
+	return r.current.Values
+}
+
+// Columns returns the column names in the order used by Scan.
+func (r *Rows) Columns() []string {
+	return r.table.columnNames
+}
+
+// Scan copies the columns of the current record into dest in table column
+// order. Every dest must be a pointer to the column's Go type or to an
+// interface{}.
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.current == nil {
+		return fmt.Errorf("Rows.Scan: Scan called without calling Next")
+	}
+	columns := r.Columns()
+	if len(dest) != len(columns) {
+		return fmt.Errorf("Rows.Scan: expected %d destination arguments, got %d", len(columns), len(dest))
+	}
+	for i, col := range columns {
+		if err := assign(dest[i], r.current.Values[col]); err != nil {
+			return fmt.Errorf("Rows.Scan: column %s: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// PagesRead returns the number of pages the cursor has touched so far.
+func (r *Rows) PagesRead() int64 {
+	return r.pagesRead
+}
+
+// Err returns the error, if any, that stopped the iteration.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close stops the iteration. It is safe to call Close more than once.
+func (r *Rows) Close() error {
+	r.closed = true
+	r.current = nil
+	if r.ownSnapshot {
+		r.table.txs.Release(r.snapshot)
+		r.ownSnapshot = false
+		r.table.CollectGarbage()
+	}
+	return nil
+}
+
+func assign(dest interface{}, v interface{}) error {
+	switch d := dest.(type) {
+	case *interface{}:
+		*d = v
+		return nil
+	case *int32:
+		if n, ok := v.(int32); ok {
+			*d = n
+			return nil
+		}
+	case *int64:
+		if n, ok := v.(int64); ok {
+			*d = n
+			return nil
+		}
+	case *byte:
+		if n, ok := v.(byte); ok {
+			*d = n
+			return nil
+		}
+	case *bool:
+		if b, ok := v.(bool); ok {
+			*d = b
+			return nil
+		}
+	case *float64:
+		if f, ok := v.(float64); ok {
+			*d = f
+			return nil
+		}
+	case *string:
+		if s, ok := v.(string); ok {
+			*d = s
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported destination type %T", dest)
+	}
+	return fmt.Errorf("cannot assign %T to %T", v, dest)
+}
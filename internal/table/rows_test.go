@@ -0,0 +1,103 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRows_Scan(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.SelectRows(predicate.HasPrefix("username", "b"))
+	assert.Nil(t, err)
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var (
+			id   int32
+			name string
+			age  int64
+		)
+		assert.Nil(t, rows.Scan(&id, &name, &age))
+		assert.Equal(t, rows.Values()["age"], age)
+		names = append(names, name)
+	}
+	assert.Nil(t, rows.Err())
+	assert.Equal(t, []string{"bany", "bob", "barbara"}, names)
+	assert.False(t, rows.Next())
+}
+
+func TestRows_InterleavedWrites(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.SelectRows(predicate.Lt("id", int32(100)))
+	assert.Nil(t, err)
+	defer rows.Close()
+
+	seen := 0
+	for rows.Next() {
+		seen++
+		// writes between calls must not disturb the cursor position
+		_, err := tb.Insert(map[string]interface{}{"id": int32(100 + seen), "username": "new", "age": int64(1)})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, rows.Err())
+	assert.Equal(t, 5, seen)
+}
+
+func TestRows_Close(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.SelectRows(nil)
+	assert.Nil(t, err)
+	assert.True(t, rows.Next())
+	assert.NotNil(t, rows.Scan(new(int32)))
+	assert.Nil(t, rows.Close())
+	assert.False(t, rows.Next())
+	assert.NotNil(t, rows.Scan(new(int32), new(string), new(int64)))
+}
+
+func TestRows_Snapshot(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	rows, err := tb.SelectRows(nil)
+	assert.Nil(t, err)
+	assert.True(t, rows.Next())
+	assert.Equal(t, "bany", rows.Values()["username"])
+
+	// updated in place, relocated, deleted and inserted after the cursor
+	// was opened
+	_, err = tb.Update(predicate.Eq("id", int32(2)), map[string]interface{}{"username": "alisa"})
+	assert.Nil(t, err)
+	_, err = tb.Update(predicate.Eq("id", int32(3)), map[string]interface{}{"username": "bobby-tables"})
+	assert.Nil(t, err)
+	_, err = tb.Delete(predicate.Eq("id", int32(4)))
+	assert.Nil(t, err)
+	_, err = tb.Insert(map[string]interface{}{"id": int32(6), "username": "dave", "age": int64(50)})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, tb.versions.Len())
+
+	names := []string{"bany"}
+	for rows.Next() {
+		names = append(names, rows.Values()["username"].(string))
+	}
+	assert.Nil(t, rows.Err())
+	assert.Equal(t, []string{"bany", "alice", "bob", "barbara", "carol"}, names)
+	// the exhausted cursor released its snapshot
+	assert.Zero(t, tb.versions.Len())
+
+	records, err := tb.Select(nil)
+	assert.Nil(t, err)
+	names = make([]string, 0)
+	for _, record := range records {
+		names = append(names, record["username"].(string))
+	}
+	assert.Equal(t, []string{"bany", "alisa", "carol", "bobby-tables", "dave"}, names)
+}
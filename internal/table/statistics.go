@@ -0,0 +1,157 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/stats"
+)
+
+const StatsFilenameTmpl = "%s_stats.bin"
+
+// Analyze scans the table, collects per column statistics and stores them
+// in the catalog file of the table. The planner uses them from then on.
+func (t *Table) Analyze() (*stats.TableStats, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	collector := stats.NewCollector(t.columnNames, stats.DefaultSampleSize)
+	err := t.scan(nil, func(_ int64, record *parser.RawRecord) (bool, error) {
+		return true, collector.Add(record.Values)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Table.Analyze: %w", err)
+	}
+	s, err := collector.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("Table.Analyze: %w", err)
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("Table.Analyze: %w", err)
+	}
+	if err := t.fs.WriteFile(t.statsPath(), data, 0644); err != nil {
+		return nil, fmt.Errorf("Table.Analyze: %w", err)
+	}
+	t.stats = s
+	return s, nil
+}
+
+// LoadStatistics reads the statistics stored by the last Analyze, if any.
+func (t *Table) LoadStatistics() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, err := t.fs.ReadFile(t.statsPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Table.LoadStatistics: %w", err)
+	}
+	s := &stats.TableStats{}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("Table.LoadStatistics: %w", err)
+	}
+	t.stats = s
+	return nil
+}
+
+// Statistics returns the statistics of the last Analyze or nil.
+func (t *Table) Statistics() *stats.TableStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stats
+}
+
+func (t *Table) statsPath() string {
+	return filepath.Join(filepath.Dir(t.file.Name()), fmt.Sprintf(StatsFilenameTmpl, t.Name))
+}
+
+// PlanStatistics returns the statistics the planner uses for the columns of
+// the table.
+func (t *Table) PlanStatistics() plan.Statistics {
+	return lockedStatistics{t: t}
+}
+
+// lockedStatistics is tableStatistics for callers outside the table, which
+// do not hold its lock.
+type lockedStatistics struct {
+	t *Table
+}
+
+func (s lockedStatistics) EqualSelectivity(column string, v interface{}) (float64, bool) {
+	s.t.mu.RLock()
+	defer s.t.mu.RUnlock()
+	return tableStatistics(s).EqualSelectivity(column, v)
+}
+
+func (s lockedStatistics) RangeSelectivity(column string, lo, hi interface{}, loInclusive, hiInclusive bool) (float64, bool) {
+	s.t.mu.RLock()
+	defer s.t.mu.RUnlock()
+	return tableStatistics(s).RangeSelectivity(column, lo, hi, loInclusive, hiInclusive)
+}
+
+func (s lockedStatistics) NullFraction(column string) (float64, bool) {
+	s.t.mu.RLock()
+	defer s.t.mu.RUnlock()
+	return tableStatistics(s).NullFraction(column)
+}
+
+// tableStatistics feeds the planner with analyzed statistics and falls back
+// to the distinct counts maintained by indexes.
+type tableStatistics struct {
+	t *Table
+}
+
+func (s tableStatistics) EqualSelectivity(column string, v interface{}) (float64, bool) {
+	if s.t.stats != nil {
+		if sel, ok := s.t.stats.EqualSelectivity(column, v); ok {
+			return sel, true
+		}
+	}
+	if idx := s.t.indexes[column]; idx != nil && idx.Distinct() > 0 {
+		return 1 / float64(idx.Distinct()), true
+	}
+	return 0, false
+}
+
+func (s tableStatistics) RangeSelectivity(column string, lo, hi interface{}, loInclusive, hiInclusive bool) (float64, bool) {
+	if s.t.stats == nil {
+		return 0, false
+	}
+	return s.t.stats.RangeSelectivity(column, lo, hi, loInclusive, hiInclusive)
+}
+
+func (s tableStatistics) NullFraction(column string) (float64, bool) {
+	if s.t.stats == nil {
+		return 0, false
+	}
+	return s.t.stats.NullFraction(column)
+}
+
+// EstimateRows returns the estimated number of records of the table.
+func (t *Table) EstimateRows() float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.estimateRowCount()
+}
+
+// EstimateDistinct returns the estimated number of distinct values of
+// column or zero when nothing is known about it.
+func (t *Table) EstimateDistinct(column string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if idx := t.indexes[column]; idx != nil {
+		return float64(idx.Distinct())
+	}
+	if t.stats != nil {
+		if d, ok := t.stats.Distinct(column); ok {
+			return float64(d)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package table
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyze_StatisticsDriveIndexChoice(t *testing.T) {
+	tb := newTestTable(t)
+	for i := 0; i < 60; i++ {
+		age := int64(30)
+		if i%20 == 0 {
+			age = int64(60 + i)
+		}
+		_, err := tb.Insert(map[string]interface{}{
+			"id": int32(i), "username": fmt.Sprintf("user%d", i), "age": age,
+		})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tb.CreateIndex("id", false))
+	assert.Nil(t, tb.CreateIndex("age", false))
+
+	// without statistics any index beats a sequential scan
+	node, err := tb.Explain(Query{Where: predicate.Eq("age", int64(30))}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpIndexScan, node.Operator)
+
+	s, err := tb.Analyze()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(60), s.RowCount)
+	assert.Equal(t, int64(4), s.Columns["age"].Distinct)
+
+	node, err = tb.Explain(Query{Where: predicate.Eq("age", int64(30))}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpSeqScan, node.Operator)
+	assert.Equal(t, int64(57), node.ActualRows)
+
+	node, err = tb.Explain(Query{Where: predicate.And(
+		predicate.Eq("age", int64(30)),
+		predicate.Eq("id", int32(7)),
+	)}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, plan.OpIndexScan, node.Operator)
+	assert.Equal(t, "id", node.Index)
+	assert.Equal(t, int64(1), node.ActualRows)
+
+	node, err = tb.Explain(Query{Where: predicate.Lt("age", int64(50))}, false)
+	assert.Nil(t, err)
+	assert.InDelta(t, 57, node.EstimatedRows, 6)
+
+	// statistics survive reopening the table
+	tb.stats = nil
+	assert.Nil(t, tb.LoadStatistics())
+	assert.Equal(t, s, tb.Statistics())
+}
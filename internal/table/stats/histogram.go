@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"github.com/9bany/db/internal/platform/types"
+)
+
+// DefaultBuckets is the number of buckets of an equi-depth histogram.
+const DefaultBuckets = 20
+
+// Histogram is an equi-depth histogram: every bucket between two adjacent
+// bounds holds roughly the same number of values.
+type Histogram struct {
+	Bounds []interface{}
+}
+
+// NewHistogram builds a histogram from sorted non null values.
+func NewHistogram(sorted []interface{}, buckets int) *Histogram {
+	if len(sorted) == 0 {
+		return &Histogram{}
+	}
+	if buckets <= 0 {
+		buckets = DefaultBuckets
+	}
+	if buckets > len(sorted) {
+		buckets = len(sorted)
+	}
+	bounds := make([]interface{}, 0, buckets+1)
+	for i := 0; i <= buckets; i++ {
+		pos := i * (len(sorted) - 1) / buckets
+		bounds = append(bounds, sorted[pos])
+	}
+	return &Histogram{Bounds: bounds}
+}
+
+// LessFraction returns the fraction of values smaller than v, or smaller or
+// equal when inclusive is set.
+func (h *Histogram) LessFraction(v interface{}, inclusive bool) (float64, error) {
+	n := len(h.Bounds)
+	if n < 2 {
+		return 0.5, nil
+	}
+	buckets := float64(n - 1)
+	for i := 0; i < n; i++ {
+		cmp, err := types.Compare(v, h.Bounds[i])
+		if err != nil {
+			return 0, err
+		}
+		if cmp < 0 || (cmp == 0 && !inclusive) {
+			if i == 0 {
+				return 0, nil
+			}
+			return (float64(i-1) + interpolate(h.Bounds[i-1], h.Bounds[i], v)) / buckets, nil
+		}
+	}
+	return 1, nil
+}
+
+// interpolate returns the position of v between lo and hi in [0, 1].
+// Non numeric values are assumed to sit in the middle of the bucket.
+func interpolate(lo, hi, v interface{}) float64 {
+	l, ok1 := toFloat(lo)
+	h, ok2 := toFloat(hi)
+	x, ok3 := toFloat(v)
+	if !ok1 || !ok2 || !ok3 || h <= l {
+		return 0.5
+	}
+	return (x - l) / (h - l)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case byte:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultPrecision uses 2^12 registers, a standard error of about 1.6%.
+const DefaultPrecision = 12
+
+// HyperLogLog estimates the number of distinct values it has seen in
+// constant memory.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 || precision > 16 {
+		precision = DefaultPrecision
+	}
+	return &HyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+func (h *HyperLogLog) Add(data []byte) {
+	hasher := fnv.New64a()
+	hasher.Write(data)
+	x := mix(hasher.Sum64())
+
+	idx := x >> (64 - h.precision)
+	// the remaining bits with a sentinel so the rank is bounded
+	rest := x<<h.precision | 1<<(h.precision-1)
+	rank := uint8(bits.LeadingZeros64(rest)) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Estimate returns the approximate number of distinct values added.
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(m) * m * m / sum
+	// small range correction
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func alpha(m float64) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/m)
+}
+
+// mix spreads fnv output over all 64 bits (splitmix64 finalizer).
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,334 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/index"
+)
+
+// DefaultSampleSize is the number of records kept to build histograms.
+const DefaultSampleSize = 10000
+
+type ColumnStats struct {
+	Column       string
+	NullFraction float64
+	// Distinct is the estimated number of distinct non null values.
+	Distinct int64
+	// Min and Max are nil when every value is null.
+	Min       interface{}
+	Max       interface{}
+	Histogram *Histogram
+}
+
+// TableStats are the statistics collected by ANALYZE.
+type TableStats struct {
+	RowCount int64
+	Columns  map[string]*ColumnStats
+}
+
+// Collector gathers statistics from a stream of records. Counts and
+// distinct estimates see every record, histograms are built from a
+// reservoir sample.
+type Collector struct {
+	columns    []string
+	sampleSize int
+	rows       int64
+	nulls      map[string]int64
+	sketches   map[string]*HyperLogLog
+	min        map[string]interface{}
+	max        map[string]interface{}
+	sample     []map[string]interface{}
+	rnd        *rand.Rand
+}
+
+func NewCollector(columns []string, sampleSize int) *Collector {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	c := &Collector{
+		columns:    columns,
+		sampleSize: sampleSize,
+		nulls:      make(map[string]int64),
+		sketches:   make(map[string]*HyperLogLog),
+		min:        make(map[string]interface{}),
+		max:        make(map[string]interface{}),
+		// a fixed seed keeps ANALYZE deterministic
+		rnd: rand.New(rand.NewSource(1)),
+	}
+	for _, col := range columns {
+		c.sketches[col] = NewHyperLogLog(DefaultPrecision)
+	}
+	return c
+}
+
+func (c *Collector) Add(record map[string]interface{}) error {
+	c.rows++
+	for _, col := range c.columns {
+		v := record[col]
+		if v == nil {
+			c.nulls[col]++
+			continue
+		}
+		key, err := index.Key(v)
+		if err != nil {
+			return fmt.Errorf("Collector.Add: %w", err)
+		}
+		c.sketches[col].Add([]byte(key))
+
+		if err := c.updateBounds(col, v); err != nil {
+			return fmt.Errorf("Collector.Add: %w", err)
+		}
+	}
+
+	if len(c.sample) < c.sampleSize {
+		c.sample = append(c.sample, record)
+	} else if i := c.rnd.Int63n(c.rows); i < int64(c.sampleSize) {
+		c.sample[i] = record
+	}
+	return nil
+}
+
+func (c *Collector) updateBounds(col string, v interface{}) error {
+	if m, ok := c.min[col]; !ok {
+		c.min[col] = v
+	} else if cmp, err := types.Compare(v, m); err != nil {
+		return err
+	} else if cmp < 0 {
+		c.min[col] = v
+	}
+	if m, ok := c.max[col]; !ok {
+		c.max[col] = v
+	} else if cmp, err := types.Compare(v, m); err != nil {
+		return err
+	} else if cmp > 0 {
+		c.max[col] = v
+	}
+	return nil
+}
+
+// Stats returns the statistics of every record added so far.
+func (c *Collector) Stats() (*TableStats, error) {
+	s := &TableStats{RowCount: c.rows, Columns: make(map[string]*ColumnStats)}
+	for _, col := range c.columns {
+		cs := &ColumnStats{
+			Column: col,
+			Min:    c.min[col],
+			Max:    c.max[col],
+		}
+		if c.rows > 0 {
+			cs.NullFraction = float64(c.nulls[col]) / float64(c.rows)
+		}
+		nonNull := c.rows - c.nulls[col]
+		cs.Distinct = int64(c.sketches[col].Estimate())
+		if cs.Distinct > nonNull {
+			cs.Distinct = nonNull
+		}
+
+		values := make([]interface{}, 0, len(c.sample))
+		for _, record := range c.sample {
+			if v := record[col]; v != nil {
+				values = append(values, v)
+			}
+		}
+		var sortErr error
+		sort.SliceStable(values, func(i, j int) bool {
+			cmp, err := types.Compare(values[i], values[j])
+			if err != nil {
+				sortErr = err
+			}
+			return cmp < 0
+		})
+		if sortErr != nil {
+			return nil, fmt.Errorf("Collector.Stats: %w", sortErr)
+		}
+		cs.Histogram = NewHistogram(values, DefaultBuckets)
+		s.Columns[col] = cs
+	}
+	return s, nil
+}
+
+// EqualSelectivity estimates the fraction of rows where column equals v.
+func (s *TableStats) EqualSelectivity(column string, v interface{}) (float64, bool) {
+	cs, ok := s.Columns[column]
+	if !ok || s.RowCount == 0 {
+		return 0, false
+	}
+	if cs.Distinct == 0 {
+		return 0, true
+	}
+	if cs.Min != nil {
+		lo, err1 := types.Compare(v, cs.Min)
+		hi, err2 := types.Compare(v, cs.Max)
+		if err1 == nil && err2 == nil && (lo < 0 || hi > 0) {
+			return 0, true
+		}
+	}
+	return (1 - cs.NullFraction) / float64(cs.Distinct), true
+}
+
+// RangeSelectivity estimates the fraction of rows where column lies between
+// lo and hi. A nil bound is unbounded.
+func (s *TableStats) RangeSelectivity(column string, lo, hi interface{}, loInclusive, hiInclusive bool) (float64, bool) {
+	cs, ok := s.Columns[column]
+	if !ok || s.RowCount == 0 || cs.Histogram == nil {
+		return 0, false
+	}
+	upper, lower := 1.0, 0.0
+	var err error
+	if hi != nil {
+		if upper, err = cs.Histogram.LessFraction(hi, hiInclusive); err != nil {
+			return 0, false
+		}
+	}
+	if lo != nil {
+		if lower, err = cs.Histogram.LessFraction(lo, !loInclusive); err != nil {
+			return 0, false
+		}
+	}
+	return math.Max(0, upper-lower) * (1 - cs.NullFraction), true
+}
+
+func (s *TableStats) NullFraction(column string) (float64, bool) {
+	cs, ok := s.Columns[column]
+	if !ok {
+		return 0, false
+	}
+	return cs.NullFraction, true
+}
+
+// Distinct returns the estimated number of distinct values of column.
+func (s *TableStats) Distinct(column string) (int64, bool) {
+	cs, ok := s.Columns[column]
+	if !ok {
+		return 0, false
+	}
+	return cs.Distinct, true
+}
+
+// MarshalBinary encodes the statistics as a sequence of TLV values ordered
+// by column name.
+func (s *TableStats) MarshalBinary() ([]byte, error) {
+	names := make([]string, 0, len(s.Columns))
+	for name := range s.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	write := func(v interface{}) error {
+		data, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	if err := write(s.RowCount); err != nil {
+		return nil, fmt.Errorf("TableStats.MarshalBinary: %w", err)
+	}
+	for _, name := range names {
+		cs := s.Columns[name]
+		values := []interface{}{cs.Column, cs.NullFraction, cs.Distinct, cs.Min != nil}
+		if cs.Min != nil {
+			values = append(values, cs.Min, cs.Max)
+		}
+		var bounds []interface{}
+		if cs.Histogram != nil {
+			bounds = cs.Histogram.Bounds
+		}
+		values = append(values, int64(len(bounds)))
+		values = append(values, bounds...)
+		for _, v := range values {
+			if err := write(v); err != nil {
+				return nil, fmt.Errorf("TableStats.MarshalBinary: %w", err)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *TableStats) UnmarshalBinary(data []byte) error {
+	d := &decoder{parser: parser.NewTLVParser(parserio.NewReader(bytes.NewReader(data)))}
+	s.RowCount = d.int64()
+	s.Columns = make(map[string]*ColumnStats)
+	for d.err == nil {
+		name := d.value()
+		if errors.Is(d.err, io.EOF) {
+			return nil
+		}
+		column, ok := name.(string)
+		if !ok {
+			d.fail(name)
+			break
+		}
+		cs := &ColumnStats{Column: column, NullFraction: d.float64(), Distinct: d.int64()}
+		if d.bool() {
+			cs.Min = d.value()
+			cs.Max = d.value()
+		}
+		cs.Histogram = &Histogram{}
+		for n := d.int64(); n > 0 && d.err == nil; n-- {
+			cs.Histogram.Bounds = append(cs.Histogram.Bounds, d.value())
+		}
+		s.Columns[column] = cs
+	}
+	return fmt.Errorf("TableStats.UnmarshalBinary: %w", d.err)
+}
+
+// decoder reads consecutive TLV values and remembers the first error.
+type decoder struct {
+	parser *parser.TLVParser
+	err    error
+}
+
+func (d *decoder) value() interface{} {
+	if d.err != nil {
+		return nil
+	}
+	v, err := d.parser.Parse()
+	d.err = err
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	v := d.value()
+	n, ok := v.(int64)
+	if !ok {
+		d.fail(v)
+	}
+	return n
+}
+
+func (d *decoder) float64() float64 {
+	v := d.value()
+	f, ok := v.(float64)
+	if !ok {
+		d.fail(v)
+	}
+	return f
+}
+
+func (d *decoder) bool() bool {
+	v := d.value()
+	b, ok := v.(bool)
+	if !ok {
+		d.fail(v)
+	}
+	return b
+}
+
+func (d *decoder) fail(v interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("unexpected value %v in statistics", v)
+	}
+}
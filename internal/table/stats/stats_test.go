@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog_Estimate(t *testing.T) {
+	h := NewHyperLogLog(DefaultPrecision)
+	for i := 0; i < 50000; i++ {
+		h.Add([]byte(fmt.Sprintf("value-%d", i%20000)))
+	}
+	assert.InEpsilon(t, 20000, float64(h.Estimate()), 0.05)
+
+	small := NewHyperLogLog(DefaultPrecision)
+	for i := 0; i < 10; i++ {
+		small.Add([]byte(fmt.Sprint(i)))
+	}
+	assert.Equal(t, uint64(10), small.Estimate())
+}
+
+func TestHistogram_LessFraction(t *testing.T) {
+	values := make([]interface{}, 0, 100)
+	for i := int64(1); i <= 100; i++ {
+		values = append(values, i)
+	}
+	h := NewHistogram(values, 10)
+	assert.Len(t, h.Bounds, 11)
+
+	f, err := h.LessFraction(int64(50), false)
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.5, f, 0.02)
+	f, err = h.LessFraction(int64(0), true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, f)
+	f, err = h.LessFraction(int64(100), true)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, f)
+	_, err = h.LessFraction("x", true)
+	assert.NotNil(t, err)
+}
+
+func TestCollector_Stats(t *testing.T) {
+	c := NewCollector([]string{"id", "name"}, 50)
+	for i := 0; i < 200; i++ {
+		var name interface{}
+		if i%4 != 0 {
+			name = fmt.Sprintf("user-%d", i%10)
+		}
+		assert.Nil(t, c.Add(map[string]interface{}{"id": int32(i), "name": name}))
+	}
+	s, err := c.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(200), s.RowCount)
+	assert.Equal(t, int32(0), s.Columns["id"].Min)
+	assert.Equal(t, int32(199), s.Columns["id"].Max)
+	assert.Equal(t, int64(200), s.Columns["id"].Distinct)
+	assert.Equal(t, 0.25, s.Columns["name"].NullFraction)
+	assert.Equal(t, int64(10), s.Columns["name"].Distinct)
+
+	sel, ok := s.EqualSelectivity("name", "user-1")
+	assert.True(t, ok)
+	assert.InDelta(t, 0.075, sel, 0.001)
+	sel, ok = s.EqualSelectivity("id", int32(500))
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, sel)
+	sel, ok = s.RangeSelectivity("id", nil, int32(50), false, false)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.25, sel, 0.1)
+	_, ok = s.EqualSelectivity("missing", 1)
+	assert.False(t, ok)
+
+	data, err := s.MarshalBinary()
+	assert.Nil(t, err)
+	decoded := &TableStats{}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, s, decoded)
+}
@@ -5,17 +5,25 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
-	"slices"
+	"math"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/9bany/db/internal/platform/collate"
 	"github.com/9bany/db/internal/platform/parser"
 	"github.com/9bany/db/internal/platform/parser/encoding"
 	parserio "github.com/9bany/db/internal/platform/parser/io"
 	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/platform/vfs"
 	"github.com/9bany/db/internal/table/column"
 	columnio "github.com/9bany/db/internal/table/column/io"
+	"github.com/9bany/db/internal/table/fulltext"
 	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/mvcc"
+	"github.com/9bany/db/internal/table/plan"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/stats"
 	"github.com/9bany/db/internal/table/wal"
 	walencoding "github.com/9bany/db/internal/table/wal/encoding"
 )
@@ -31,29 +39,59 @@ type Columns map[string]*column.Column
 type DeletableRecord struct {
 	offset int64
 	l      uint32
+	values map[string]interface{}
 }
 
 func newDeletableRecord(offset int64,
-	l uint32) *DeletableRecord {
+	l uint32,
+	values map[string]interface{}) *DeletableRecord {
 	return &DeletableRecord{
 		offset: offset,
 		l:      l,
+		values: values,
 	}
 }
 
+// Table is safe for concurrent use: readers share mu and read the file
+// through cursors of their own, writers hold mu exclusively and are the
+// only ones moving the offset of file.
 type Table struct {
 	Name        string
-	file        *os.File
+	file        vfs.File
 	columnNames []string
 	columns     Columns
 
+	mu               sync.RWMutex
 	reader           *parserio.Reader
 	columnsDefReader *columnio.ColumnDefinitionReader
-	recordParser     *parser.RecordParser
 	wal              *wal.WAL
+	indexes          map[string]*index.Index
+	fullText         map[string]*fulltext.Index
+	// stats are the statistics of the last Analyze, nil before that
+	stats *stats.TableStats
+	// fs holds the files of the table besides file
+	fs vfs.FS
+
+	// txs hands out the writers and snapshots of the table, shared with
+	// the other tables of the database
+	txs      *mvcc.Manager
+	versions *mvcc.Store
+	// writeTx is the writer of the operation being applied, 0 when none
+	writeTx int64
+
+	// pages is the page directory, nil until loaded by pageDirectory
+	pages []int64
+	// lsn is the log entry of the operation being applied, the pages it
+	// writes are stamped with it. 0 when none
+	lsn int64
+	// touched holds the pages written since they were last stamped
+	touched map[int64]struct{}
+	// stale caches, while an entry is redone or undone, whether each page
+	// it writes is older than it. nil otherwise
+	stale map[int64]bool
 }
 
-func NewTable(f *os.File,
+func NewTable(f vfs.File,
 	r *parserio.Reader,
 	columnDefReader *columnio.ColumnDefinitionReader,
 	wal *wal.WAL) (*Table, error) {
@@ -71,10 +109,15 @@ func NewTable(f *os.File,
 		columns:          make(Columns),
 		columnNames:      make([]string, 0),
 		wal:              wal,
+		indexes:          make(map[string]*index.Index),
+		fullText:         make(map[string]*fulltext.Index),
+		txs:              mvcc.NewManager(),
+		versions:         mvcc.NewStore(),
+		fs:               vfs.OS{},
 	}, nil
 }
 
-func NewTableWithColumns(f *os.File, columns Columns, columnNames []string) (*Table, error) {
+func NewTableWithColumns(f vfs.File, columns Columns, columnNames []string) (*Table, error) {
 	if len(columns) == 0 {
 		return nil, NewCannotCreateTableError(nil, "table must have at least one column")
 	}
@@ -83,6 +126,12 @@ func NewTableWithColumns(f *os.File, columns Columns, columnNames []string) (*Ta
 		if len(col.Name) == 0 {
 			return nil, NewCannotCreateTableError(nil, "column name cannot be empty")
 		}
+		if !col.Collation().Valid() {
+			return nil, NewCannotCreateTableError(nil, fmt.Sprintf("column %s: unknown collation %s", col.NameToStr(), col.Collation()))
+		}
+		if col.Collation() != collate.Binary && col.DataType() != types.TypeString {
+			return nil, NewCannotCreateTableError(nil, fmt.Sprintf("column %s: collations apply to string columns only", col.NameToStr()))
+		}
 	}
 
 	return &Table{
@@ -90,9 +139,20 @@ func NewTableWithColumns(f *os.File, columns Columns, columnNames []string) (*Ta
 		file:        f,
 		columnNames: columnNames,
 		columns:     columns,
+		indexes:     make(map[string]*index.Index),
+		fullText:    make(map[string]*fulltext.Index),
+		txs:         mvcc.NewManager(),
+		versions:    mvcc.NewStore(),
+		fs:          vfs.OS{},
 	}, nil
 }
 
+// SetFS makes the table keep its index definitions, statistics and other
+// files besides the table file in fsys, the file system of its database.
+func (t *Table) SetFS(fsys vfs.FS) {
+	t.fs = fsys
+}
+
 func (t *Table) String() string {
 	return fmt.Sprintf("Table{Name: %s, Columns: %v}", t.Name, t.columnNames)
 }
@@ -113,12 +173,15 @@ func (t *Table) ColumnNames() []string {
 	return t.columnNames
 }
 
-func (t *Table) SetRecordParser(recParser *parser.RecordParser) error {
-	if recParser == nil {
-		return fmt.Errorf("Table.SetRecordParser: recParser cannot be nil")
-	}
-	t.recordParser = recParser
-	return nil
+func (t *Table) Columns() Columns {
+	return t.columns
+}
+
+// newCursor returns a record parser reading the file with positional
+// reads from an offset of its own, leaving the file offset untouched.
+func (t *Table) newCursor() (*parser.RecordParser, *io.SectionReader) {
+	section := io.NewSectionReader(t.file, 0, math.MaxInt64)
+	return parser.NewRecordParser(section, t.columnNames), section
 }
 
 func (t *Table) WriteColumnDefinitions(w io.Writer) error {
@@ -160,40 +223,71 @@ func (t *Table) ReadColumnDefinitions() error {
 }
 
 func (t *Table) Insert(record map[string]interface{}) (int, error) {
-	if _, err := t.file.Seek(0, io.SeekEnd); err != nil {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.insert(record)
+}
+
+func (t *Table) insert(record map[string]interface{}) (int, error) {
+	if err := t.validateColumns(record); err != nil {
 		return 0, fmt.Errorf("Table.Insert: %w", err)
 	}
-	if err := t.validateColumns(record); err != nil {
+	buf, err := t.encodeRecord(record)
+	if err != nil {
 		return 0, fmt.Errorf("Table.Insert: %w", err)
 	}
+	// check constraints before logging so a rejected record is never restored
+	if err := t.checkUniqueIndexes(record); err != nil {
+		return 0, fmt.Errorf("Table.Insert: %w", err)
+	}
+
+	encoded := [][]byte{buf.Bytes()}
+	data, err := t.encodeInsertBatch(encoded)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Insert: %w", err)
+	}
+	entry, err := t.appendLog(walencoding.OpInsertBatch, data)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Insert: %w", err)
+	}
+	if err := t.writeBatch(encoded, []map[string]interface{}{record}); err != nil {
+		return 0, fmt.Errorf("Table.Insert: %w", t.abort(entry, walencoding.OpInsertBatch, data, err))
+	}
+	if err := t.commit(entry); err != nil {
+		return 0, fmt.Errorf("Table.Insert: %w", err)
+	}
+
+	return 1, nil
+}
 
+// encodeRecord returns the on-disk representation of record.
+func (t *Table) encodeRecord(record map[string]interface{}) (bytes.Buffer, error) {
+	buf := bytes.Buffer{}
 	var sizeOfRecord uint32 = 0
 	for _, col := range t.columnNames {
 		val, ok := record[col]
 		if !ok {
-			return 0, fmt.Errorf("Table.Insert: missing column: %s", col)
+			return buf, fmt.Errorf("Table.encodeRecord: missing column: %s", col)
 		}
 		tlvMarshaler := encoding.NewTLVMarshaler(val)
 		length, err := tlvMarshaler.TLVLength()
 		if err != nil {
-			return 0, fmt.Errorf("Table.Insert: %w", err)
+			return buf, fmt.Errorf("Table.encodeRecord: %w", err)
 		}
 		sizeOfRecord += length
 	}
 
-	buf := bytes.Buffer{}
-
 	byteMarshaler := encoding.NewValueMarshaler(types.TypeRecord)
 	typeBuf, err := byteMarshaler.MarshalBinary()
 	if err != nil {
-		return 0, fmt.Errorf("Table.Insert: %w", err)
+		return buf, fmt.Errorf("Table.encodeRecord: %w", err)
 	}
 	buf.Write(typeBuf)
 
 	intMarshaler := encoding.NewValueMarshaler(sizeOfRecord)
 	lenBuf, err := intMarshaler.MarshalBinary()
 	if err != nil {
-		return 0, fmt.Errorf("Table.Insert: %w", err)
+		return buf, fmt.Errorf("Table.encodeRecord: %w", err)
 	}
 	buf.Write(lenBuf)
 
@@ -202,218 +296,239 @@ func (t *Table) Insert(record map[string]interface{}) (int, error) {
 		tlvMarshaler := encoding.NewTLVMarshaler(v)
 		b, err := tlvMarshaler.MarshalBinary()
 		if err != nil {
-			return 0, fmt.Errorf("Table.Insert: %w", err)
+			return buf, fmt.Errorf("Table.encodeRecord: %w", err)
 		}
 		buf.Write(b)
 	}
+	return buf, nil
+}
 
-	entry, err := t.wal.AppendLog(walencoding.OpInsert, t.Name, buf.Bytes())
+func (t *Table) Select(
+	whereStmt predicate.Predicate,
+) ([]map[string]interface{}, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rows, err := t.selectRows(whereStmt)
 	if err != nil {
-		return 0, fmt.Errorf("Table.Insert: %w", err)
+		return nil, fmt.Errorf("Table.Select: %w", err)
 	}
+	defer rows.Close()
 
-	_, err = t.insertIntoPage(buf)
-	if err != nil {
-		return 0, fmt.Errorf("Table.Insert: %w", err)
+	results := make([]map[string]interface{}, 0)
+	for rows.next() {
+		results = append(results, rows.Values())
 	}
-
-	if err := t.wal.Commit(entry); err != nil {
-		return 0, fmt.Errorf("Table.Insert: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Table.Select: %w", err)
 	}
+	return results, nil
+}
 
-	return 1, nil
+// scan calls fn with the offset of every record matching whereStmt until fn
+// returns false. whereStmt must already be validated.
+func (t *Table) scan(
+	whereStmt predicate.Predicate,
+	fn func(offset int64, record *parser.RawRecord) (bool, error),
+) error {
+	return t.scanAnalyzed(whereStmt, nil, fn)
 }
 
-func (t *Table) Select(
-	whereStmt map[string]interface{},
-) ([]map[string]interface{}, error) {
-	if err := t.ensureFilePointer(); err != nil {
-		return nil, fmt.Errorf("Table.Select: %w", err)
-	}
-	if err := t.validateWhereStmt(whereStmt); err != nil {
-		return nil, fmt.Errorf("Table.Select: %w", err)
+// scanSnapshot is scan reading the records seen by snapshot. A record
+// changed since the snapshot is passed with the offset it had then.
+func (t *Table) scanSnapshot(
+	snapshot *mvcc.Snapshot,
+	whereStmt predicate.Predicate,
+	fn func(offset int64, record *parser.RawRecord) (bool, error),
+) error {
+	rows, err := t.openRows(whereStmt, snapshot)
+	if err != nil {
+		return fmt.Errorf("Table.scanSnapshot: %w", err)
 	}
-	results := make([]map[string]interface{}, 0)
-
-	for {
-		err := t.recordParser.Parse()
-		if err == io.EOF {
-			return results, nil
-		}
+	defer rows.Close()
+	for rows.next() {
+		more, err := fn(rows.offset, rows.current)
 		if err != nil {
-			return nil, fmt.Errorf("Table.Select: %w", err)
-		}
-		rawRecord := t.recordParser.Value
-		if err = t.ensureColumnLength(rawRecord.Values); err != nil {
-			return nil, fmt.Errorf("Table.Select: %w", err)
+			return fmt.Errorf("Table.scanSnapshot: %w", err)
 		}
-		if !t.evaluateWhereStmt(whereStmt, rawRecord.Values) {
-			continue
+		if !more {
+			return nil
 		}
-
-		results = append(results, rawRecord.Values)
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Table.scanSnapshot: %w", err)
+	}
+	return nil
 }
 
-func (t *Table) Delete(whereStmt map[string]interface{}) (int, error) {
-	if err := t.ensureFilePointer(); err != nil {
-		return 0, fmt.Errorf("Table.Delete: %w", err)
-	}
-	if err := t.validateWhereStmt(whereStmt); err != nil {
-		return 0, fmt.Errorf("Table.Delete: %w", err)
+// scanAnalyzed is scan recording the rows produced, pages read and time
+// spent reading into node when it is not nil.
+func (t *Table) scanAnalyzed(
+	whereStmt predicate.Predicate,
+	node *plan.Node,
+	fn func(offset int64, record *parser.RawRecord) (bool, error),
+) error {
+	rows, err := t.openRows(whereStmt, nil)
+	if err != nil {
+		return fmt.Errorf("Table.scan: %w", err)
 	}
+	defer rows.Close()
 
-	deletableRecords := make([]*DeletableRecord, 0)
 	for {
-		if err := t.recordParser.Parse(); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, fmt.Errorf("Table.Delete: %w", err)
+		start := time.Now()
+		next := rows.next()
+		if node != nil {
+			node.Analyzed = true
+			node.Duration += time.Since(start)
+			node.PagesRead = rows.PagesRead()
 		}
-
-		rawRecord := t.recordParser.Value
-		if err := t.ensureColumnLength(rawRecord.Values); err != nil {
-			return 0, fmt.Errorf("Table.Delete: %w", err)
+		if !next {
+			break
 		}
-
-		if !t.evaluateWhereStmt(whereStmt, rawRecord.Values) {
-			continue
+		if node != nil {
+			node.ActualRows++
 		}
-
-		pos, err := t.file.Seek(0, io.SeekCurrent)
+		more, err := fn(rows.offset, rows.current)
 		if err != nil {
-			return 0, fmt.Errorf("Table.Delete: %w", err)
+			return fmt.Errorf("Table.scan: %w", err)
 		}
-		deletableRecords = append(deletableRecords, newDeletableRecord(
-			pos-int64(rawRecord.FullSize),
-			rawRecord.FullSize,
-		))
+		if !more {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Table.scan: %w", err)
 	}
-	return t.markRecordDeleted(deletableRecords)
+	return nil
 }
 
+func (t *Table) Delete(whereStmt predicate.Predicate) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Delete: %w", err)
+	}
+	deletableRecords, err := t.findDeletableRecords(whereStmt, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Delete: %w", err)
+	}
+	return t.deleteRecords(deletableRecords)
+}
+
+// Update sets values on every record matching whereStmt. A value is either
+// a literal or an expr.Expr evaluated against the record being updated.
 func (t *Table) Update(
-	whereStmt map[string]interface{},
+	whereStmt predicate.Predicate,
 	values map[string]interface{},
 ) (int, error) {
-	if err := t.ensureFilePointer(); err != nil {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	whereStmt, err := t.validateWhereStmt(whereStmt)
+	if err != nil {
 		return 0, fmt.Errorf("Table.Update: %w", err)
 	}
-	if err := t.validateWhereStmt(whereStmt); err != nil {
+	values, err = t.validateAssignments(values)
+	if err != nil {
 		return 0, fmt.Errorf("Table.Update: %w", err)
 	}
+	updated, err := t.update(whereStmt, values, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(updated), nil
+}
 
-	deletableRecords := make([]*DeletableRecord, 0)
-	rawRecords := make([]*parser.RawRecord, 0)
-	for {
-		if err := t.recordParser.Parse(); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, fmt.Errorf("Table.Update: %w", err)
-		}
-
-		rawRecord := t.recordParser.Value
-		if err := t.ensureColumnLength(rawRecord.Values); err != nil {
-			return 0, fmt.Errorf("Table.Update: %w", err)
-		}
-
-		if !t.evaluateWhereStmt(whereStmt, rawRecord.Values) {
-			continue
-		}
-
-		rawRecords = append(rawRecords, rawRecord)
+// update returns the updated records.
+func (t *Table) update(
+	whereStmt predicate.Predicate,
+	values map[string]interface{},
+	scanNode *plan.Node,
+) ([]map[string]interface{}, error) {
+	deletableRecords, err := t.findDeletableRecords(whereStmt, scanNode)
+	if err != nil {
+		return nil, fmt.Errorf("Table.Update: %w", err)
+	}
 
-		pos, err := t.file.Seek(0, io.SeekCurrent)
+	updatedRecords := make([]map[string]interface{}, 0, len(deletableRecords))
+	for _, rec := range deletableRecords {
+		updatedRecord, err := t.assign(rec.values, values)
 		if err != nil {
-			return 0, fmt.Errorf("Table.Update: %w", err)
+			return nil, fmt.Errorf("Table.Update: %w", err)
 		}
-		deletableRecords = append(deletableRecords, newDeletableRecord(
-			pos-int64(rawRecord.FullSize),
-			rawRecord.FullSize,
-		))
+		updatedRecords = append(updatedRecords, updatedRecord)
 	}
-
-	if _, err := t.markRecordDeleted(deletableRecords); err != nil {
-		return 0, fmt.Errorf("Table.Update: %w", err)
+	if err := t.applyUpdates(deletableRecords, updatedRecords); err != nil {
+		return nil, fmt.Errorf("Table.Update: %w", err)
 	}
+	return updatedRecords, nil
+}
 
-	for _, rawRecord := range rawRecords {
-		updatedRecord := make(map[string]interface{})
-		for col, v := range rawRecord.Values {
-			if value, ok := values[col]; ok {
-				updatedRecord[col] = value
-			} else {
-				updatedRecord[col] = v
-			}
-		}
-		if _, err := t.Insert(updatedRecord); err != nil {
-			return 0, fmt.Errorf("Table.Update: %w", err)
-		}
+func (t *Table) findDeletableRecords(
+	whereStmt predicate.Predicate,
+	scanNode *plan.Node,
+) ([]*DeletableRecord, error) {
+	deletableRecords := make([]*DeletableRecord, 0)
+	err := t.scanAnalyzed(whereStmt, scanNode, func(offset int64, record *parser.RawRecord) (bool, error) {
+		deletableRecords = append(deletableRecords, newDeletableRecord(
+			offset,
+			record.FullSize,
+			record.Values,
+		))
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Table.findDeletableRecords: %w", err)
 	}
-	return len(rawRecords), nil
+	return deletableRecords, nil
 }
 
-func (t *Table) ensureFilePointer() error {
-	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("Table.ensureFilePointer: %w", err)
+// firstPage returns the offset of the first page of the file read by r,
+// the end of the file when it has none.
+func firstPage(r io.ReadSeeker) (int64, error) {
+	reader := parserio.NewReader(r)
+	pos, err := r.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("Table.firstPage: %w", err)
 	}
-	if err := t.seekUntil(types.TypeRecord); err != nil {
+	for {
+		dataType, err := reader.ReadByte()
 		if err == io.EOF {
-			return nil
+			return pos, nil
 		}
-		return fmt.Errorf("Table.ensureFilePointer: %w", err)
-	}
-	return nil
-}
-
-func (t *Table) seekUntil(targetType byte) error {
-	for {
-		dataType, err := t.reader.ReadByte()
 		if err != nil {
-			if err == io.EOF {
-				return err
-			}
-			return fmt.Errorf("Table.seekUntil: readByte: %w", err)
+			return 0, fmt.Errorf("Table.firstPage: readByte: %w", err)
 		}
-		if dataType == targetType {
-			if _, err := t.file.Seek(-1*types.LenByte, io.SeekCurrent); err != nil {
-				return fmt.Errorf("Table.seekUntil: %w", err)
-			}
-			return nil
+		if dataType == types.TypePage {
+			return pos, nil
 		}
-
-		length, err := t.reader.ReadUint32()
+		length, err := reader.ReadUint32()
 		if err != nil {
-			return fmt.Errorf("Table.seekUntil: readUint32: %w", err)
+			return 0, fmt.Errorf("Table.firstPage: readUint32: %w", err)
 		}
-
-		if _, err := t.file.Seek(int64(length), io.SeekCurrent); err != nil {
-			return fmt.Errorf("Table.seekUntil: %w", err)
+		if pos, err = r.Seek(int64(length), io.SeekCurrent); err != nil {
+			return 0, fmt.Errorf("Table.firstPage: %w", err)
 		}
 	}
 }
 
-func (t *Table) validateWhereStmt(whereStmt map[string]interface{}) error {
-	for k := range whereStmt {
-		if !slices.Contains(t.columnNames, k) {
-			return fmt.Errorf("unknwon column in where statement: %s", k)
-		}
+// validateWhereStmt type-checks whereStmt and returns the copy of it to
+// evaluate, bound to the collations of the columns.
+func (t *Table) validateWhereStmt(whereStmt predicate.Predicate) (predicate.Predicate, error) {
+	if err := predicate.Validate(whereStmt, t.columns); err != nil {
+		return nil, fmt.Errorf("Table.validateWhereStmt: %w", err)
 	}
-	return nil
+	return predicate.Resolve(whereStmt, t.columns), nil
 }
 
 func (t *Table) evaluateWhereStmt(
-	whereStmt map[string]interface{},
+	whereStmt predicate.Predicate,
 	record map[string]interface{},
-) bool {
-	for k, v := range whereStmt {
-		if record[k] != v {
-			return false
-		}
+) (bool, error) {
+	ok, err := predicate.Evaluate(whereStmt, record)
+	if err != nil {
+		return false, fmt.Errorf("Table.evaluateWhereStmt: %w", err)
 	}
-	return true
+	return ok, nil
 }
 
 func (t *Table) ensureColumnLength(record map[string]interface{}) error {
@@ -425,180 +540,144 @@ func (t *Table) ensureColumnLength(record map[string]interface{}) error {
 
 func (t *Table) markRecordDeleted(deleableRecords []*DeletableRecord) (int, error) {
 	for _, rec := range deleableRecords {
-		if _, err := t.file.Seek(rec.offset, io.SeekStart); err != nil {
-			return 0, fmt.Errorf("Table.markRecordsDeleted: %w", err)
-		}
-		if err := binary.Write(t.file, binary.LittleEndian, types.TypeDeletedRecord); err != nil {
-			return 0, fmt.Errorf("Table.markRecordsDeleted: %w", err)
-		}
-		length, err := t.reader.ReadUint32()
-		if err != nil {
+		if err := t.markDeletedAt(rec.offset); err != nil {
 			return 0, fmt.Errorf("Table.markRecordsDeleted: %w", err)
 		}
-		zeroBytes := make([]byte, length)
-		if err = binary.Write(t.file, binary.LittleEndian, zeroBytes); err != nil {
+		t.recordSuperseded(rec)
+		if err := t.removeFromIndexes(rec.values, rec.offset); err != nil {
 			return 0, fmt.Errorf("Table.markRecordsDeleted: %w", err)
 		}
 	}
 	return len(deleableRecords), nil
 }
 
-func GetTableName(f *os.File) (string, error) {
-	// path/to/db/table.bin
-	parts := strings.Split(f.Name(), ".")
-	if len(parts) != 2 {
-		return "", NewInvalidFilename(f.Name())
+// deleteRecords deletes records as a single WAL entry holding their
+// locations and before images.
+func (t *Table) deleteRecords(records []*DeletableRecord) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
 	}
-	filenameParts := strings.Split(parts[0], "/")
-	if len(filenameParts) == 0 {
-		return "", NewInvalidFilename(f.Name())
-	}
-	return filenameParts[len(filenameParts)-1], nil
-}
-
-func (t *Table) RestoreWAL() error {
-	if _, err := t.file.Seek(0, io.SeekEnd); err != nil {
-		return fmt.Errorf("Table.RestoreWAL: %w", err)
-	}
-
-	restorableData, err := t.wal.GetRestorableData()
+	data, err := t.encodeDeletes(records)
 	if err != nil {
-		return fmt.Errorf("Table.RestoreWAL: %w", err)
+		return 0, fmt.Errorf("Table.deleteRecords: %w", err)
 	}
-	// Nothing to restore
-	if restorableData == nil {
-		fmt.Printf("RestoreWAL skipped\n")
-		return nil
+	entry, err := t.appendLog(walencoding.OpDelete, data)
+	if err != nil {
+		return 0, fmt.Errorf("Table.deleteRecords: %w", err)
 	}
-
-	n, err := t.file.Write(restorableData.Data)
+	n, err := t.markRecordDeleted(records)
 	if err != nil {
-		return fmt.Errorf("Table.RestoreWAL: %w", err)
+		return 0, fmt.Errorf("Table.deleteRecords: %w", t.abort(entry, walencoding.OpDelete, data, err))
 	}
-	if n != len(restorableData.Data) {
-		return fmt.Errorf("Table.RestoreWAL: %w", columnio.NewIncompleteWriteError(len(restorableData.Data), n))
+	if err := t.commit(entry); err != nil {
+		return 0, fmt.Errorf("Table.deleteRecords: %w", err)
 	}
-
-	fmt.Printf("RestoreWAL wrote %d bytes\n", n)
-
-	if err = t.wal.Commit(restorableData.LastEntry); err != nil {
-		return fmt.Errorf("Table.RestoreWAL: %w", err)
-	}
-
-	return nil
+	return n, nil
 }
-func (t *Table) updatePageSize(page int64, offset int32) (e error) {
-	t.file.Seek(page, io.SeekStart)
-	dataType, _ := t.reader.ReadByte()
-	if dataType != types.TypePage {
-		return fmt.Errorf("Table.updatePageSize: unexpected type: %d", dataType)
-	}
-	length, _ := t.reader.ReadUint32()
-	_, err := t.file.Seek(-1*types.LenInt32, io.SeekCurrent)
+
+// encodeDeletes returns the data of the OpDelete entry deleting records.
+func (t *Table) encodeDeletes(records []*DeletableRecord) ([]byte, error) {
+	data := bytes.Buffer{}
+	count, err := encoding.NewTLVMarshaler(int64(len(records))).MarshalBinary()
 	if err != nil {
-		return fmt.Errorf("Table.updatePageSize: %w", err)
-	}
-	var newLength uint32
-	if offset >= 0 {
-		newLength = length + uint32(offset)
-	} else {
-		newLength = length - uint32(-offset)
+		return nil, fmt.Errorf("Table.encodeDeletes: %w", err)
 	}
-	marshaler := encoding.NewValueMarshaler[uint32](newLength)
-	b, _ := marshaler.MarshalBinary()
-	n, _ := t.file.Write(b)
-	if n != len(b) {
-		return columnio.NewIncompleteWriteError(len(b), n)
+	data.Write(count)
+	for _, rec := range records {
+		offset, err := encoding.NewTLVMarshaler(rec.offset).MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("Table.encodeDeletes: %w", err)
+		}
+		before, err := t.readAt(rec.offset, rec.l)
+		if err != nil {
+			return nil, fmt.Errorf("Table.encodeDeletes: %w", err)
+		}
+		data.Write(offset)
+		data.Write(before)
 	}
-	return nil
-
+	return data.Bytes(), nil
 }
 
-func (t *Table) insertIntoPage(buf bytes.Buffer) (*index.Page, error) {
-	page, err := t.seekToNextPage(uint32(buf.Len()))
+// markDeletedAt flags the record at offset as deleted and zeroes its data.
+func (t *Table) markDeletedAt(offset int64) error {
+	page, err := t.pageOf(offset)
 	if err != nil {
-		return nil, fmt.Errorf("Table.insertIntoPage: %w", err)
+		return fmt.Errorf("Table.markDeletedAt: %w", err)
 	}
-	n, err := t.file.Write(buf.Bytes())
-	if err != nil {
-		return nil, fmt.Errorf("Table.insertIntoPage: file.Write: %w", err)
+	if write, err := t.shouldWrite(page); err != nil || !write {
+		return err
 	}
-	if n != buf.Len() {
-		return nil, columnio.NewIncompleteWriteError(buf.Len(), n)
+	header := make([]byte, types.LenMeta)
+	if _, err := t.file.ReadAt(header, offset); err != nil {
+		return fmt.Errorf("Table.markDeletedAt: %w", err)
 	}
-
-	// seek back to the beginning of page
-	if _, err = t.file.Seek(page.StartPos, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("Table.insertIntoPage: file.Seek: %w", err)
+	deleted := make([]byte, types.LenMeta+binary.LittleEndian.Uint32(header[types.LenByte:]))
+	copy(deleted, header)
+	deleted[0] = types.TypeDeletedRecord
+	if err := t.writeAt(offset, deleted); err != nil {
+		return fmt.Errorf("Table.markDeletedAt: %w", err)
 	}
-	return page, t.updatePageSize(page.StartPos, int32(buf.Len()))
+	t.touch(page)
+	return nil
 }
 
-func (t *Table) seekToNextPage(lenToFit uint32) (*index.Page, error) {
-	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("Table.seekToNextPage: %w", err)
+func GetTableName(f vfs.File) (string, error) {
+	// path/to/db/table.bin
+	parts := strings.Split(f.Name(), ".")
+	if len(parts) != 2 {
+		return "", NewInvalidFilename(f.Name())
 	}
-
-	for {
-		err := t.seekUntil(types.TypeByte)
-		if err != nil {
-			if err == io.EOF {
-				return t.insertEmptyPage()
-			}
-			return nil, fmt.Errorf("Table.seekToNextPage: %w", err)
-		}
-
-		// Skipping the type definition byte
-		if _, err = t.reader.ReadByte(); err != nil {
-			return nil, fmt.Errorf("Table.seekToNextPage: readByte: %w", err)
-		}
-		currPageLen, err := t.reader.ReadUint32()
-		if err != nil {
-			return nil, fmt.Errorf("Table.seekToNextPage: readUint32: %w", err)
-		}
-
-		if currPageLen+lenToFit <= PageSize {
-			meta := int64(types.LenByte + types.LenInt32)
-			pagePos, err := t.file.Seek(-1*meta, io.SeekCurrent)
-			if err != nil {
-				return nil, fmt.Errorf("Table.seekToNextPage: file.Seek: %w", err)
-			}
-			// This line is very important
-			_, err = t.file.Seek(int64(currPageLen)+meta, io.SeekCurrent)
-			return index.NewPage(pagePos), err
-		}
+	filenameParts := strings.Split(parts[0], "/")
+	if len(filenameParts) == 0 {
+		return "", NewInvalidFilename(f.Name())
 	}
+	return filenameParts[len(filenameParts)-1], nil
 }
 
-func (t *Table) insertEmptyPage() (*index.Page, error) {
-	buf := bytes.Buffer{}
-
-	// type
-	if err := binary.Write(&buf, binary.LittleEndian, types.TypePage); err != nil {
-		return nil, fmt.Errorf("Table.insertEmptyPage: type: %w", err)
-	}
-
-	// length
-	if err := binary.Write(&buf, binary.LittleEndian, uint32(0)); err != nil {
-		return nil, fmt.Errorf("Table.insertEmptyPage: len: %w", err)
+// Flush commits the table file to stable storage.
+func (t *Table) Flush() error {
+	if err := t.file.Sync(); err != nil {
+		return fmt.Errorf("Table.Flush: %w", err)
 	}
+	return nil
+}
 
-	n, err := t.file.Write(buf.Bytes())
+// appendLog logs an operation on the table and starts the writer its
+// changes are stamped with.
+func (t *Table) appendLog(op string, data []byte) (*wal.Entry, error) {
+	t.beginWrite()
+	t.touched = nil
+	entry, err := t.wal.AppendLog(op, t.Name, data)
 	if err != nil {
-		return nil, fmt.Errorf("Table.insertEmptyPage: file.Write: %w", err)
-	}
-	if n != buf.Len() {
-		return nil, columnio.NewIncompleteWriteError(buf.Len(), n)
+		// nothing was written, the writer ends with nothing to version
+		t.endWrite()
+		return nil, err
 	}
+	t.lsn = entry.LSN
+	return entry, nil
+}
 
-	currPos, err := t.file.Seek(0, io.SeekCurrent)
+// commit commits entry once the table file was written and its pages
+// stamped, syncing the file along with the log as the durability policy
+// requires. The changes become visible to new snapshots.
+func (t *Table) commit(entry *wal.Entry) error {
+	defer t.endWrite()
+	err := t.stampPages()
+	t.lsn = 0
 	if err != nil {
-		return nil, fmt.Errorf("Table.insertEmptyPage: %w", err)
+		return err
 	}
-	// startPos should point at the very first byte, that is types.TypePage and 5 bytes before the current pos
-	startPos := currPos - (types.LenInt32 + types.LenByte)
-	if startPos <= 0 {
-		return nil, fmt.Errorf("Table.insertEmptyPage: unable to insert new page: start should be positive: %d", startPos)
+	t.wal.Dirty(t.file)
+	return t.wal.Commit(entry)
+}
+
+// lock locks the table exclusively when write is set and shared otherwise,
+// and returns the matching unlock.
+func (t *Table) lock(write bool) func() {
+	if write {
+		t.mu.Lock()
+		return t.mu.Unlock
 	}
-	return index.NewPage(startPos), nil
+	t.mu.RLock()
+	return t.mu.RUnlock
 }
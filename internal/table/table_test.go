@@ -0,0 +1,199 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	parserio "github.com/9bany/db/internal/platform/parser/io"
+	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/table/column"
+	columnio "github.com/9bany/db/internal/table/column/io"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTable(t *testing.T) *Table {
+	return newTestTableWithUsername(t, column.ColumnOptions{})
+}
+
+// newTestTableWithUsername creates tb_user with the given options for the
+// username column.
+func newTestTableWithUsername(t *testing.T, username column.ColumnOptions) *Table {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "tb_user"+FileExtension))
+	assert.Nil(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	def, err := NewTableWithColumns(f, Columns{
+		"id":       column.NewColumn("id", types.TypeInt32, column.ColumnOptions{}),
+		"username": column.NewColumn("username", types.TypeString, username),
+		"age":      column.NewColumn("age", types.TypeInt64, column.ColumnOptions{}),
+	}, []string{"id", "username", "age"})
+	assert.Nil(t, err)
+	assert.Nil(t, def.WriteColumnDefinitions(f))
+
+	writeAheadLog, err := wal.NewWal(dir, "tb_user")
+	assert.Nil(t, err)
+	r := parserio.NewReader(f)
+	tb, err := NewTable(f, r, columnio.NewColumnDefinitionReader(r), writeAheadLog)
+	assert.Nil(t, err)
+	assert.Nil(t, tb.ReadColumnDefinitions())
+	return tb
+}
+
+func insertTestUsers(t *testing.T, tb *Table) {
+	users := []struct {
+		id   int32
+		name string
+		age  int64
+	}{
+		{1, "bany", 30},
+		{2, "alice", 25},
+		{3, "bob", 41},
+		{4, "barbara", 19},
+		{5, "carol", 25},
+	}
+	for _, u := range users {
+		n, err := tb.Insert(map[string]interface{}{
+			"id":       u.id,
+			"username": u.name,
+			"age":      u.age,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+}
+
+func selectIDs(t *testing.T, tb *Table, where predicate.Predicate) []int32 {
+	rows, err := tb.Select(where)
+	assert.Nil(t, err)
+	ids := make([]int32, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row["id"].(int32))
+	}
+	return ids
+}
+
+func TestSelect_Where(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	assert.Equal(t, []int32{1, 2, 3, 4, 5}, selectIDs(t, tb, nil))
+	assert.Equal(t, []int32{3}, selectIDs(t, tb, predicate.FromMap(map[string]interface{}{"username": "bob"})))
+	assert.Equal(t, []int32{1, 3}, selectIDs(t, tb, predicate.Ge("age", int64(30))))
+	assert.Equal(t, []int32{2, 5}, selectIDs(t, tb, predicate.In("age", int64(25), int64(99))))
+	assert.Equal(t, []int32{1, 2, 5}, selectIDs(t, tb, predicate.Between("age", int64(25), int64(30))))
+	assert.Equal(t, []int32{1, 3, 4}, selectIDs(t, tb, predicate.HasPrefix("username", "b")))
+	assert.Equal(t, []int32{4}, selectIDs(t, tb, predicate.Like("username", "b_r%a")))
+	assert.Equal(t, []int32{2, 4, 5}, selectIDs(t, tb, predicate.Or(
+		predicate.Lt("age", int64(20)),
+		predicate.And(predicate.Eq("age", int64(25)), predicate.Not(predicate.Eq("id", int32(1)))),
+	)))
+}
+
+func TestSelect_InvalidWhere(t *testing.T) {
+	tb := newTestTable(t)
+
+	_, err := tb.Select(predicate.Eq("missing", int32(1)))
+	assert.NotNil(t, err)
+	_, err = tb.Select(predicate.Gt("age", "old"))
+	assert.NotNil(t, err)
+	_, err = tb.Select(predicate.Like("id", "1%"))
+	assert.NotNil(t, err)
+}
+
+func TestDeleteAndUpdate_Where(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	n, err := tb.Delete(predicate.Lt("age", int64(20)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int32{1, 2, 3, 5}, selectIDs(t, tb, nil))
+
+	n, err = tb.Update(predicate.Eq("age", int64(25)), map[string]interface{}{"username": "young"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	rows, err := tb.Select(predicate.Eq("username", "young"))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 2)
+}
+
+func TestSelect_ConcurrentReadersAndWriter(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, err := tb.Insert(map[string]interface{}{"id": int32(100 + i), "username": "new", "age": int64(i)})
+			assert.Nil(t, err)
+		}
+	}()
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				// every read sees the users followed by a prefix of the
+				// inserted records, whatever the other goroutines do
+				ids := selectIDs(t, tb, nil)
+				if !assert.GreaterOrEqual(t, len(ids), 5) {
+					return
+				}
+				assert.Equal(t, []int32{1, 2, 3, 4, 5}, ids[:5])
+				for j, id := range ids[5:] {
+					assert.Equal(t, int32(100+j), id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, selectIDs(t, tb, nil), 55)
+}
+
+func TestIndex_LookupAndMaintenance(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	assert.Nil(t, tb.CreateIndex("age", false))
+	assert.Nil(t, tb.CreateIndex("username", true))
+	assert.NotNil(t, tb.CreateIndex("age", false))
+
+	rows, err := tb.LookupIndex("age", int64(25))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 2)
+
+	_, err = tb.Insert(map[string]interface{}{"id": int32(6), "username": "bob", "age": int64(1)})
+	var violation *index.UniqueViolationError
+	assert.ErrorAs(t, err, &violation)
+
+	_, err = tb.Update(predicate.Eq("id", int32(2)), map[string]interface{}{"username": "carol"})
+	assert.ErrorAs(t, err, &violation)
+
+	n, err := tb.Update(predicate.Eq("id", int32(2)), map[string]interface{}{"age": int64(26)})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	rows, err = tb.LookupIndex("age", int64(26))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", rows[0]["username"])
+
+	_, err = tb.Delete(predicate.Eq("age", int64(25)))
+	assert.Nil(t, err)
+	rows, err = tb.LookupIndex("age", int64(25))
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+
+	// definitions survive a reload
+	tb.indexes = make(map[string]*index.Index)
+	assert.Nil(t, tb.LoadIndexes())
+	assert.Len(t, tb.Indexes(), 2)
+	assert.Equal(t, 4, tb.Index("username").Len())
+}
@@ -0,0 +1,249 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/9bany/db/internal/platform/types"
+	columnio "github.com/9bany/db/internal/table/column/io"
+	"github.com/9bany/db/internal/table/expr"
+	"github.com/9bany/db/internal/table/predicate"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// validateAssignments type-checks the values of an update and returns the
+// copy of them to assign, see resolveAssignments.
+func (t *Table) validateAssignments(values map[string]interface{}) (map[string]interface{}, error) {
+	for col, v := range values {
+		if err := t.validateAssignment(col, v); err != nil {
+			return nil, fmt.Errorf("Table.validateAssignments: %w", err)
+		}
+	}
+	return t.resolveAssignments(values), nil
+}
+
+// resolveAssignments returns a copy of values whose expressions are bound
+// to the collations of the columns.
+func (t *Table) resolveAssignments(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	resolved := make(map[string]interface{}, len(values))
+	for col, v := range values {
+		if e, ok := v.(expr.Expr); ok {
+			v = expr.Resolve(e, t.columns)
+		}
+		resolved[col] = v
+	}
+	return resolved
+}
+
+// validateAssignment checks that v can be assigned to col. v is a literal,
+// an expression over the current record or a parameter of a prepared
+// statement, which is checked when it is bound.
+func (t *Table) validateAssignment(col string, v interface{}) error {
+	c, ok := t.columns[col]
+	if !ok {
+		return fmt.Errorf("unknown column: %s", col)
+	}
+	switch v := v.(type) {
+	case *predicate.Parameter:
+		return nil
+	case expr.Expr:
+		dataType, err := v.Type(t.columns)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+		if !expr.Assignable(dataType, c.DataType()) {
+			return fmt.Errorf("column %s: expression %s of type %d cannot be assigned to type %d", col, v, dataType, c.DataType())
+		}
+		return nil
+	}
+	if err := c.ValidateValue(v); err != nil {
+		return fmt.Errorf("column %s: %w", col, err)
+	}
+	return nil
+}
+
+// assign returns a copy of record with values applied. Expressions are
+// evaluated against record and converted to the type of their column.
+func (t *Table) assign(record map[string]interface{}, values map[string]interface{}) (map[string]interface{}, error) {
+	updated := make(map[string]interface{}, len(record))
+	for col, v := range record {
+		updated[col] = v
+	}
+	for col, v := range values {
+		e, ok := v.(expr.Expr)
+		if !ok {
+			updated[col] = v
+			continue
+		}
+		result, err := e.Evaluate(record)
+		if err != nil {
+			return nil, fmt.Errorf("Table.assign: column %s: %w", col, err)
+		}
+		if updated[col], err = expr.Convert(result, t.columns[col].DataType()); err != nil {
+			return nil, fmt.Errorf("Table.assign: column %s: %w", col, err)
+		}
+	}
+	if err := t.validateColumns(updated); err != nil {
+		return nil, fmt.Errorf("Table.assign: %w", err)
+	}
+	return updated, nil
+}
+
+// applyUpdates replaces every old record with the updated record of the same
+// position. A record that still fits in the space of the old one is
+// rewritten in place and padded, so it keeps its offset and scan order. A
+// record that grows is relocated: the old one is deleted and the new one
+// appended. All the records are logged as a single WAL entry holding their
+// before and after images.
+func (t *Table) applyUpdates(old []*DeletableRecord, updated []map[string]interface{}) error {
+	if len(old) == 0 {
+		return nil
+	}
+	if err := t.checkUniqueUpdate(old, updated); err != nil {
+		return fmt.Errorf("Table.applyUpdates: %w", err)
+	}
+
+	data, afters, err := t.encodeUpdates(old, updated)
+	if err != nil {
+		return fmt.Errorf("Table.applyUpdates: %w", err)
+	}
+	entry, err := t.appendLog(walencoding.OpUpdate, data)
+	if err != nil {
+		return fmt.Errorf("Table.applyUpdates: %w", err)
+	}
+	if err := t.writeUpdates(old, updated, afters); err != nil {
+		return fmt.Errorf("Table.applyUpdates: %w", t.abort(entry, walencoding.OpUpdate, data, err))
+	}
+	if err := t.commit(entry); err != nil {
+		return fmt.Errorf("Table.applyUpdates: %w", err)
+	}
+	return nil
+}
+
+// encodeUpdates returns the data of the OpUpdate entry replacing the old
+// records with the updated ones, and the after image of every record.
+func (t *Table) encodeUpdates(old []*DeletableRecord, updated []map[string]interface{}) ([]byte, [][]byte, error) {
+	base, err := t.appendBase()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Table.encodeUpdates: %w", err)
+	}
+	data := bytes.Buffer{}
+	if err := writeLogHeader(&data, base, len(old)); err != nil {
+		return nil, nil, fmt.Errorf("Table.encodeUpdates: %w", err)
+	}
+	afters := make([][]byte, len(old))
+	for i, rec := range old {
+		buf, err := t.encodeRecord(updated[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("Table.encodeUpdates: %w", err)
+		}
+		afters[i] = padRecord(buf.Bytes(), rec.l)
+		before, err := t.readAt(rec.offset, rec.l)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Table.encodeUpdates: %w", err)
+		}
+		offset, err := encoding.NewTLVMarshaler(rec.offset).MarshalBinary()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Table.encodeUpdates: %w", err)
+		}
+		data.Write(offset)
+		data.Write(before)
+		data.Write(afters[i])
+	}
+	return data.Bytes(), afters, nil
+}
+
+// writeUpdates writes the after images of the updated records, in place
+// when they fit and relocated otherwise, and maintains the indexes.
+func (t *Table) writeUpdates(old []*DeletableRecord, updated []map[string]interface{}, afters [][]byte) error {
+	relocated := make([]*DeletableRecord, 0)
+	relocatedRecords := make([]map[string]interface{}, 0)
+	relocatedData := make([][]byte, 0)
+	for i, rec := range old {
+		if uint32(len(afters[i])) != rec.l {
+			relocated = append(relocated, rec)
+			relocatedRecords = append(relocatedRecords, updated[i])
+			relocatedData = append(relocatedData, afters[i])
+			continue
+		}
+		if err := t.removeFromIndexes(rec.values, rec.offset); err != nil {
+			return fmt.Errorf("Table.writeUpdates: %w", err)
+		}
+		if err := t.overwrite(rec.offset, afters[i]); err != nil {
+			return fmt.Errorf("Table.writeUpdates: %w", err)
+		}
+		t.recordSuperseded(rec)
+		t.recordCreated(rec.offset)
+		if err := t.addToIndexes(updated[i], rec.offset); err != nil {
+			return fmt.Errorf("Table.writeUpdates: %w", err)
+		}
+	}
+	if len(relocated) == 0 {
+		return nil
+	}
+	if _, err := t.markRecordDeleted(relocated); err != nil {
+		return fmt.Errorf("Table.writeUpdates: %w", err)
+	}
+	offsets, err := t.writePages(relocatedData)
+	if err != nil {
+		return fmt.Errorf("Table.writeUpdates: %w", err)
+	}
+	for i, record := range relocatedRecords {
+		if err := t.addToIndexes(record, offsets[i]); err != nil {
+			return fmt.Errorf("Table.writeUpdates: %w", err)
+		}
+	}
+	return nil
+}
+
+// padRecord returns record padded with zero bytes to size when it fits. The
+// length in its header covers the padding so the record keeps its size.
+func padRecord(record []byte, size uint32) []byte {
+	if uint32(len(record)) > size {
+		return record
+	}
+	padded := make([]byte, size)
+	copy(padded, record)
+	binary.LittleEndian.PutUint32(padded[types.LenByte:], size-types.LenMeta)
+	return padded
+}
+
+func (t *Table) readAt(offset int64, size uint32) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := t.file.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("Table.readAt: %w", err)
+	}
+	return data, nil
+}
+
+// overwrite writes data over the record at offset.
+func (t *Table) overwrite(offset int64, data []byte) error {
+	page, err := t.pageOf(offset)
+	if err != nil {
+		return fmt.Errorf("Table.overwrite: %w", err)
+	}
+	if write, err := t.shouldWrite(page); err != nil || !write {
+		return err
+	}
+	if err := t.writeAt(offset, data); err != nil {
+		return fmt.Errorf("Table.overwrite: %w", err)
+	}
+	t.touch(page)
+	return nil
+}
+
+func (t *Table) writeAt(offset int64, data []byte) error {
+	n, err := t.file.WriteAt(data, offset)
+	if err != nil {
+		return fmt.Errorf("Table.writeAt: %w", err)
+	}
+	if n != len(data) {
+		return columnio.NewIncompleteWriteError(len(data), n)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/table/expr"
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func recordOffset(t *testing.T, tb *Table, id int32) *DeletableRecord {
+	records, err := tb.findDeletableRecords(predicate.Eq("id", id), nil)
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	return records[0]
+}
+
+// logUpdate appends an update entry to the WAL without applying it and
+// returns what applying it takes.
+func logUpdate(t *testing.T, tb *Table, id int32, values map[string]interface{}) (
+	[]*DeletableRecord, []map[string]interface{}, [][]byte) {
+	rec := recordOffset(t, tb, id)
+	updated, err := tb.assign(rec.values, values)
+	assert.Nil(t, err)
+	old, records := []*DeletableRecord{rec}, []map[string]interface{}{updated}
+	data, afters, err := tb.encodeUpdates(old, records)
+	assert.Nil(t, err)
+	_, err = tb.wal.AppendLog("update", tb.Name, data)
+	assert.Nil(t, err)
+	return old, records, afters
+}
+
+func TestUpdate_InPlace(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("username", false))
+	before := recordOffset(t, tb, 4)
+
+	// a shorter username fits in the old record
+	n, err := tb.Update(predicate.Eq("id", int32(4)), map[string]interface{}{"username": "barb"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	after := recordOffset(t, tb, 4)
+	assert.Equal(t, before.offset, after.offset)
+	assert.Equal(t, before.l, after.l)
+	assert.Equal(t, "barb", after.values["username"])
+	assert.Equal(t, []int32{1, 2, 3, 4, 5}, selectIDs(t, tb, nil))
+
+	rows, err := tb.LookupIndex("username", "barb")
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	rows, err = tb.LookupIndex("username", "barbara")
+	assert.Nil(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestUpdate_Relocates(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+	before := recordOffset(t, tb, 2)
+
+	n, err := tb.Update(predicate.Eq("id", int32(2)), map[string]interface{}{"username": "alice-the-second"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	after := recordOffset(t, tb, 2)
+	assert.NotEqual(t, before.offset, after.offset)
+	assert.Equal(t, []int32{1, 3, 4, 5, 2}, selectIDs(t, tb, nil))
+	rows, err := tb.LookupIndex("id", int32(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int32(2), "username": "alice-the-second", "age": int64(25)}}, rows)
+}
+
+func TestUpdate_RestoresFromWAL(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	// one update fits in place, the other grows
+	logUpdate(t, tb, 3, map[string]interface{}{"username": "rob"})
+	logUpdate(t, tb, 1, map[string]interface{}{"username": "bany-renamed"})
+
+	// restore runs before indexes are loaded when a database is opened
+	tb.indexes = make(map[string]*index.Index)
+	assert.Nil(t, tb.RestoreWAL())
+	assert.Nil(t, tb.LoadIndexes())
+
+	rows, err := tb.Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": int32(2), "username": "alice", "age": int64(25)},
+		{"id": int32(3), "username": "rob", "age": int64(41)},
+		{"id": int32(4), "username": "barbara", "age": int64(19)},
+		{"id": int32(5), "username": "carol", "age": int64(25)},
+		{"id": int32(1), "username": "bany-renamed", "age": int64(30)},
+	}, rows)
+}
+
+func TestUpdate_RedoesPartialUpdate(t *testing.T) {
+	expected := []map[string]interface{}{
+		{"id": int32(1), "username": "bany", "age": int64(30)},
+		{"id": int32(3), "username": "bob", "age": int64(41)},
+		{"id": int32(4), "username": "barbara", "age": int64(19)},
+		{"id": int32(5), "username": "carol", "age": int64(25)},
+		{"id": int32(2), "username": "alice-the-second", "age": int64(25)},
+	}
+	for name, apply := range map[string]func(tb *Table, old []*DeletableRecord, updated []map[string]interface{}, afters [][]byte){
+		// the old record is deleted, the crash happens before the new one is
+		// appended
+		"deleted only": func(tb *Table, old []*DeletableRecord, _ []map[string]interface{}, _ [][]byte) {
+			_, err := tb.markRecordDeleted(old)
+			assert.Nil(t, err)
+		},
+		// the update is applied, the crash happens before the commit
+		"applied": func(tb *Table, old []*DeletableRecord, updated []map[string]interface{}, afters [][]byte) {
+			assert.Nil(t, tb.writeUpdates(old, updated, afters))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tb := newTestTable(t)
+			insertTestUsers(t, tb)
+			old, updated, afters := logUpdate(t, tb, 2, map[string]interface{}{"username": "alice-the-second"})
+			apply(tb, old, updated, afters)
+
+			tb.indexes = make(map[string]*index.Index)
+			assert.Nil(t, tb.RestoreWAL())
+			assert.Nil(t, tb.LoadIndexes())
+			rows, err := tb.Select(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, rows)
+
+			// pages stay consistent for the next insert
+			_, err = tb.Insert(map[string]interface{}{"id": int32(6), "username": "dave", "age": int64(50)})
+			assert.Nil(t, err)
+			assert.Equal(t, []int32{1, 3, 4, 5, 2, 6}, selectIDs(t, tb, nil))
+		})
+	}
+}
+
+func TestDelete_RestoresFromWAL(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	// log a delete that never reached the table file
+	records, err := tb.findDeletableRecords(predicate.Eq("age", int64(25)), nil)
+	assert.Nil(t, err)
+	data, err := tb.encodeDeletes(records)
+	assert.Nil(t, err)
+	_, err = tb.wal.AppendLog("delete", tb.Name, data)
+	assert.Nil(t, err)
+
+	assert.Nil(t, tb.RestoreWAL())
+	assert.Equal(t, []int32{1, 3, 4}, selectIDs(t, tb, nil))
+
+	n, err := tb.Delete(predicate.Eq("id", int32(3)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	restorable, err := tb.wal.GetRestorableData()
+	assert.Nil(t, err)
+	assert.Nil(t, restorable)
+}
+
+func TestUpdate_Expressions(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	n, err := tb.Update(predicate.Eq("age", int64(25)), map[string]interface{}{
+		"age":      expr.Add(expr.Col("age"), expr.Lit(1)),
+		"id":       expr.Mul(expr.Col("id"), expr.Lit(10)),
+		"username": expr.Upper(expr.Col("username")),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	rows, err := tb.Select(predicate.Eq("age", int64(26)))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{
+		{"id": int32(20), "username": "ALICE", "age": int64(26)},
+		{"id": int32(50), "username": "CAROL", "age": int64(26)},
+	}, rows)
+
+	_, err = tb.Update(nil, map[string]interface{}{"age": expr.Concat(expr.Col("username"), expr.Lit("!"))})
+	assert.NotNil(t, err)
+	_, err = tb.Update(nil, map[string]interface{}{"age": expr.Div(expr.Col("age"), expr.Lit(0))})
+	var divByZero *expr.DivisionByZeroError
+	assert.ErrorAs(t, err, &divByZero)
+	assert.Equal(t, []int32{1, 20, 3, 4, 50}, selectIDs(t, tb, nil))
+}
+
+func TestReturning(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+
+	inserted, err := tb.InsertReturning(map[string]interface{}{"id": int32(6), "username": "dave", "age": int64(50)}, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": int32(6)}, inserted)
+
+	updated, err := tb.UpdateReturning(predicate.Gt("age", int64(40)),
+		map[string]interface{}{"age": expr.Sub(expr.Col("age"), expr.Lit(1))}, "id", "age")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{
+		{"id": int32(3), "age": int64(40)},
+		{"id": int32(6), "age": int64(49)},
+	}, updated)
+
+	deleted, err := tb.DeleteReturning(predicate.Eq("username", "bob"))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int32(3), "username": "bob", "age": int64(40)}}, deleted)
+
+	_, err = tb.DeleteReturning(nil, "missing")
+	assert.NotNil(t, err)
+	assert.Equal(t, []int32{1, 2, 4, 5, 6}, selectIDs(t, tb, nil))
+}
@@ -0,0 +1,150 @@
+package table
+
+import (
+	"fmt"
+
+	"github.com/9bany/db/internal/table/index"
+)
+
+type ConflictAction int
+
+const (
+	DoNothing ConflictAction = iota
+	DoUpdate
+)
+
+// ExcludedValue refers to a column of the record proposed for insertion,
+// like EXCLUDED.column in SQL.
+type ExcludedValue struct {
+	Column string
+}
+
+func Excluded(column string) ExcludedValue {
+	return ExcludedValue{Column: column}
+}
+
+// Upsert describes INSERT ... ON CONFLICT (OnConflict) DO NOTHING/DO UPDATE.
+type Upsert struct {
+	Record map[string]interface{}
+	// OnConflict names the column of the unique index the conflict is
+	// detected on. It may be empty with DoNothing, then a conflict on any
+	// unique index is ignored.
+	OnConflict []string
+	Action     ConflictAction
+	// Set is applied to the conflicting record by DoUpdate. Values may be
+	// Excluded references or expressions over the conflicting record. A nil
+	// Set replaces every column with Record.
+	Set map[string]interface{}
+}
+
+// Upsert inserts u.Record or, when it conflicts with an existing record,
+// runs the conflict action. The conflicting record is updated like Update
+// does, in place when the new record fits.
+// It returns the number of records inserted or updated.
+func (t *Table) Upsert(u Upsert) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	target, err := t.validateUpsert(u)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Upsert: %w", err)
+	}
+
+	existing, err := t.findConflict(u.Record, target)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Upsert: %w", err)
+	}
+	if existing == nil {
+		n, err := t.insert(u.Record)
+		if err != nil {
+			return 0, fmt.Errorf("Table.Upsert: %w", err)
+		}
+		return n, nil
+	}
+	if u.Action == DoNothing {
+		return 0, nil
+	}
+
+	set := u.Set
+	if set == nil {
+		set = u.Record
+	}
+	values := make(map[string]interface{}, len(set))
+	for col, v := range set {
+		if excluded, ok := v.(ExcludedValue); ok {
+			v = u.Record[excluded.Column]
+		}
+		values[col] = v
+	}
+	updated, err := t.assign(existing.values, values)
+	if err != nil {
+		return 0, fmt.Errorf("Table.Upsert: %w", err)
+	}
+	if err := t.applyUpdates([]*DeletableRecord{existing}, []map[string]interface{}{updated}); err != nil {
+		return 0, fmt.Errorf("Table.Upsert: %w", err)
+	}
+	return 1, nil
+}
+
+// validateUpsert returns the unique indexes conflicts are detected on.
+func (t *Table) validateUpsert(u Upsert) ([]*index.Index, error) {
+	if err := t.validateColumns(u.Record); err != nil {
+		return nil, err
+	}
+	for col, v := range u.Set {
+		if _, ok := t.columns[col]; !ok {
+			return nil, fmt.Errorf("Table.validateUpsert: unknown column in set: %s", col)
+		}
+		if excluded, ok := v.(ExcludedValue); ok {
+			if _, ok := t.columns[excluded.Column]; !ok {
+				return nil, fmt.Errorf("Table.validateUpsert: unknown excluded column: %s", excluded.Column)
+			}
+			continue
+		}
+		if err := t.validateAssignment(col, v); err != nil {
+			return nil, fmt.Errorf("Table.validateUpsert: %w", err)
+		}
+	}
+
+	switch {
+	case len(u.OnConflict) == 0 && u.Action == DoNothing:
+		target := make([]*index.Index, 0)
+		for _, idx := range t.sortedIndexes() {
+			if idx.Unique {
+				target = append(target, idx)
+			}
+		}
+		return target, nil
+	case len(u.OnConflict) != 1:
+		// unique constraints span a single column
+		return nil, NewNoUniqueConstraintError(u.OnConflict)
+	}
+	idx := t.indexes[u.OnConflict[0]]
+	if idx == nil || !idx.Unique {
+		return nil, NewNoUniqueConstraintError(u.OnConflict)
+	}
+	return []*index.Index{idx}, nil
+}
+
+// findConflict returns the record conflicting with record on one of the
+// target indexes.
+func (t *Table) findConflict(record map[string]interface{}, target []*index.Index) (*DeletableRecord, error) {
+	for _, idx := range target {
+		v := record[idx.Column]
+		if v == nil {
+			continue
+		}
+		offsets, err := idx.Lookup(v)
+		if err != nil {
+			return nil, fmt.Errorf("Table.findConflict: %w", err)
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+		rawRecord, err := t.readRecordAt(offsets[0])
+		if err != nil {
+			return nil, fmt.Errorf("Table.findConflict: %w", err)
+		}
+		return newDeletableRecord(offsets[0], rawRecord.FullSize, rawRecord.Values), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,94 @@
+package table
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/9bany/db/internal/table/index"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsert(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	// no conflict inserts
+	n, err := tb.Upsert(Upsert{
+		Record:     map[string]interface{}{"id": int32(6), "username": "dave", "age": int64(50)},
+		OnConflict: []string{"id"},
+		Action:     DoUpdate,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// conflict with do nothing keeps the existing record
+	n, err = tb.Upsert(Upsert{
+		Record: map[string]interface{}{"id": int32(6), "username": "other", "age": int64(1)},
+		Action: DoNothing,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// conflict with do update applies set, reading excluded values
+	n, err = tb.Upsert(Upsert{
+		Record:     map[string]interface{}{"id": int32(2), "username": "ignored", "age": int64(26)},
+		OnConflict: []string{"id"},
+		Action:     DoUpdate,
+		Set:        map[string]interface{}{"age": Excluded("age")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	rows, err := tb.Select(predicate.In("id", int32(2), int32(6)))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{
+		{"id": int32(2), "username": "alice", "age": int64(26)},
+		{"id": int32(6), "username": "dave", "age": int64(50)},
+	}, rows)
+	rows, err = tb.LookupIndex("id", int32(2))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+}
+
+func TestUpsert_Invalid(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+	assert.Nil(t, tb.CreateIndex("username", true))
+
+	record := map[string]interface{}{"id": int32(1), "username": "bany", "age": int64(1)}
+	_, err := tb.Upsert(Upsert{Record: record, OnConflict: []string{"age"}, Action: DoUpdate})
+	var noConstraint *NoUniqueConstraintError
+	assert.True(t, errors.As(err, &noConstraint))
+	_, err = tb.Upsert(Upsert{Record: record, Action: DoUpdate})
+	assert.NotNil(t, err)
+
+	// updating into another unique value is still a violation
+	_, err = tb.Upsert(Upsert{
+		Record:     record,
+		OnConflict: []string{"id"},
+		Action:     DoUpdate,
+		Set:        map[string]interface{}{"username": "alice"},
+	})
+	var violation *index.UniqueViolationError
+	assert.True(t, errors.As(err, &violation))
+}
+
+func TestUpsert_RestoresFromWAL(t *testing.T) {
+	tb := newTestTable(t)
+	insertTestUsers(t, tb)
+	assert.Nil(t, tb.CreateIndex("id", true))
+
+	// log the update of an upsert that never reached the table file
+	logUpdate(t, tb, 1, map[string]interface{}{"age": int64(31)})
+
+	// restore runs before indexes are loaded when a database is opened
+	tb.indexes = make(map[string]*index.Index)
+	assert.Nil(t, tb.RestoreWAL())
+	assert.Nil(t, tb.LoadIndexes())
+	rows, err := tb.Select(predicate.Eq("id", int32(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"id": int32(1), "username": "bany", "age": int64(31)}}, rows)
+}
@@ -0,0 +1,54 @@
+package table
+
+import (
+	"github.com/9bany/db/internal/table/mvcc"
+)
+
+// SetTxManager makes the table share the transaction IDs and snapshots of
+// m, the manager of its database.
+func (t *Table) SetTxManager(m *mvcc.Manager) {
+	t.txs = m
+}
+
+// beginWrite starts the writer the changes of the table are stamped with
+// until endWrite. A writer left by a failed operation is ended first: its
+// changes are on disk.
+func (t *Table) beginWrite() {
+	t.endWrite()
+	t.writeTx = t.txs.Begin()
+}
+
+// endWrite commits the current writer, if any.
+func (t *Table) endWrite() {
+	if t.writeTx == 0 {
+		return
+	}
+	t.txs.End(t.writeTx)
+	t.writeTx = 0
+	t.CollectGarbage()
+}
+
+// recordCreated stamps the record written at offset with the current
+// writer. Changes made without a writer, like redone ones, are not
+// versioned.
+func (t *Table) recordCreated(offset int64) {
+	if t.writeTx == 0 {
+		return
+	}
+	t.versions.Create(offset, t.writeTx)
+}
+
+// recordSuperseded keeps the version of rec replaced or deleted by the
+// current writer for the snapshots still seeing it.
+func (t *Table) recordSuperseded(rec *DeletableRecord) {
+	if t.writeTx == 0 {
+		return
+	}
+	t.versions.Supersede(rec.offset, rec.values, t.writeTx)
+}
+
+// CollectGarbage drops the old versions of records no snapshot can see
+// anymore.
+func (t *Table) CollectGarbage() {
+	t.versions.Collect(t.txs.Horizon())
+}
@@ -0,0 +1,184 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	platformio "github.com/9bany/db/internal/platform/parser/io"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// DefaultCheckpointPolicy checkpoints once the log reaches 4MB.
+var DefaultCheckpointPolicy = CheckpointPolicy{MaxSize: 4 << 20}
+
+// CheckpointPolicy triggers a checkpoint after a commit once the log grows
+// past MaxSize bytes or Interval elapsed since the last checkpoint. A zero
+// value disables its trigger.
+type CheckpointPolicy struct {
+	MaxSize  int64
+	Interval time.Duration
+}
+
+// SetCheckpointPolicy makes Commit call checkpoint whenever p is due.
+// checkpoint is expected to flush the tables and call Checkpoint.
+func (w *WAL) SetCheckpointPolicy(p CheckpointPolicy, checkpoint func() error) {
+	w.policy = p
+	w.checkpoint = checkpoint
+}
+
+// checkpointDue reports whether the policy asks for a checkpoint.
+func (w *WAL) checkpointDue() (bool, error) {
+	if w.checkpoint == nil || w.checkpointing {
+		return false, nil
+	}
+	if w.policy.Interval > 0 && time.Since(w.lastCheckpoint) >= w.policy.Interval {
+		return true, nil
+	}
+	if w.policy.MaxSize <= 0 {
+		return false, nil
+	}
+	size, err := w.Size()
+	if err != nil {
+		return false, fmt.Errorf("WAL.checkpointDue: %w", err)
+	}
+	return size >= w.policy.MaxSize, nil
+}
+
+// runCheckpoint calls the checkpoint function of the policy when it is due.
+func (w *WAL) runCheckpoint() error {
+	due, err := w.checkpointDue()
+	if err != nil || !due {
+		return err
+	}
+	w.checkpointing = true
+	defer func() {
+		w.checkpointing = false
+	}()
+	return w.checkpoint()
+}
+
+// Checkpoint records the LSN of the last commit as the checkpoint and
+// removes every entry up to it from the log. The tables must be flushed
+// before: committed entries are not redone anymore once removed. The log
+// is rewritten to a temporary file renamed over it, so a crash leaves
+// either the old or the new log. It returns the checkpoint LSN.
+func (w *WAL) Checkpoint() (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	committed, err := w.lastCommittedLSN()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+	}
+	pending, err := w.pending()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+	}
+
+	// the checkpoint LSN is recorded first: LSNs continue after it once the
+	// entries are removed
+	lsn, err := encoding.NewTLVMarshaler(committed).MarshalBinary()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+	}
+	if err := w.writeAtomic(w.checkpointPath(), lsn); err != nil {
+		return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+	}
+
+	buf := bytes.Buffer{}
+	for _, record := range pending {
+		b, err := walencoding.NewWALMarshaler(record.LSN, record.Op, record.Table, record.Data).MarshalBinary()
+		if err != nil {
+			return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+		}
+		buf.Write(b)
+	}
+	if err := w.replace(buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("WAL.Checkpoint: %w", err)
+	}
+	w.lastCheckpoint = time.Now()
+	return committed, nil
+}
+
+// CheckpointLSN returns the LSN of the last checkpoint, 0 before the first
+// one.
+func (w *WAL) CheckpointLSN() (int64, error) {
+	data, err := w.fs.ReadFile(w.checkpointPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("WAL.CheckpointLSN: %w", err)
+	}
+	val, err := parser.NewTLVParser(platformio.NewReader(bytes.NewReader(data))).Parse()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.CheckpointLSN: %w", err)
+	}
+	lsn, ok := val.(int64)
+	if !ok {
+		return 0, fmt.Errorf("WAL.CheckpointLSN: invalid LSN: %v", val)
+	}
+	return lsn, nil
+}
+
+// Size returns the size of the log in bytes.
+func (w *WAL) Size() (int64, error) {
+	stat, err := w.f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.Size: %w", err)
+	}
+	return stat.Size(), nil
+}
+
+// replace atomically swaps the content of the log with data.
+func (w *WAL) replace(data []byte) error {
+	w.syncer.mu.Lock()
+	defer w.syncer.mu.Unlock()
+	path := w.f.Name()
+	if err := w.writeAtomic(path, data); err != nil {
+		return fmt.Errorf("WAL.replace: %w", err)
+	}
+	f, err := w.fs.OpenFile(path, os.O_RDWR, 0777)
+	if err != nil {
+		return fmt.Errorf("WAL.replace: %w", err)
+	}
+	w.f.Close()
+	w.f = f
+	if _, err := w.f.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("WAL.replace: %w", err)
+	}
+	return nil
+}
+
+// writeAtomic writes data to a temporary file synced and renamed over the
+// file at path, so a crash leaves either the old or the new content.
+func (w *WAL) writeAtomic(path string, data []byte) error {
+	tmp, err := w.fs.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("WAL.writeAtomic: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("WAL.writeAtomic: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("WAL.writeAtomic: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("WAL.writeAtomic: %w", err)
+	}
+	if err := w.fs.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("WAL.writeAtomic: %w", err)
+	}
+	return nil
+}
+
+func (w *WAL) checkpointPath() string {
+	return filepath.Join(w.dir, fmt.Sprintf(CheckpointFilenameTmpl, w.name))
+}
@@ -0,0 +1,241 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/9bany/db/internal/platform/vfs"
+)
+
+// Durability tells when the log and the table files are forced to stable
+// storage.
+type Durability string
+
+const (
+	// DurabilityAlways syncs every entry when it is logged, and the tables
+	// and the commit marker when it is committed.
+	DurabilityAlways Durability = "always"
+	// DurabilityGroup makes a commit wait up to a window for other commits
+	// and syncs once for all of them.
+	DurabilityGroup Durability = "group"
+	// DurabilityInterval syncs in the background at a fixed interval.
+	// Commits do not wait, the changes of the last interval can be lost.
+	DurabilityInterval Durability = "interval"
+	// DurabilityOff leaves syncing to the operating system.
+	DurabilityOff Durability = "off"
+)
+
+func ParseDurability(s string) (Durability, error) {
+	switch d := Durability(s); d {
+	case DurabilityAlways, DurabilityGroup, DurabilityInterval, DurabilityOff:
+		return d, nil
+	}
+	return "", NewUnknownDurabilityError(s)
+}
+
+// DurabilityPolicy is the durability mode of a log with its timings.
+type DurabilityPolicy struct {
+	Mode Durability
+	// Window is how long a group commit waits for other commits.
+	Window time.Duration
+	// Interval separates background syncs.
+	Interval time.Duration
+}
+
+var DefaultDurabilityPolicy = DurabilityPolicy{
+	Mode:     DurabilityAlways,
+	Window:   2 * time.Millisecond,
+	Interval: time.Second,
+}
+
+// syncer forces the log and the table files written since the last sync
+// to stable storage.
+type syncer struct {
+	mu sync.Mutex
+	// dirty holds the table files written since the last sync
+	dirty map[vfs.File]struct{}
+
+	// group commit: commits joining batch wait until done reaches it
+	groupMu        sync.Mutex
+	groupCond      *sync.Cond
+	batch, done    uint64
+	groupScheduled bool
+	groupErr       error
+
+	// interval syncs
+	stop    chan struct{}
+	syncErr error
+}
+
+func newSyncer() *syncer {
+	s := &syncer{dirty: make(map[vfs.File]struct{}), batch: 1}
+	s.groupCond = sync.NewCond(&s.groupMu)
+	return s
+}
+
+// SetDurability changes the durability policy of the log.
+func (w *WAL) SetDurability(p DurabilityPolicy) error {
+	if _, err := ParseDurability(string(p.Mode)); err != nil {
+		return fmt.Errorf("WAL.SetDurability: %w", err)
+	}
+	if p.Mode == DurabilityInterval && p.Interval <= 0 {
+		return fmt.Errorf("WAL.SetDurability: interval must be positive")
+	}
+	w.stopIntervalSync()
+	w.durability = p
+	if p.Mode == DurabilityInterval {
+		w.startIntervalSync(p.Interval)
+	}
+	return nil
+}
+
+func (w *WAL) Durability() DurabilityPolicy {
+	return w.durability
+}
+
+// Dirty tells the log that f was written by the operation being committed,
+// so it is synced along with the log.
+func (w *WAL) Dirty(f vfs.File) {
+	w.syncer.mu.Lock()
+	defer w.syncer.mu.Unlock()
+	w.syncer.dirty[f] = struct{}{}
+}
+
+// syncAppend is called once an entry is written to the log.
+func (w *WAL) syncAppend() error {
+	if w.durability.Mode != DurabilityAlways {
+		return nil
+	}
+	w.syncer.mu.Lock()
+	defer w.syncer.mu.Unlock()
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("WAL.syncAppend: %w", err)
+	}
+	return nil
+}
+
+// syncCommit is called before the commit marker is written: the changes it
+// covers must be stable first.
+func (w *WAL) syncCommit() error {
+	switch w.durability.Mode {
+	case DurabilityAlways:
+		return w.sync()
+	case DurabilityGroup:
+		return w.groupSync()
+	case DurabilityInterval:
+		w.syncer.mu.Lock()
+		defer w.syncer.mu.Unlock()
+		err := w.syncer.syncErr
+		w.syncer.syncErr = nil
+		return err
+	}
+	return nil
+}
+
+// syncMarker is called once the commit marker is written.
+func (w *WAL) syncMarker() error {
+	if w.durability.Mode != DurabilityAlways {
+		return nil
+	}
+	if err := w.lastCommitf.Sync(); err != nil {
+		return fmt.Errorf("WAL.syncMarker: %w", err)
+	}
+	return nil
+}
+
+// sync forces the log and the dirty table files to stable storage.
+func (w *WAL) sync() error {
+	w.syncer.mu.Lock()
+	defer w.syncer.mu.Unlock()
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("WAL.sync: %w", err)
+	}
+	for f := range w.syncer.dirty {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("WAL.sync: %w", err)
+		}
+		delete(w.syncer.dirty, f)
+	}
+	if err := w.lastCommitf.Sync(); err != nil {
+		return fmt.Errorf("WAL.sync: %w", err)
+	}
+	return nil
+}
+
+// groupSync joins the current batch of commits and waits until one sync
+// made after the window covers it. The first commit of a batch schedules
+// the sync.
+func (w *WAL) groupSync() error {
+	s := w.syncer
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+	batch := s.batch
+	if !s.groupScheduled {
+		s.groupScheduled = true
+		go func() {
+			time.Sleep(w.durability.Window)
+			s.groupMu.Lock()
+			s.groupScheduled = false
+			synced := s.batch
+			s.batch++
+			s.groupMu.Unlock()
+
+			err := w.sync()
+
+			s.groupMu.Lock()
+			s.done, s.groupErr = synced, err
+			s.groupCond.Broadcast()
+			s.groupMu.Unlock()
+		}()
+	}
+	for s.done < batch {
+		s.groupCond.Wait()
+	}
+	return s.groupErr
+}
+
+func (w *WAL) startIntervalSync(interval time.Duration) {
+	stop := make(chan struct{})
+	w.syncer.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.sync(); err != nil {
+					w.syncer.mu.Lock()
+					w.syncer.syncErr = err
+					w.syncer.mu.Unlock()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *WAL) stopIntervalSync() {
+	if w.syncer.stop != nil {
+		close(w.syncer.stop)
+		w.syncer.stop = nil
+	}
+}
+
+// Close syncs and closes the log.
+func (w *WAL) Close() error {
+	w.stopIntervalSync()
+	if w.durability.Mode != DurabilityOff {
+		if err := w.sync(); err != nil {
+			return fmt.Errorf("WAL.Close: %w", err)
+		}
+	}
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("WAL.Close: %w", err)
+	}
+	if err := w.lastCommitf.Close(); err != nil {
+		return fmt.Errorf("WAL.Close: %w", err)
+	}
+	return nil
+}
@@ -9,17 +9,17 @@ import (
 )
 
 type LastCommitMarshaler struct {
-	ID  string
+	LSN int64
 	Len uint32
 }
 type LastCommitUnmarshaler struct {
-	ID  string
+	LSN int64
 	Len uint32
 }
 
-func NewLastCommitMarshaler(id string, len uint32) *LastCommitMarshaler {
+func NewLastCommitMarshaler(lsn int64, len uint32) *LastCommitMarshaler {
 	return &LastCommitMarshaler{
-		ID:  id,
+		LSN: lsn,
 		Len: len,
 	}
 }
@@ -45,13 +45,13 @@ func (m *LastCommitMarshaler) MarshalBinary() ([]byte, error) {
 	}
 	buf.Write(lenBuf)
 
-	idMarshaler := encoding.NewTLVMarshaler(m.ID)
-	idBuf, err := idMarshaler.MarshalBinary()
+	lsnMarshaler := encoding.NewTLVMarshaler(m.LSN)
+	lsnBuf, err := lsnMarshaler.MarshalBinary()
 	if err != nil {
-		return nil, fmt.Errorf("LastCommitMarshaler.MarshalBinary: idMarshaler %w", err)
+		return nil, fmt.Errorf("LastCommitMarshaler.MarshalBinary: lsnMarshaler %w", err)
 	}
 
-	buf.Write(idBuf)
+	buf.Write(lsnBuf)
 
 	recordLenMarshaler := encoding.NewTLVMarshaler(m.Len)
 	recordLenBuf, err := recordLenMarshaler.MarshalBinary()
@@ -64,8 +64,8 @@ func (m *LastCommitMarshaler) MarshalBinary() ([]byte, error) {
 }
 
 func (l *LastCommitMarshaler) len() (uint32, error) {
-	idTVLMarshaler := encoding.NewTLVMarshaler(l.ID)
-	idLength, err := idTVLMarshaler.TLVLength()
+	lsnTVLMarshaler := encoding.NewTLVMarshaler(l.LSN)
+	lsnLength, err := lsnTVLMarshaler.TLVLength()
 	if err != nil {
 		return 0, err
 	}
@@ -75,7 +75,7 @@ func (l *LastCommitMarshaler) len() (uint32, error) {
 	if err != nil {
 		return 0, err
 	}
-	value := types.LenMeta + idLength + lenLength
+	value := types.LenMeta + lsnLength + lenLength
 	return value, nil
 }
 
@@ -101,13 +101,13 @@ func (u *LastCommitUnmarshaler) UnmarshalBinary(data []byte) error {
 	}
 	bytesRead += types.LenInt32
 
-	// ID
-	idUnmarshaler := encoding.NewTLVUnmarshaler(&encoding.ValueUnmarshaler[string]{})
-	if err := idUnmarshaler.UnmarshalBinary(data[bytesRead:]); err != nil {
-		return fmt.Errorf("LastCommitUnmarshaler.UnmarshalBinary: ID: %w", err)
+	// LSN
+	lsnUnmarshaler := encoding.NewTLVUnmarshaler(&encoding.ValueUnmarshaler[int64]{})
+	if err := lsnUnmarshaler.UnmarshalBinary(data[bytesRead:]); err != nil {
+		return fmt.Errorf("LastCommitUnmarshaler.UnmarshalBinary: LSN: %w", err)
 	}
-	u.ID = idUnmarshaler.Value
-	bytesRead += idUnmarshaler.BytesRead
+	u.LSN = lsnUnmarshaler.Value
+	bytesRead += lsnUnmarshaler.BytesRead
 
 	intUnmarshaler = encoding.NewValueUnmarshaler[uint32]()
 	lenUnmarshaler := encoding.NewTLVUnmarshaler(intUnmarshaler)
@@ -10,18 +10,44 @@ import (
 
 const (
 	OpInsert = "insert"
+	// OpUpdate carries the size of the table file when it was logged and the
+	// number of updated records followed, for each of them, by its offset,
+	// its before image and its after image. An after image as large as the
+	// before image replaces it in place, otherwise the old record is deleted
+	// and the after image appended.
+	OpUpdate = "update"
+	// OpInsertBatch carries the size of the table file when it was logged
+	// and the number of records followed by the records.
+	OpInsertBatch = "insert_batch"
+	// OpDelete carries the number of deleted records followed, for each of
+	// them, by its offset and its before image.
+	OpDelete = "delete"
+	// OpTx carries the operations of a transaction on several tables. Each
+	// one is its table, its operation, the length of its data and the data.
+	OpTx = "tx"
+	// OpAbort carries the LSN of an entry whose changes could not all be
+	// applied and were rolled back.
+	OpAbort = "abort"
+	// OpSavepoint carries the id of the transaction setting a savepoint.
+	OpSavepoint = "savepoint"
+	// OpUndo carries the id of a transaction followed by how to undo a
+	// change it buffered to the table of the entry.
+	OpUndo = "undo"
+	// OpRollbackTo carries the id of a transaction and the LSN of the
+	// savepoint it rolled back to: the OpUndo entries in between are undone.
+	OpRollbackTo = "rollback_to"
 )
 
 type WALMarshaler struct {
-	ID    string
+	LSN   int64
 	Table string
 	Op    string
 	Data  []byte
 }
 
-func NewWALMarshaler(id, op, table string, data []byte) *WALMarshaler {
+func NewWALMarshaler(lsn int64, op, table string, data []byte) *WALMarshaler {
 	return &WALMarshaler{
-		ID:    id,
+		LSN:   lsn,
 		Table: table,
 		Op:    op,
 		Data:  data,
@@ -50,12 +76,12 @@ func (m *WALMarshaler) MarshalBinary() ([]byte, error) {
 	}
 	buf.Write(lenBuf)
 
-	idMarshaler := encoding.NewTLVMarshaler(m.ID)
-	idBuf, err := idMarshaler.MarshalBinary()
+	lsnMarshaler := encoding.NewTLVMarshaler(m.LSN)
+	lsnBuf, err := lsnMarshaler.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("WAL.Append: %w", err)
 	}
-	buf.Write(idBuf)
+	buf.Write(lsnBuf)
 
 	opMarshaler := encoding.NewTLVMarshaler(m.Op)
 	opBuf, err := opMarshaler.MarshalBinary()
@@ -76,11 +102,11 @@ func (m *WALMarshaler) MarshalBinary() ([]byte, error) {
 }
 
 func (m *WALMarshaler) len() (uint32, error) {
-	idMarshaler := encoding.NewTLVMarshaler(m.ID)
-	opMarshaler := encoding.NewTLVMarshaler(OpInsert)
+	lsnMarshaler := encoding.NewTLVMarshaler(m.LSN)
+	opMarshaler := encoding.NewTLVMarshaler(m.Op)
 	tableMarshaler := encoding.NewTLVMarshaler(m.Table)
 
-	idLen, err := idMarshaler.TLVLength()
+	lsnLen, err := lsnMarshaler.TLVLength()
 	if err != nil {
 		return 0, fmt.Errorf("WALMarshaler: %w", err)
 	}
@@ -93,5 +119,5 @@ func (m *WALMarshaler) len() (uint32, error) {
 		return 0, fmt.Errorf("WALMarshaler: %w", err)
 	}
 
-	return idLen + opLen + tableLen + uint32(len(m.Data)), nil
+	return lsnLen + opLen + tableLen + uint32(len(m.Data)), nil
 }
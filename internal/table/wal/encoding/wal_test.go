@@ -3,15 +3,15 @@ package encoding
 import "testing"
 
 func TestNewWALMarshaler(t *testing.T) {
-	id := "test-id"
+	lsn := int64(42)
 	op := OpInsert
 	table := "test-table"
 	data := []byte("test-data")
 
-	marshaler := NewWALMarshaler(id, op, table, data)
+	marshaler := NewWALMarshaler(lsn, op, table, data)
 
-	if marshaler.ID != id {
-		t.Errorf("expected ID to be %s, got %s", id, marshaler.ID)
+	if marshaler.LSN != lsn {
+		t.Errorf("expected LSN to be %d, got %d", lsn, marshaler.LSN)
 	}
 	if marshaler.Op != op {
 		t.Errorf("expected Op to be %s, got %s", op, marshaler.Op)
@@ -25,12 +25,12 @@ func TestNewWALMarshaler(t *testing.T) {
 }
 
 func TestWALMarshaler_MarshalBinary(t *testing.T) {
-	id := "test-id"
+	lsn := int64(42)
 	op := OpInsert
 	table := "test-table"
 	data := []byte("test-data")
 
-	marshaler := NewWALMarshaler(id, op, table, data)
+	marshaler := NewWALMarshaler(lsn, op, table, data)
 
 	result, err := marshaler.MarshalBinary()
 	if err != nil {
@@ -43,12 +43,12 @@ func TestWALMarshaler_MarshalBinary(t *testing.T) {
 }
 
 func TestWALMarshaler_len(t *testing.T) {
-	id := "test-id"
+	lsn := int64(42)
 	op := OpInsert
 	table := "test-table"
 	data := []byte("test-data")
 
-	marshaler := NewWALMarshaler(id, op, table, data)
+	marshaler := NewWALMarshaler(lsn, op, table, data)
 
 	length, err := marshaler.len()
 	if err != nil {
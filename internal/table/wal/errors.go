@@ -0,0 +1,29 @@
+package wal
+
+import "fmt"
+
+type UnknownDurabilityError struct {
+	mode string
+}
+
+func NewUnknownDurabilityError(mode string) *UnknownDurabilityError {
+	return &UnknownDurabilityError{mode: mode}
+}
+
+func (e *UnknownDurabilityError) Error() string {
+	return fmt.Sprintf("unknown durability: %s", e.mode)
+}
+
+// InvalidOperationsError is returned when the data of an OpTx entry does not
+// decode to operations.
+type InvalidOperationsError struct {
+	reason string
+}
+
+func NewInvalidOperationsError(reason string) *InvalidOperationsError {
+	return &InvalidOperationsError{reason: reason}
+}
+
+func (e *InvalidOperationsError) Error() string {
+	return fmt.Sprintf("invalid operations: %s", e.reason)
+}
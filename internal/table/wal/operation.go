@@ -0,0 +1,90 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	platformio "github.com/9bany/db/internal/platform/parser/io"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// Operation is the change to one table logged as part of an OpTx entry.
+type Operation struct {
+	Table string
+	Op    string
+	Data  []byte
+}
+
+// MarshalOperations encodes ops as the data of an OpTx entry.
+func MarshalOperations(ops []Operation) ([]byte, error) {
+	buf := bytes.Buffer{}
+	for _, op := range ops {
+		for _, v := range []interface{}{op.Table, op.Op, int64(len(op.Data))} {
+			b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("MarshalOperations: %w", err)
+			}
+			buf.Write(b)
+		}
+		buf.Write(op.Data)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalOperations decodes the data of an OpTx entry.
+func UnmarshalOperations(data []byte) ([]Operation, error) {
+	r := platformio.NewReader(bytes.NewReader(data))
+	tlvParser := parser.NewTLVParser(r)
+	ops := make([]Operation, 0)
+	for {
+		table, err := tlvParser.Parse()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ops, nil
+			}
+			return nil, fmt.Errorf("UnmarshalOperations: %w", err)
+		}
+		op, err := tlvParser.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", err)
+		}
+		length, err := tlvParser.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", err)
+		}
+		tableName, ok := table.(string)
+		if !ok {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", NewInvalidOperationsError(fmt.Sprintf("table is %T, not a string", table)))
+		}
+		opName, ok := op.(string)
+		if !ok {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", NewInvalidOperationsError(fmt.Sprintf("operation is %T, not a string", op)))
+		}
+		size, ok := length.(int64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", NewInvalidOperationsError(fmt.Sprintf("invalid data length %v", length)))
+		}
+		opData := make([]byte, size)
+		if _, err := io.ReadFull(r, opData); err != nil {
+			return nil, fmt.Errorf("UnmarshalOperations: %w", err)
+		}
+		ops = append(ops, Operation{Table: tableName, Op: opName, Data: opData})
+	}
+}
+
+// Operations returns the operations of the entry: the ones of an OpTx
+// entry, the entry itself otherwise.
+func (r *Record) Operations() ([]Operation, error) {
+	if r.Op != walencoding.OpTx {
+		return []Operation{{Table: r.Table, Op: r.Op, Data: r.Data}}, nil
+	}
+	ops, err := UnmarshalOperations(r.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Record.Operations: %w", err)
+	}
+	return ops, nil
+}
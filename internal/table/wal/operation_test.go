@@ -0,0 +1,43 @@
+package wal
+
+import (
+	"testing"
+
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalOperations(t *testing.T) {
+	ops := []Operation{
+		{Table: "users", Op: "insert", Data: []byte{1, 2, 3}},
+		{Table: "orders", Op: "delete", Data: []byte{}},
+	}
+	data, err := MarshalOperations(ops)
+	assert.Nil(t, err)
+	decoded, err := UnmarshalOperations(data)
+	assert.Nil(t, err)
+	assert.Equal(t, ops, decoded)
+}
+
+func TestUnmarshalOperations_Invalid(t *testing.T) {
+	encode := func(values ...interface{}) []byte {
+		data := make([]byte, 0)
+		for _, v := range values {
+			b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+			assert.Nil(t, err)
+			data = append(data, b...)
+		}
+		return data
+	}
+
+	for _, data := range [][]byte{
+		encode(int32(1), "insert", int64(0)),
+		encode("users", int64(2), int64(0)),
+		encode("users", "insert", "3"),
+		encode("users", "insert", int64(-1)),
+	} {
+		_, err := UnmarshalOperations(data)
+		var invalid *InvalidOperationsError
+		assert.ErrorAs(t, err, &invalid)
+	}
+}
@@ -0,0 +1,118 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	platformio "github.com/9bany/db/internal/platform/parser/io"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// Abort logs that the changes of entry could not all be applied and are
+// rolled back. Both entries stay in flight until the returned abort entry
+// is committed, once the changes are undone, so recovery finishes the
+// rollback after a crash.
+func (w *WAL) Abort(entry *Entry, table string) (*Entry, error) {
+	data, err := encoding.NewTLVMarshaler(entry.LSN).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.Abort: %w", err)
+	}
+	abort, err := w.AppendLog(walencoding.OpAbort, table, data)
+	if err != nil {
+		return nil, fmt.Errorf("WAL.Abort: %w", err)
+	}
+	abort.aborts = entry.LSN
+	return abort, nil
+}
+
+// Recover brings the tables up to date with the entries logged after the
+// last commit, in three passes. Analysis finds the entries rolled back by
+// an abort entry. Redo calls redo with every other entry in LSN order, the
+// rolled back ones included: history is repeated so their changes are all
+// in place. Undo then calls undo with every rolled back entry, the latest
+// first, and the LSN of its abort entry. The savepoint and undo entries of
+// the transactions running at the crash are skipped: their changes were
+// never committed. The entries are committed once they are all recovered.
+func (w *WAL) Recover(redo func(record *Record) error, undo func(record *Record, abort int64) error) error {
+	records, err := w.Pending()
+	if err != nil {
+		return fmt.Errorf("WAL.Recover: %w", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	aborted := make(map[int64]int64)
+	for _, record := range records {
+		if record.Op != walencoding.OpAbort {
+			continue
+		}
+		lsn, err := abortedLSN(record)
+		if err != nil {
+			return fmt.Errorf("WAL.Recover: LSN %d: %w", record.LSN, err)
+		}
+		aborted[lsn] = record.LSN
+	}
+
+	for _, record := range records {
+		if record.Op == walencoding.OpAbort || transient(record.Op) {
+			continue
+		}
+		if err := redo(record); err != nil {
+			return fmt.Errorf("WAL.Recover: redo LSN %d: %w", record.LSN, err)
+		}
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		abort, ok := aborted[records[i].LSN]
+		if !ok {
+			continue
+		}
+		if err := undo(records[i], abort); err != nil {
+			return fmt.Errorf("WAL.Recover: undo LSN %d: %w", records[i].LSN, err)
+		}
+	}
+
+	last := records[len(records)-1].LSN
+	if err := w.syncCommit(); err != nil {
+		return fmt.Errorf("WAL.Recover: %w", err)
+	}
+	if err := w.settle(func(lsn int64) bool { return lsn <= last }); err != nil {
+		return fmt.Errorf("WAL.Recover: %w", err)
+	}
+	return nil
+}
+
+// abortedLSN returns the LSN of the entry rolled back by an abort entry.
+func abortedLSN(record *Record) (int64, error) {
+	val, err := parser.NewTLVParser(platformio.NewReader(bytes.NewReader(record.Data))).Parse()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.abortedLSN: %w", err)
+	}
+	lsn, ok := val.(int64)
+	if !ok {
+		return 0, fmt.Errorf("WAL.abortedLSN: invalid LSN: %v", val)
+	}
+	return lsn, nil
+}
+
+// repair cuts an entry torn by a crash at the end of the log. The entry was
+// never entirely logged, so its changes were never applied.
+func (w *WAL) repair() error {
+	_, end, err := w.readLog()
+	if err != nil {
+		return fmt.Errorf("WAL.repair: %w", err)
+	}
+	size, err := w.Size()
+	if err != nil {
+		return fmt.Errorf("WAL.repair: %w", err)
+	}
+	if end == size {
+		return nil
+	}
+	if err := w.f.Truncate(end); err != nil {
+		return fmt.Errorf("WAL.repair: %w", err)
+	}
+	return nil
+}
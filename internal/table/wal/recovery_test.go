@@ -0,0 +1,99 @@
+package wal
+
+import (
+	"testing"
+
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALRecover(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	entries := make([]*Entry, 0, 3)
+	for i := 0; i < 3; i++ {
+		entry, err := w.AppendLog("insert", "tb_user", data)
+		assert.Nil(t, err)
+		entries = append(entries, entry)
+	}
+	abort, err := w.Abort(entries[1], "tb_user")
+	assert.Nil(t, err)
+
+	var redone []int64
+	undone := make(map[int64]int64)
+	err = w.Recover(func(record *Record) error {
+		assert.NotEqual(t, walencoding.OpAbort, record.Op)
+		redone = append(redone, record.LSN)
+		return nil
+	}, func(record *Record, abortLSN int64) error {
+		assert.Len(t, redone, 3, "undo runs after redo")
+		undone[record.LSN] = abortLSN
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, redone)
+	assert.Equal(t, map[int64]int64{2: abort.LSN}, undone)
+
+	pending, err := w.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestWALCommitKeepsOlderEntriesPending(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWal(dir, "db")
+	assert.Nil(t, err)
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	first, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	second, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Commit(second))
+
+	pending, err := w.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+
+	assert.Nil(t, w.Commit(first))
+	assert.Nil(t, w.Close())
+	w, err = NewWal(dir, "db")
+	assert.Nil(t, err)
+	pending, err = w.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestWALRepairsTornEntry(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWal(dir, "db")
+	assert.Nil(t, err)
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	_, err = w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	_, err = w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	size, err := w.Size()
+	assert.Nil(t, err)
+	assert.Nil(t, w.f.Truncate(size-3))
+	assert.Nil(t, w.Close())
+
+	w, err = NewWal(dir, "db")
+	assert.Nil(t, err)
+	pending, err := w.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, int64(1), pending[0].LSN)
+	entry, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), entry.LSN)
+	pending, err = w.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+}
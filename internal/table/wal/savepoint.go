@@ -0,0 +1,134 @@
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/9bany/db/internal/platform/parser"
+	"github.com/9bany/db/internal/platform/parser/encoding"
+	platformio "github.com/9bany/db/internal/platform/parser/io"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// LogSavepoint logs a savepoint of the transaction tx. The changes the
+// transaction buffers afterwards are logged with LogUndo, so RollbackTo can
+// undo them from the log. The entries of a transaction stay in flight until
+// it ends and they are forgotten with Forget.
+func (w *WAL) LogSavepoint(tx int64, table string) (*Entry, error) {
+	data, err := encoding.NewTLVMarshaler(tx).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.LogSavepoint: %w", err)
+	}
+	entry, err := w.AppendLog(walencoding.OpSavepoint, table, data)
+	if err != nil {
+		return nil, fmt.Errorf("WAL.LogSavepoint: %w", err)
+	}
+	return entry, nil
+}
+
+// LogUndo logs data, how to undo a change the transaction tx buffered to
+// table.
+func (w *WAL) LogUndo(tx int64, table string, data []byte) (*Entry, error) {
+	buf, err := encoding.NewTLVMarshaler(tx).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.LogUndo: %w", err)
+	}
+	entry, err := w.AppendLog(walencoding.OpUndo, table, append(buf, data...))
+	if err != nil {
+		return nil, fmt.Errorf("WAL.LogUndo: %w", err)
+	}
+	return entry, nil
+}
+
+// LogRollbackTo logs that the transaction tx undid its changes back to the
+// savepoint entry savepoint. Their undo entries are not returned by
+// UndoEntries anymore.
+func (w *WAL) LogRollbackTo(tx int64, table string, savepoint int64) (*Entry, error) {
+	buf := bytes.Buffer{}
+	for _, v := range []int64{tx, savepoint} {
+		b, err := encoding.NewTLVMarshaler(v).MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("WAL.LogRollbackTo: %w", err)
+		}
+		buf.Write(b)
+	}
+	entry, err := w.AppendLog(walencoding.OpRollbackTo, table, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("WAL.LogRollbackTo: %w", err)
+	}
+	return entry, nil
+}
+
+// UndoEntries returns the undo entries the transaction tx logged after the
+// savepoint entry savepoint, the latest first, their data stripped of tx.
+// The entries undone by a rollback to a savepoint are skipped.
+func (w *WAL) UndoEntries(tx, savepoint int64) ([]*Record, error) {
+	records, err := w.Pending()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.UndoEntries: %w", err)
+	}
+	undo := make([]*Record, 0)
+	// the entries after until are undone already
+	until := int64(math.MaxInt64)
+	for i := len(records) - 1; i >= 0 && records[i].LSN > savepoint; i-- {
+		record := records[i]
+		if record.LSN > until {
+			continue
+		}
+		if record.Op != walencoding.OpUndo && record.Op != walencoding.OpRollbackTo {
+			continue
+		}
+		owner, data, err := readInt64(record.Data)
+		if err != nil {
+			return nil, fmt.Errorf("WAL.UndoEntries: LSN %d: %w", record.LSN, err)
+		}
+		if owner != tx {
+			continue
+		}
+		if record.Op == walencoding.OpRollbackTo {
+			if until, _, err = readInt64(data); err != nil {
+				return nil, fmt.Errorf("WAL.UndoEntries: LSN %d: %w", record.LSN, err)
+			}
+			continue
+		}
+		undo = append(undo, &Record{Entry: record.Entry, Op: record.Op, Table: record.Table, Data: data})
+	}
+	return undo, nil
+}
+
+// Forget removes entries from the ones in flight without committing them,
+// once the transaction that logged them ends: they need no recovery. The
+// commit marker moves past them with the next commit.
+func (w *WAL) Forget(entries []*Entry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range entries {
+		delete(w.inflight, entry.LSN)
+	}
+}
+
+// transient reports whether op only matters to a running transaction.
+// Savepoint and undo entries describe changes that were never logged as
+// committed, recovery skips them.
+func transient(op string) bool {
+	switch op {
+	case walencoding.OpSavepoint, walencoding.OpUndo, walencoding.OpRollbackTo:
+		return true
+	}
+	return false
+}
+
+// readInt64 returns the int64 data starts with and the rest of data.
+func readInt64(data []byte) (int64, []byte, error) {
+	r := bytes.NewReader(data)
+	val, err := parser.NewTLVParser(platformio.NewReader(r)).Parse()
+	if err != nil {
+		return 0, nil, fmt.Errorf("WAL.readInt64: %w", err)
+	}
+	v, ok := val.(int64)
+	if !ok {
+		return 0, nil, fmt.Errorf("WAL.readInt64: invalid int64: %v", val)
+	}
+	return v, data[len(data)-r.Len():], nil
+}
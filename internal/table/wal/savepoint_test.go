@@ -0,0 +1,99 @@
+package wal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALUndoEntries(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+
+	outer, err := w.LogSavepoint(1, "db")
+	assert.Nil(t, err)
+	_, err = w.LogUndo(1, "users", []byte("a"))
+	assert.Nil(t, err)
+	// another transaction's entries are skipped
+	_, err = w.LogUndo(2, "users", []byte("other"))
+	assert.Nil(t, err)
+	inner, err := w.LogSavepoint(1, "db")
+	assert.Nil(t, err)
+	_, err = w.LogUndo(1, "orders", []byte("b"))
+	assert.Nil(t, err)
+
+	undo, err := w.UndoEntries(1, inner.LSN)
+	assert.Nil(t, err)
+	assert.Len(t, undo, 1)
+	assert.Equal(t, "orders", undo[0].Table)
+	assert.Equal(t, []byte("b"), undo[0].Data)
+
+	// the rolled back entries are not undone twice
+	_, err = w.LogRollbackTo(1, "db", inner.LSN)
+	assert.Nil(t, err)
+	_, err = w.LogUndo(1, "users", []byte("c"))
+	assert.Nil(t, err)
+	undo, err = w.UndoEntries(1, outer.LSN)
+	assert.Nil(t, err)
+	data := make([]string, 0, len(undo))
+	for _, record := range undo {
+		data = append(data, string(record.Data))
+	}
+	assert.Equal(t, []string{"c", "a"}, data)
+}
+
+func TestWALRecoverSkipsSavepoints(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWal(dir, "db")
+	assert.Nil(t, err)
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	sp, err := w.LogSavepoint(1, "db")
+	assert.Nil(t, err)
+	_, err = w.LogUndo(1, "tb_user", []byte("undo"))
+	assert.Nil(t, err)
+	_, err = w.LogRollbackTo(1, "db", sp.LSN)
+	assert.Nil(t, err)
+	entry, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+
+	restorable, err := w.GetRestorableData()
+	assert.Nil(t, err)
+	assert.Equal(t, entry, restorable.LastEntry)
+
+	var redone []int64
+	err = w.Recover(func(record *Record) error {
+		redone = append(redone, record.LSN)
+		return nil
+	}, func(record *Record, abort int64) error {
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{entry.LSN}, redone)
+}
+
+func TestWALForget(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	sp, err := w.LogSavepoint(1, "db")
+	assert.Nil(t, err)
+	entry, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Commit(entry))
+	// the savepoint in flight holds the commit marker back
+	pending, err := w.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+
+	w.Forget([]*Entry{sp})
+	entry, err = w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Commit(entry))
+	pending, err = w.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
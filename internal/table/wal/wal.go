@@ -2,84 +2,162 @@ package wal
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/9bany/db/internal/platform/parser"
-	"github.com/9bany/db/internal/platform/parser/encoding"
 	platformio "github.com/9bany/db/internal/platform/parser/io"
 	"github.com/9bany/db/internal/platform/types"
+	"github.com/9bany/db/internal/platform/vfs"
 	walencoding "github.com/9bany/db/internal/table/wal/encoding"
 )
 
 const (
 	FilenameTmpl       = "%s_wal.bin"
 	LastIDFilenameTmpl = "%s_wal_last_commit.bin"
+	// CheckpointFilenameTmpl holds the LSN of the last checkpoint.
+	CheckpointFilenameTmpl = "%s_wal_checkpoint.bin"
+	// DatabaseLogName names the log shared by every table of a database.
+	DatabaseLogName = "db"
 )
 
+// Entry identifies an entry of the log by its log sequence number. LSNs
+// start at 1 and increase with every entry appended.
 type Entry struct {
-	Id  string
+	LSN int64
 	Len uint32
+	// aborts is the LSN of the entry rolled back by an abort entry
+	aborts int64
 }
 
-func newEntry(id string, d []byte) *Entry {
+func newEntry(lsn int64, d []byte) *Entry {
 	return &Entry{
-		Id:  id,
+		LSN: lsn,
 		Len: uint32(len(d)),
 	}
 }
 
+// Record is an entry of the log with its operation and data.
+type Record struct {
+	*Entry
+	Op    string
+	Table string
+	Data  []byte
+}
+
 type RestorableData struct {
 	LastEntry *Entry
-	Data      []byte
+	// Data holds the records to append to the table.
+	Data []byte
+	// Deleted holds the offsets of deleted records and of records relocated
+	// by restored updates.
+	Deleted []int64
+	// Overwrites holds the records updated in place.
+	Overwrites []Overwrite
+	// Base is the size of the table file the first restored record was
+	// appended at, zero when unknown.
+	Base int64
+	// Befores holds the before images of the records updated and deleted.
+	Befores []Overwrite
 }
 
-func NewWal(dbPath, tableName string) (*WAL, error) {
-	path := filepath.Join(dbPath, fmt.Sprintf(FilenameTmpl, tableName))
-	f, err := os.OpenFile(path, os.O_RDWR, 0777)
+// Overwrite is a record image to write at Offset of the table file.
+type Overwrite struct {
+	Offset int64
+	Data   []byte
+}
+
+// NewWal opens the log called name in dbPath, creating it when missing.
+func NewWal(dbPath, name string) (*WAL, error) {
+	return NewWalFS(vfs.OS{}, dbPath, name)
+}
+
+// NewWalFS opens the log called name in dbPath of fsys, creating it when
+// missing.
+func NewWalFS(fsys vfs.FS, dbPath, name string) (*WAL, error) {
+	path := filepath.Join(dbPath, fmt.Sprintf(FilenameTmpl, name))
+	f, err := fsys.OpenFile(path, os.O_RDWR, 0777)
 	if err != nil {
-		f, err = os.Create(path)
+		f, err = fsys.Create(path)
 		if err != nil {
 			return nil, fmt.Errorf("NewWal: %w", err)
 		}
 	}
 
-	path = filepath.Join(dbPath, fmt.Sprintf(LastIDFilenameTmpl, tableName))
-	lastCommitfile, err := os.OpenFile(path, os.O_RDWR, 0777)
+	path = filepath.Join(dbPath, fmt.Sprintf(LastIDFilenameTmpl, name))
+	lastCommitfile, err := fsys.OpenFile(path, os.O_RDWR, 0777)
 	if err != nil {
-		lastCommitfile, err = os.Create(path)
+		lastCommitfile, err = fsys.Create(path)
 		if err != nil {
 			return nil, fmt.Errorf("NewWal: %w", err)
 		}
 	}
 
-	return &WAL{
-		f:           f,
-		lastCommitf: lastCommitfile,
-	}, nil
+	w := &WAL{
+		fs:             fsys,
+		dir:            dbPath,
+		name:           name,
+		f:              f,
+		lastCommitf:    lastCommitfile,
+		lastCheckpoint: time.Now(),
+		durability:     DefaultDurabilityPolicy,
+		syncer:         newSyncer(),
+		inflight:       make(map[int64]struct{}),
+	}
+	if err := w.repair(); err != nil {
+		return nil, fmt.Errorf("NewWal: %w", err)
+	}
+	if w.committed, err = w.lastCommittedLSN(); err != nil {
+		return nil, fmt.Errorf("NewWal: %w", err)
+	}
+	if w.lastLSN, err = w.readLastLSN(); err != nil {
+		return nil, fmt.Errorf("NewWal: %w", err)
+	}
+	return w, nil
 }
 
 type WAL struct {
-	f           *os.File
-	lastCommitf *os.File
+	fs          vfs.FS
+	dir         string
+	name        string
+	f           vfs.File
+	lastCommitf vfs.File
+	// mu guards the end of the log and the entries in flight
+	mu sync.Mutex
+	// lastLSN is the LSN of the last entry appended
+	lastLSN int64
+	// inflight holds the entries appended and not committed yet
+	inflight map[int64]struct{}
+	// committed is the LSN of the commit marker
+	committed int64
+
+	policy         CheckpointPolicy
+	checkpoint     func() error
+	checkpointing  bool
+	lastCheckpoint time.Time
+
+	durability DurabilityPolicy
+	syncer     *syncer
+	// commitMu serializes the commits waiting on the same group sync
+	commitMu sync.Mutex
 }
 
+// AppendLog appends an entry for an operation on table and assigns it the
+// next LSN. The entry is in flight until committed.
 func (w *WAL) AppendLog(ops string, table string, data []byte) (*Entry, error) {
-	id, err := generateID()
-	if err != nil {
-		return nil, fmt.Errorf("WAL.AppendLog: %w", err)
-	}
-
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	if _, err := w.f.Seek(0, io.SeekEnd); err != nil {
 		return nil, fmt.Errorf("WAL.AppendLog: %w", err)
 	}
 
-	marshaler := walencoding.NewWALMarshaler(id, ops, table, data)
+	lsn := w.lastLSN + 1
+	marshaler := walencoding.NewWALMarshaler(lsn, ops, table, data)
 	byteData, err := marshaler.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("WAL.AppendLog: %w", err)
@@ -88,55 +166,173 @@ func (w *WAL) AppendLog(ops string, table string, data []byte) (*Entry, error) {
 	if err := w.write(byteData); err != nil {
 		return nil, fmt.Errorf("WAL.AppendLog: %w", err)
 	}
+	if err := w.syncAppend(); err != nil {
+		return nil, fmt.Errorf("WAL.AppendLog: %w", err)
+	}
 
-	return newEntry(id, byteData), nil
+	w.lastLSN = lsn
+	w.inflight[lsn] = struct{}{}
+	return newEntry(lsn, byteData), nil
 }
 
+// Commit records that entry has been applied, along with the entry it
+// rolls back for an abort entry. The commit marker moves to the redo
+// point: the LSN every entry up to which is applied, the one before the
+// oldest entry still in flight. Depending on the durability policy, the
+// log and the table files marked dirty are synced before the commit is
+// recorded.
 func (w *WAL) Commit(entry *Entry) error {
-	marshaler := walencoding.NewLastCommitMarshaler(entry.Id, entry.Len)
-	buf, err := marshaler.MarshalBinary()
-	if err != nil {
+	if err := w.syncCommit(); err != nil {
+		return fmt.Errorf("WAL.Commit: %w", err)
+	}
+	if err := w.settle(func(lsn int64) bool {
+		return lsn == entry.LSN || lsn == entry.aborts
+	}); err != nil {
 		return fmt.Errorf("WAL.Commit: %w", err)
 	}
-	if err := os.WriteFile(w.lastCommitf.Name(), buf, 0644); err != nil {
+	if err := w.runCheckpoint(); err != nil {
 		return fmt.Errorf("WAL.Commit: %w", err)
 	}
 	return nil
 }
 
+// settle removes the entries done reports from the ones in flight and
+// writes the new redo point to the commit marker.
+func (w *WAL) settle(done func(lsn int64) bool) error {
+	w.commitMu.Lock()
+	defer w.commitMu.Unlock()
+	w.mu.Lock()
+	point := w.lastLSN
+	for lsn := range w.inflight {
+		if done(lsn) {
+			delete(w.inflight, lsn)
+		} else if lsn-1 < point {
+			point = lsn - 1
+		}
+	}
+	if point < w.committed {
+		point = w.committed
+	}
+	w.committed = point
+	w.mu.Unlock()
+
+	buf, err := walencoding.NewLastCommitMarshaler(point, 0).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("WAL.settle: %w", err)
+	}
+	if err := w.fs.WriteFile(w.lastCommitf.Name(), buf, 0644); err != nil {
+		return fmt.Errorf("WAL.settle: %w", err)
+	}
+	if err := w.syncMarker(); err != nil {
+		return fmt.Errorf("WAL.settle: %w", err)
+	}
+	return nil
+}
+
+// GetRestorableData returns the data of the entries logged after the last
+// commit, or nil when every entry is committed. Abort, savepoint and undo
+// entries carry no data to restore and are skipped.
 func (w *WAL) GetRestorableData() (*RestorableData, error) {
-	if _, err := w.lastCommitf.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("WAL.GetRestorableData: seek %w", err)
+	records, err := w.Pending()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.GetRestorableData: %w", err)
 	}
-	data := make([]byte, 1024)
-	n, err := w.lastCommitf.Read(data)
+	if len(records) == 0 {
+		return nil, nil
+	}
+	restorable := &RestorableData{LastEntry: records[len(records)-1].Entry}
+	for _, record := range records {
+		if record.Op == walencoding.OpAbort || transient(record.Op) {
+			continue
+		}
+		if err := restorable.Add(record.Op, record.Data); err != nil {
+			return nil, fmt.Errorf("WAL.GetRestorableData: %w", err)
+		}
+	}
+	return restorable, nil
+}
+
+// Pending returns the entries logged after the last commit in LSN order.
+func (w *WAL) Pending() ([]*Record, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pending()
+}
+
+func (w *WAL) pending() ([]*Record, error) {
+	committed, err := w.lastCommittedLSN()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.Pending: %w", err)
+	}
+	records, err := w.readRecords()
 	if err != nil {
-		if err == io.EOF {
-			return nil, nil
+		return nil, fmt.Errorf("WAL.Pending: %w", err)
+	}
+	pending := make([]*Record, 0)
+	for _, record := range records {
+		if record.LSN > committed {
+			pending = append(pending, record)
 		}
-		return nil, fmt.Errorf("WAL.GetRestorableData: read: %w", err)
 	}
-	data = data[:n]
+	return pending, nil
+}
+
+// lastCommittedLSN returns the LSN of the last committed entry, 0 when
+// nothing was committed. A marker torn by a crash while it was rewritten
+// counts as none: the entries after the last checkpoint are all still in
+// the log and are redone.
+func (w *WAL) lastCommittedLSN() (int64, error) {
+	data, err := w.fs.ReadFile(w.lastCommitf.Name())
+	if err != nil {
+		return 0, fmt.Errorf("WAL.lastCommittedLSN: %w", err)
+	}
+	size, err := lastCommitSize()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.lastCommittedLSN: %w", err)
+	}
+	if len(data) < size {
+		return 0, nil
+	}
 	unmarshaler := walencoding.NewLastCommitUnmarshaler()
 	if err = unmarshaler.UnmarshalBinary(data); err != nil {
-		return nil, fmt.Errorf("WAL.GetRestorableData: unmarshal: %w", err)
+		return 0, fmt.Errorf("WAL.lastCommittedLSN: unmarshal: %w", err)
 	}
-	lastCommittedID := unmarshaler.ID
-	lastEntry, err := w.readLastEntry(unmarshaler.Len)
+	return unmarshaler.LSN, nil
+}
+
+// lastCommitSize returns the size of the commit marker, the same for
+// every LSN.
+func lastCommitSize() (int, error) {
+	buf, err := walencoding.NewLastCommitMarshaler(0, 0).MarshalBinary()
 	if err != nil {
-		return nil, fmt.Errorf("WAL.GetRestorableData: %w", err)
+		return 0, fmt.Errorf("WAL.lastCommitSize: %w", err)
 	}
-	if lastEntry.Id == lastCommittedID {
-		return nil, nil
+	return len(buf), nil
+}
+
+// readLastLSN returns the LSN to continue from: the one of the last entry
+// of the log, of the last commit or of the last checkpoint, whichever is
+// higher.
+func (w *WAL) readLastLSN() (int64, error) {
+	last, err := w.lastCommittedLSN()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.readLastLSN: %w", err)
 	}
-	buf, err := w.getRestorableData(lastCommittedID)
+	checkpoint, err := w.CheckpointLSN()
 	if err != nil {
-		return nil, fmt.Errorf("WAL.GetRestorableData: %w", err)
+		return 0, fmt.Errorf("WAL.readLastLSN: %w", err)
 	}
-	return &RestorableData{
-		LastEntry: lastEntry,
-		Data:      buf,
-	}, nil
+	if checkpoint > last {
+		last = checkpoint
+	}
+	records, err := w.readRecords()
+	if err != nil {
+		return 0, fmt.Errorf("WAL.readLastLSN: %w", err)
+	}
+	if len(records) > 0 && records[len(records)-1].LSN > last {
+		last = records[len(records)-1].LSN
+	}
+	return last, nil
 }
 
 func (w *WAL) write(buf []byte) error {
@@ -152,157 +348,205 @@ func (w *WAL) write(buf []byte) error {
 	return nil
 }
 
-func (w *WAL) readLastEntry(length uint32) (*Entry, error) {
-	if _, err := w.f.Seek(-1*int64(length), io.SeekEnd); err != nil {
-		return nil, fmt.Errorf("WAL.readLastEntry: %w", err)
-	}
-
-	buf := make([]byte, length)
-	n, err := w.f.Read(buf)
+// readRecords reads every entry of the log.
+func (w *WAL) readRecords() ([]*Record, error) {
+	records, _, err := w.readLog()
 	if err != nil {
-		return nil, fmt.Errorf("WAL.readLastEntry: %w", err)
-	}
-	if n != int(length) {
-		return nil, fmt.Errorf("WAL.readLastEntry: incomplete read")
-	}
-
-	byteUnmarshaler := encoding.NewValueUnmarshaler[byte]()
-	intUnmarshaler := encoding.NewValueUnmarshaler[uint32]()
-	bytesRead := 0
-
-	// type
-	if err = byteUnmarshaler.UnmarshalBinary(buf); err != nil {
-		return nil, fmt.Errorf("WAL.readLastEntry: type: %w", err)
-	}
-	bytesRead += types.LenByte
-
-	// len
-	if err = intUnmarshaler.UnmarshalBinary(buf[bytesRead:]); err != nil {
-		return nil, fmt.Errorf("WAL.readLastEntry: len: %w", err)
+		return nil, fmt.Errorf("WAL.readRecords: %w", err)
 	}
-	bytesRead += types.LenInt32
-
-	strUnmarshaler := encoding.NewValueUnmarshaler[string]()
-	tlvUnmarshaler := encoding.NewTLVUnmarshaler(strUnmarshaler)
-
-	// ID
-	if err = tlvUnmarshaler.UnmarshalBinary(buf[bytesRead:]); err != nil {
-		return nil, fmt.Errorf("WAL.readLastEntry: val: %w", err)
-	}
-	bytesRead += len(tlvUnmarshaler.Value)
-	id := tlvUnmarshaler.Value
-
-	return &Entry{
-		Id:  id,
-		Len: length,
-	}, nil
+	return records, nil
 }
 
-func (w *WAL) getRestorableData(commitID string) ([]byte, error) {
-	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+// readLog reads the entries of the log up to the first incomplete one, and
+// returns them with the offset they end at.
+func (w *WAL) readLog() ([]*Record, int64, error) {
+	size, err := w.Size()
+	if err != nil {
+		return nil, 0, fmt.Errorf("WAL.readLog: %w", err)
 	}
-
-	r := platformio.NewReader(w.f)
-	commitIDFound := false
-	buf := bytes.Buffer{}
-	for {
-		t, err := r.ReadByte()
-		if err != nil {
-			if err == io.EOF {
-				return buf.Bytes(), nil
-			}
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+	records := make([]*Record, 0)
+	header := make([]byte, types.LenMeta)
+	var pos int64
+	for pos+types.LenMeta <= size {
+		if _, err := w.f.ReadAt(header, pos); err != nil {
+			return nil, 0, fmt.Errorf("WAL.readLog: %w", err)
 		}
-		if t != types.TypeWALEntry {
-			return nil, fmt.Errorf("WAL.getRestorableData: invalid type")
+		if header[0] != types.TypeWALEntry {
+			return nil, 0, fmt.Errorf("WAL.readLog: invalid type")
 		}
-
-		length, err := r.ReadUint32()
+		length := binary.LittleEndian.Uint32(header[types.LenByte:])
+		if pos+types.LenMeta+int64(length) > size {
+			break
+		}
+		body := make([]byte, length)
+		if _, err := w.f.ReadAt(body, pos+types.LenMeta); err != nil {
+			return nil, 0, fmt.Errorf("WAL.readLog: %w", err)
+		}
+		record, err := parseRecord(body)
 		if err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+			return nil, 0, fmt.Errorf("WAL.readLog: %w", err)
 		}
+		record.Len = length + types.LenMeta
+		records = append(records, record)
+		pos += int64(record.Len)
+	}
+	return records, pos, nil
+}
 
-		tlvParser := parser.NewTLVParser(r)
+// parseRecord decodes the body of an entry: its LSN, operation and table
+// followed by the data of the operation.
+func parseRecord(body []byte) (*Record, error) {
+	tlvParser := parser.NewTLVParser(platformio.NewReader(bytes.NewReader(body)))
+	val, err := tlvParser.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("WAL.parseRecord: %w", err)
+	}
+	lsn, ok := val.(int64)
+	if !ok {
+		return nil, fmt.Errorf("WAL.parseRecord: invalid LSN: %v", val)
+	}
+	fields := make([]string, 2)
+	consumed := types.LenMeta + types.LenInt64
+	for i := range fields {
 		val, err := tlvParser.Parse()
-		id := val.(string)
-
 		if err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+			return nil, fmt.Errorf("WAL.parseRecord: %w", err)
 		}
-
-		if id == commitID {
-			commitIDFound = true
-			if err = w.skipEntry(id, length); err != nil {
-				return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
-			}
-			continue
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("WAL.parseRecord: invalid field: %v", val)
 		}
+		fields[i] = s
+		consumed += types.LenMeta + len(s)
+	}
+	return &Record{
+		Entry: &Entry{LSN: lsn},
+		Op:    fields[0],
+		Table: fields[1],
+		Data:  body[consumed:],
+	}, nil
+}
 
-		// We are before the commit ID so entry can be skipped entirely
-		if !commitIDFound {
-			if err = w.skipEntry(id, length); err != nil {
-				return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
-			}
-			continue
+// Add decodes the data of an operation and adds it to r.
+func (r *RestorableData) Add(op string, data []byte) error {
+	reader := platformio.NewReader(bytes.NewReader(data))
+	tlvParser := parser.NewTLVParser(reader)
+	buf := bytes.NewBuffer(r.Data)
+	defer func() {
+		r.Data = buf.Bytes()
+	}()
+
+	count := int64(1)
+	switch op {
+	case walencoding.OpInsert:
+	case walencoding.OpInsertBatch, walencoding.OpUpdate:
+		val, err := tlvParser.Parse()
+		if err != nil {
+			return fmt.Errorf("RestorableData.Add: %w", err)
 		}
-
-		// We are after the commit so this entry needs to be restored
-
-		// op
-		val, err = tlvParser.Parse()
-		op := val.(string)
-		if op != walencoding.OpInsert {
-			return nil, fmt.Errorf("WAL.getRestorableData: unspoorted operation: %s", op)
+		size, _ := val.(int64)
+		if r.Base == 0 && buf.Len() == 0 {
+			r.Base = size
 		}
-
-		// table
-		val, err = tlvParser.Parse()
-
-		// data
-		t, err = r.ReadByte()
+		fallthrough
+	case walencoding.OpDelete:
+		val, err := tlvParser.Parse()
 		if err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+			return fmt.Errorf("RestorableData.Add: %w", err)
 		}
-		if t != types.TypeRecord {
-			return nil, fmt.Errorf("WAL.getRestorableData: invalid type: %d, %d was expected", t, types.TypeRecord)
+		count, _ = val.(int64)
+	default:
+		return fmt.Errorf("RestorableData.Add: unsupported operation: %s", op)
+	}
+	for i := int64(0); i < count; i++ {
+		var err error
+		switch op {
+		case walencoding.OpUpdate:
+			err = readUpdate(reader, tlvParser, r, buf)
+		case walencoding.OpDelete:
+			err = readDelete(reader, tlvParser, r)
+		default:
+			err = readRecord(reader, buf)
 		}
-
-		length, err = r.ReadUint32()
 		if err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
-		}
-
-		buf.WriteByte(t)
-		if err = binary.Write(&buf, binary.LittleEndian, length); err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
+			return fmt.Errorf("RestorableData.Add: %w", err)
 		}
+	}
+	return nil
+}
 
-		record := make([]byte, length)
-		if _, err = r.Read(record); err != nil {
-			return nil, fmt.Errorf("WAL.getRestorableData: %w", err)
-		}
-		buf.Write(record)
+// readUpdate reads one updated record of an OpUpdate entry and adds it to
+// restorable.
+func readUpdate(r *platformio.Reader, tlvParser *parser.TLVParser, restorable *RestorableData, buf *bytes.Buffer) error {
+	val, err := tlvParser.Parse()
+	if err != nil {
+		return fmt.Errorf("WAL.readUpdate: %w", err)
 	}
+	offset, ok := val.(int64)
+	if !ok {
+		return fmt.Errorf("WAL.readUpdate: invalid offset: %v", val)
+	}
+	before, after := bytes.Buffer{}, bytes.Buffer{}
+	if err = readRecord(r, &before); err != nil {
+		return fmt.Errorf("WAL.readUpdate: %w", err)
+	}
+	if err = readRecord(r, &after); err != nil {
+		return fmt.Errorf("WAL.readUpdate: %w", err)
+	}
+	restorable.Befores = append(restorable.Befores, Overwrite{Offset: offset, Data: before.Bytes()})
+	if after.Len() == before.Len() {
+		restorable.Overwrites = append(restorable.Overwrites, Overwrite{Offset: offset, Data: after.Bytes()})
+		return nil
+	}
+	restorable.Deleted = append(restorable.Deleted, offset)
+	buf.Write(after.Bytes())
+	return nil
 }
 
-func (w *WAL) skipEntry(id string, length uint32) error {
-	// Seek back to the beginning of the ID
-	if _, err := w.f.Seek(-1*(int64(len(id)+types.LenByte+types.LenInt32)), io.SeekCurrent); err != nil {
-		return fmt.Errorf("WAL.skipEntry: %w", err)
+// readDelete reads one deleted record of an OpDelete entry and adds it to
+// restorable.
+func readDelete(r *platformio.Reader, tlvParser *parser.TLVParser, restorable *RestorableData) error {
+	val, err := tlvParser.Parse()
+	if err != nil {
+		return fmt.Errorf("WAL.readDelete: %w", err)
 	}
-	// Skip current entry
-	if _, err := w.f.Seek(int64(length), io.SeekCurrent); err != nil {
-		return fmt.Errorf("WAL.skipEntry: %w", err)
+	offset, ok := val.(int64)
+	if !ok {
+		return fmt.Errorf("WAL.readDelete: invalid offset: %v", val)
 	}
+	before := bytes.Buffer{}
+	if err = readRecord(r, &before); err != nil {
+		return fmt.Errorf("WAL.readDelete: %w", err)
+	}
+	restorable.Befores = append(restorable.Befores, Overwrite{Offset: offset, Data: before.Bytes()})
+	restorable.Deleted = append(restorable.Deleted, offset)
 	return nil
 }
 
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	_, err := rand.Read(b)
+// readRecord copies the record starting at the current position of r to buf.
+func readRecord(r *platformio.Reader, buf *bytes.Buffer) error {
+	t, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("WAL.readRecord: %w", err)
+	}
+	if t != types.TypeRecord {
+		return fmt.Errorf("WAL.readRecord: invalid type: %d, %d was expected", t, types.TypeRecord)
+	}
+
+	length, err := r.ReadUint32()
 	if err != nil {
-		return "", fmt.Errorf("wal.generateID: %w", err)
+		return fmt.Errorf("WAL.readRecord: %w", err)
+	}
+
+	buf.WriteByte(t)
+	if err = binary.Write(buf, binary.LittleEndian, length); err != nil {
+		return fmt.Errorf("WAL.readRecord: %w", err)
+	}
+
+	record := make([]byte, length)
+	if _, err = r.Read(record); err != nil {
+		return fmt.Errorf("WAL.readRecord: %w", err)
 	}
-	return hex.EncodeToString(b), nil
+	buf.Write(record)
+	return nil
 }
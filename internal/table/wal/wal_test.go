@@ -3,9 +3,10 @@ package wal
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/9bany/db/internal/platform/parser/encoding"
 	"github.com/9bany/db/internal/platform/types"
@@ -29,8 +30,9 @@ func TestWAL(t *testing.T) {
 	entry, err := wal.AppendLog("insert", "tb_user", []byte{1, 2, 3, 4})
 	assert.Nil(t, err)
 	assert.NotNil(t, entry)
-	assert.NotEmpty(t, entry.Id)
-	assert.Equal(t, uint32(4), entry.Len)
+	assert.Equal(t, int64(1), entry.LSN)
+	// the encoded entry: its header followed by the 4 bytes of data
+	assert.Equal(t, uint32(45), entry.Len)
 
 	err = wal.Commit(entry)
 	assert.Nil(t, err)
@@ -105,8 +107,8 @@ func TestWALRestore(t *testing.T) {
 		entry, err := wal.AppendLog("insert", "tb_user", data)
 		assert.Nil(t, err)
 		assert.NotNil(t, entry)
-		assert.NotEmpty(t, entry.Id)
-		assert.Equal(t, uint32(79), entry.Len)
+		assert.Equal(t, int64(1), entry.LSN)
+		assert.Equal(t, uint32(55), entry.Len)
 
 		err = wal.Commit(entry)
 		assert.Nil(t, err)
@@ -121,13 +123,165 @@ func TestWALRestore(t *testing.T) {
 	entry2, err := wal.AppendLog("insert", "tb_user", data)
 	assert.Nil(t, err)
 	assert.NotNil(t, entry2)
-	assert.NotEmpty(t, entry2.Id)
-	assert.Equal(t, uint32(79), entry2.Len)
+	assert.Equal(t, int64(2), entry2.LSN)
+	assert.Equal(t, uint32(55), entry2.Len)
 	// let restore
 	restorableData, err := wal.GetRestorableData()
 
 	assert.Nil(t, err)
 	assert.NotNil(t, restorableData)
-	log.Println(restorableData)
 	assert.Equal(t, []byte{100, 9, 0, 0, 0, 5, 4, 0, 0, 0, 3, 0, 0, 0}, restorableData.Data)
 }
+
+func TestWALCheckpoint(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		entry, err := w.AppendLog("insert", "tb_user", data)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Commit(entry))
+	}
+	// one entry logged but not applied yet
+	_, err = w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+
+	lsn, err := w.Checkpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), lsn)
+	checkpoint, err := w.CheckpointLSN()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), checkpoint)
+
+	pending, err := w.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, int64(4), pending[0].LSN)
+	size, err := w.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(pending[0].Len), size)
+
+	entry, err := w.AppendLog("insert", "tb_user", data)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), entry.LSN)
+}
+
+func TestWALCheckpointPolicy(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+	checkpoints := 0
+	w.SetCheckpointPolicy(CheckpointPolicy{MaxSize: 100}, func() error {
+		checkpoints++
+		_, err := w.Checkpoint()
+		return err
+	})
+
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		entry, err := w.AppendLog("insert", "tb_user", data)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Commit(entry))
+	}
+	// entries are 55 bytes, the log is truncated every second commit
+	assert.Equal(t, 2, checkpoints)
+	size, err := w.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), size)
+}
+
+func TestParseDurability(t *testing.T) {
+	mode, err := ParseDurability("group")
+	assert.Nil(t, err)
+	assert.Equal(t, DurabilityGroup, mode)
+
+	_, err = ParseDurability("sometimes")
+	assert.ErrorAs(t, err, new(*UnknownDurabilityError))
+}
+
+func TestWALDurability(t *testing.T) {
+	dir := t.TempDir()
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+
+	for _, mode := range []Durability{DurabilityAlways, DurabilityGroup, DurabilityInterval, DurabilityOff} {
+		t.Run(string(mode), func(t *testing.T) {
+			w, err := NewWal(dir, string(mode))
+			assert.Nil(t, err)
+			policy := DefaultDurabilityPolicy
+			policy.Mode = mode
+			assert.Nil(t, w.SetDurability(policy))
+
+			table, err := os.Create(dir + "/" + string(mode) + ".bin")
+			assert.Nil(t, err)
+			defer table.Close()
+
+			entry, err := w.AppendLog("insert", "tb_user", data)
+			assert.Nil(t, err)
+			w.Dirty(table)
+			assert.Nil(t, w.Commit(entry))
+
+			// always and group sync the dirty tables before committing
+			synced := len(w.syncer.dirty) == 0
+			assert.Equal(t, mode == DurabilityAlways || mode == DurabilityGroup, synced)
+			lsn, err := w.lastCommittedLSN()
+			assert.Nil(t, err)
+			assert.Equal(t, entry.LSN, lsn)
+			assert.Nil(t, w.Close())
+		})
+	}
+
+	w, err := NewWal(dir, "db")
+	assert.Nil(t, err)
+	err = w.SetDurability(DurabilityPolicy{Mode: "sometimes"})
+	assert.ErrorAs(t, err, new(*UnknownDurabilityError))
+}
+
+func TestWALGroupCommit(t *testing.T) {
+	w, err := NewWal(t.TempDir(), "db")
+	assert.Nil(t, err)
+	assert.Nil(t, w.SetDurability(DurabilityPolicy{Mode: DurabilityGroup, Window: 20 * time.Millisecond}))
+
+	data, err := dataByteRecord(map[string]interface{}{"id": int32(1)})
+	assert.Nil(t, err)
+	entries := make([]*Entry, 8)
+	for i := range entries {
+		entries[i], err = w.AppendLog("insert", "tb_user", data)
+		assert.Nil(t, err)
+	}
+
+	wg := sync.WaitGroup{}
+	for _, entry := range entries {
+		wg.Add(1)
+		go func(entry *Entry) {
+			defer wg.Done()
+			assert.Nil(t, w.Commit(entry))
+		}(entry)
+	}
+	wg.Wait()
+
+	// concurrent commits share syncs
+	syncs := w.syncer.batch - 1
+	assert.Less(t, syncs, uint64(len(entries)))
+	assert.Equal(t, syncs, w.syncer.done)
+}
+
+func TestWALIntervalDurability(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWal(dir, "db")
+	assert.Nil(t, err)
+	assert.Nil(t, w.SetDurability(DurabilityPolicy{Mode: DurabilityInterval, Interval: 5 * time.Millisecond}))
+	defer w.Close()
+
+	table, err := os.Create(dir + "/tb_user.bin")
+	assert.Nil(t, err)
+	defer table.Close()
+	w.Dirty(table)
+	assert.Eventually(t, func() bool {
+		w.syncer.mu.Lock()
+		defer w.syncer.mu.Unlock()
+		return len(w.syncer.dirty) == 0
+	}, time.Second, 5*time.Millisecond)
+}
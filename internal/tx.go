@@ -0,0 +1,337 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/lock"
+	"github.com/9bany/db/internal/table/mvcc"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+)
+
+// Tx is a group of changes to several tables committed atomically. Changes
+// are buffered until Commit and are seen by the reads of the transaction
+// only. The transaction runs under snapshot isolation: it reads the tables
+// as they were committed when it began, and its commit fails with a
+// table.WriteConflictError when a record it changes was changed by another
+// commit since.
+//
+// The transaction takes an intention lock on every table it uses and an
+// exclusive lock on every record it changes, held until it ends. A lock
+// request failing on timeout or deadlock aborts the transaction with an
+// error lock.IsRetryable reports.
+//
+// Savepoints mark the changes made so far so the later ones can be undone
+// with RollbackTo without aborting the transaction. A savepoint is logged
+// to the database log and so is how to undo every statement run while one
+// is set. RollbackTo reads the undo entries logged since the savepoint back
+// from the log and replays them, the latest first. The entries of the
+// transaction are left out of recovery.
+type Tx struct {
+	db *Database
+	// id is the writer of the changes and the owner of the locks
+	id         int64
+	snapshot   *mvcc.Snapshot
+	changes    map[string]*table.Changes
+	savepoints []*savepoint
+	// logged holds the savepoint and undo entries logged by the transaction
+	logged []*wal.Entry
+	done   bool
+}
+
+// savepoint is a named savepoint entry of a transaction.
+type savepoint struct {
+	name string
+	lsn  int64
+}
+
+// Begin starts a transaction.
+func (db *Database) Begin() (*Tx, error) {
+	id := db.txs.Begin()
+	return &Tx{
+		db:       db,
+		id:       id,
+		snapshot: db.txs.Snapshot(),
+		changes:  make(map[string]*table.Changes),
+	}, nil
+}
+
+// Savepoint marks the changes made so far under name. A name used again
+// hides the older savepoint until the newer one is released.
+func (tx *Tx) Savepoint(name string) error {
+	if tx.done {
+		return fmt.Errorf("Tx.Savepoint: %w", NewTxDoneError())
+	}
+	entry, err := tx.db.wal.LogSavepoint(tx.id, tx.db.name)
+	if err != nil {
+		return fmt.Errorf("Tx.Savepoint: %w", err)
+	}
+	tx.logged = append(tx.logged, entry)
+	tx.savepoints = append(tx.savepoints, &savepoint{name: name, lsn: entry.LSN})
+	for tableName, c := range tx.changes {
+		c.SetUndoLog(tx.undoLog(tableName))
+	}
+	return nil
+}
+
+// RollbackTo undoes the changes made since the savepoint name. The
+// savepoint is kept, the ones set after it are discarded. Locks taken since
+// the savepoint are held until the transaction ends.
+func (tx *Tx) RollbackTo(name string) error {
+	if tx.done {
+		return fmt.Errorf("Tx.RollbackTo: %w", NewTxDoneError())
+	}
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return fmt.Errorf("Tx.RollbackTo: %w", err)
+	}
+	sp := tx.savepoints[i]
+	undo, err := tx.db.wal.UndoEntries(tx.id, sp.lsn)
+	if err != nil {
+		return fmt.Errorf("Tx.RollbackTo: %w", err)
+	}
+	for _, record := range undo {
+		c, ok := tx.changes[record.Table]
+		if !ok {
+			return fmt.Errorf("Tx.RollbackTo: %w", NewTableDoesNotExistError(record.Table))
+		}
+		if err := c.Revert(record.Data); err != nil {
+			return fmt.Errorf("Tx.RollbackTo: table %s: %w", record.Table, err)
+		}
+	}
+	entry, err := tx.db.wal.LogRollbackTo(tx.id, tx.db.name, sp.lsn)
+	if err != nil {
+		return fmt.Errorf("Tx.RollbackTo: %w", err)
+	}
+	tx.logged = append(tx.logged, entry)
+	tx.savepoints = tx.savepoints[:i+1]
+	return nil
+}
+
+// Release discards the savepoint name and the ones set after it, keeping
+// their changes.
+func (tx *Tx) Release(name string) error {
+	if tx.done {
+		return fmt.Errorf("Tx.Release: %w", NewTxDoneError())
+	}
+	i, err := tx.findSavepoint(name)
+	if err != nil {
+		return fmt.Errorf("Tx.Release: %w", err)
+	}
+	tx.savepoints = tx.savepoints[:i]
+	if len(tx.savepoints) == 0 {
+		for _, c := range tx.changes {
+			c.SetUndoLog(nil)
+		}
+	}
+	return nil
+}
+
+// findSavepoint returns the position of the latest savepoint named name.
+func (tx *Tx) findSavepoint(name string) (int, error) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, NewSavepointDoesNotExistError(name)
+}
+
+func (tx *Tx) Insert(tableName string, record map[string]interface{}) (int, error) {
+	c, err := tx.tableChanges(tableName, lock.IntentionExclusive)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Insert: %w", err)
+	}
+	n, err := c.Insert(record)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Insert: %w", err)
+	}
+	return n, nil
+}
+
+func (tx *Tx) Select(tableName string, whereStmt predicate.Predicate) ([]map[string]interface{}, error) {
+	c, err := tx.tableChanges(tableName, lock.IntentionShared)
+	if err != nil {
+		return nil, fmt.Errorf("Tx.Select: %w", err)
+	}
+	records, err := c.Select(whereStmt)
+	if err != nil {
+		return nil, fmt.Errorf("Tx.Select: %w", err)
+	}
+	return records, nil
+}
+
+func (tx *Tx) Update(tableName string, whereStmt predicate.Predicate, values map[string]interface{}) (int, error) {
+	c, err := tx.tableChanges(tableName, lock.IntentionExclusive)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Update: %w", err)
+	}
+	n, err := c.Update(whereStmt, values)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Update: %w", tx.abortOnLockError(err))
+	}
+	return n, nil
+}
+
+func (tx *Tx) Delete(tableName string, whereStmt predicate.Predicate) (int, error) {
+	c, err := tx.tableChanges(tableName, lock.IntentionExclusive)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Delete: %w", err)
+	}
+	n, err := c.Delete(whereStmt)
+	if err != nil {
+		return 0, fmt.Errorf("Tx.Delete: %w", tx.abortOnLockError(err))
+	}
+	return n, nil
+}
+
+// Commit makes the changes of the transaction durable. Every table is
+// checked first, then the changes of all tables are logged as a single
+// entry of the database log. Once logged the transaction is committed: the
+// changes are applied to the tables and redone on open if applying them
+// was interrupted. Should applying them fail, they are rolled back in every
+// table and Commit fails. The transaction is over whether Commit succeeds
+// or not.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("Tx.Commit: %w", NewTxDoneError())
+	}
+	defer tx.end()
+
+	names := make([]string, 0, len(tx.changes))
+	for name, c := range tx.changes {
+		if !c.Empty() {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tx.changes[name].Lock()
+		defer tx.changes[name].Unlock()
+	}
+
+	ops := make([]wal.Operation, 0)
+	for _, name := range names {
+		tableOps, err := tx.changes[name].Prepare()
+		if err != nil {
+			return fmt.Errorf("Tx.Commit: table %s: %w", name, err)
+		}
+		ops = append(ops, tableOps...)
+	}
+	data, err := wal.MarshalOperations(ops)
+	if err != nil {
+		return fmt.Errorf("Tx.Commit: %w", err)
+	}
+	entry, err := tx.db.wal.AppendLog(walencoding.OpTx, tx.db.name, data)
+	if err != nil {
+		return fmt.Errorf("Tx.Commit: %w", err)
+	}
+	for _, name := range names {
+		if err := tx.changes[name].Apply(tx.id, entry.LSN); err != nil {
+			return fmt.Errorf("Tx.Commit: table %s: %w", name, tx.abort(entry, names, err))
+		}
+	}
+	if err := tx.db.wal.Commit(entry); err != nil {
+		return fmt.Errorf("Tx.Commit: %w", err)
+	}
+	return nil
+}
+
+// abort rolls back the changes of the tables names once applying entry
+// failed with cause, and returns cause. The rollback is logged as an abort
+// entry. Should the rollback fail too, both entries are left to recovery.
+func (tx *Tx) abort(entry *wal.Entry, names []string, cause error) error {
+	abort, err := tx.db.wal.Abort(entry, tx.db.name)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	for _, name := range names {
+		if err := tx.changes[name].Undo(tx.id, entry.LSN, abort.LSN); err != nil {
+			return errors.Join(cause, err)
+		}
+	}
+	if err := tx.db.wal.Commit(abort); err != nil {
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+// Rollback discards the changes of the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return fmt.Errorf("Tx.Rollback: %w", NewTxDoneError())
+	}
+	tx.end()
+	return nil
+}
+
+// end releases the snapshot, the locks and the savepoint and undo entries
+// of the transaction once it is over.
+func (tx *Tx) end() {
+	tx.done = true
+	tx.db.wal.Forget(tx.logged)
+	tx.db.txs.End(tx.id)
+	tx.db.txs.Release(tx.snapshot)
+	tx.db.locks.ReleaseAll(tx.id)
+	for name := range tx.changes {
+		tx.db.Tables[name].CollectGarbage()
+	}
+	tx.changes = nil
+	tx.savepoints = nil
+	tx.logged = nil
+}
+
+// abortOnLockError ends the transaction when err is a failed lock request.
+func (tx *Tx) abortOnLockError(err error) error {
+	if lock.IsRetryable(err) {
+		tx.end()
+	}
+	return err
+}
+
+// tableChanges returns the changes to the table name after locking it in
+// mode.
+func (tx *Tx) tableChanges(name string, mode lock.Mode) (*table.Changes, error) {
+	if tx.done {
+		return nil, NewTxDoneError()
+	}
+	t, ok := tx.db.Tables[name]
+	if !ok {
+		return nil, NewTableDoesNotExistError(name)
+	}
+	if err := tx.db.locks.LockTable(tx.id, name, mode); err != nil {
+		return nil, tx.abortOnLockError(err)
+	}
+	if c, ok := tx.changes[name]; ok {
+		return c, nil
+	}
+	c := t.NewChanges(tx.snapshot)
+	c.SetRowLock(func(offset int64) error {
+		return tx.db.locks.LockRow(tx.id, name, offset, lock.Exclusive)
+	})
+	if len(tx.savepoints) > 0 {
+		c.SetUndoLog(tx.undoLog(name))
+	}
+	tx.changes[name] = c
+	return c, nil
+}
+
+// undoLog returns the undo log of the changes to the table name, logging
+// how to undo their statements as undo entries of the transaction.
+func (tx *Tx) undoLog(name string) func(data []byte) error {
+	return func(data []byte) error {
+		entry, err := tx.db.wal.LogUndo(tx.id, name, data)
+		if err != nil {
+			return err
+		}
+		tx.logged = append(tx.logged, entry)
+		return nil
+	}
+}
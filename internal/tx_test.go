@@ -0,0 +1,360 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/9bany/db/internal/table"
+	"github.com/9bany/db/internal/table/lock"
+	"github.com/9bany/db/internal/table/predicate"
+	"github.com/9bany/db/internal/table/wal"
+	walencoding "github.com/9bany/db/internal/table/wal/encoding"
+	"github.com/stretchr/testify/assert"
+)
+
+func selectTxIDs(rows []map[string]interface{}) []int32 {
+	ids := make([]int32, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row["id"].(int32))
+	}
+	return ids
+}
+
+func TestTx_CommitAcrossTables(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	n, err := tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = tx.Update("orders", predicate.Eq("id", int32(12)), map[string]interface{}{"user_id": int32(4)})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = tx.Delete("orders", predicate.Eq("user_id", int32(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	// the transaction reads its own changes, the tables do not see them yet
+	rows, err := tx.Select("orders", predicate.Eq("user_id", int32(4)))
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{12}, selectTxIDs(rows))
+	rows, err = tx.Select("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4}, selectTxIDs(rows))
+	rows, err = db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{10, 11, 12}, selectTxIDs(rows))
+
+	assert.Nil(t, tx.Commit())
+	assert.ErrorAs(t, tx.Commit(), new(*TxDoneError))
+
+	rows, err = db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{12}, selectTxIDs(rows))
+	assert.Equal(t, int32(4), rows[0]["user_id"])
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err = reopened.Tables["users"].Select(predicate.Eq("id", int32(4)))
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{4}, selectTxIDs(rows))
+	rows, err = reopened.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{12}, selectTxIDs(rows))
+}
+
+func TestTx_Rollback(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	_, err = tx.Delete("orders", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Rollback())
+
+	_, err = tx.Select("users", nil)
+	assert.ErrorAs(t, err, new(*TxDoneError))
+	rows, err := db.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, selectTxIDs(rows))
+	rows, err = db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+}
+
+func TestTx_Savepoints(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Savepoint("record"))
+	_, err = tx.Update("users", predicate.Eq("id", int32(2)), map[string]interface{}{"name": "alisa"})
+	assert.Nil(t, err)
+	_, err = tx.Delete("users", predicate.Eq("id", int32(4)))
+	assert.Nil(t, err)
+	// orders were not changed before the savepoint
+	_, err = tx.Delete("orders", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Savepoint("inner"))
+	_, err = tx.Delete("users", nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, tx.RollbackTo("record"))
+	rows, err := tx.Select("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4}, selectTxIDs(rows))
+	assert.Equal(t, "alice", rows[1]["name"])
+	rows, err = tx.Select("orders", nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+	assert.ErrorAs(t, tx.RollbackTo("inner"), new(*SavepointDoesNotExistError))
+
+	// the savepoint survives its rollback until released
+	_, err = tx.Update("users", predicate.Eq("id", int32(3)), map[string]interface{}{"name": "bobby"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Release("record"))
+	assert.ErrorAs(t, tx.RollbackTo("record"), new(*SavepointDoesNotExistError))
+	assert.Nil(t, tx.Commit())
+
+	rows, err = db.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4}, selectTxIDs(rows))
+	assert.Equal(t, "alice", rows[1]["name"])
+	assert.Equal(t, "bobby", rows[2]["name"])
+	rows, err = db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+}
+
+func TestTx_RollbackToReplaysTheLog(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	before, err := db.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Savepoint("outer"))
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Savepoint("inner"))
+	_, err = tx.Update("users", predicate.Eq("id", int32(1)), map[string]interface{}{"name": "al"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.RollbackTo("inner"))
+	_, err = tx.Delete("users", predicate.Eq("id", int32(2)))
+	assert.Nil(t, err)
+
+	// every statement run under a savepoint is logged with how to undo it
+	pending, err := db.wal.Pending()
+	assert.Nil(t, err)
+	undo := 0
+	for _, record := range pending {
+		if record.Op == walencoding.OpUndo {
+			undo++
+		}
+	}
+	assert.Equal(t, 3, undo)
+
+	// the update already rolled back is not undone twice
+	assert.Nil(t, tx.RollbackTo("outer"))
+	rows, err := tx.Select("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, before, rows)
+	assert.Nil(t, tx.Rollback())
+
+	// the entries of the transaction are not recovered
+	tx, err = db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(5), "name": "dave"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+	pending, err = db.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestTx_RecoverySkipsSavepointEntries(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Savepoint("record"))
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	// the database goes away with the transaction running
+	assert.Nil(t, db.Close())
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err := reopened.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, selectTxIDs(rows))
+	pending, err := reopened.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestTx_UniqueViolationAbortsEveryTable(t *testing.T) {
+	db := newJoinTestDatabase(t)
+	assert.Nil(t, db.Tables["users"].CreateIndex("id", true))
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Delete("orders", nil)
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(1), "name": "again"})
+	assert.Nil(t, err)
+	assert.NotNil(t, tx.Commit())
+
+	rows, err := db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3)
+
+	// a key freed by the same transaction can be reused
+	tx, err = db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Delete("users", predicate.Eq("id", int32(1)))
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(1), "name": "again"})
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+
+	rows, err = db.Tables["users"].LookupIndex("id", int32(1))
+	assert.Nil(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "again", rows[0]["name"])
+}
+
+func TestTx_RedoOnOpen(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = tx.Insert("users", map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	_, err = tx.Update("users", predicate.Eq("id", int32(2)), map[string]interface{}{"name": "alisa"})
+	assert.Nil(t, err)
+	_, err = tx.Delete("orders", predicate.Eq("id", int32(10)))
+	assert.Nil(t, err)
+
+	// log the transaction and crash before applying it
+	ops := make([]wal.Operation, 0)
+	for _, name := range []string{"orders", "users"} {
+		tableOps, err := tx.changes[name].Prepare()
+		assert.Nil(t, err)
+		ops = append(ops, tableOps...)
+	}
+	data, err := wal.MarshalOperations(ops)
+	assert.Nil(t, err)
+	_, err = db.wal.AppendLog(walencoding.OpTx, db.name, data)
+	assert.Nil(t, err)
+
+	reopened, err := NewDatabase("jointestdb")
+	assert.Nil(t, err)
+	rows, err := reopened.Tables["users"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3, 4}, selectTxIDs(rows))
+	assert.Equal(t, "alisa", rows[1]["name"])
+	rows, err = reopened.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{11, 12}, selectTxIDs(rows))
+
+	// the redone transaction is committed and not redone again
+	pending, err := reopened.wal.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestTx_SnapshotIsolation(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	tx, err := db.Begin()
+	assert.Nil(t, err)
+	// committed after the transaction began
+	_, err = db.Tables["users"].Insert(map[string]interface{}{"id": int32(4), "name": "carol"})
+	assert.Nil(t, err)
+	_, err = db.Tables["orders"].Update(predicate.Eq("id", int32(10)), map[string]interface{}{"user_id": int32(3)})
+	assert.Nil(t, err)
+
+	rows, err := tx.Select("users", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, selectTxIDs(rows))
+	rows, err = tx.Select("orders", predicate.Eq("user_id", int32(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{10, 11}, selectTxIDs(rows))
+
+	// changing records nobody else changed commits
+	_, err = tx.Delete("orders", predicate.Eq("id", int32(11)))
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Commit())
+	rows, err = db.Tables["orders"].Select(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []int32{10, 12}, selectTxIDs(rows))
+}
+
+func TestTx_WriteConflict(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	first, err := db.Begin()
+	assert.Nil(t, err)
+	second, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = first.Update("orders", predicate.Eq("id", int32(10)), map[string]interface{}{"user_id": int32(2)})
+	assert.Nil(t, err)
+
+	// the record is locked by the first transaction until it ends
+	deleted := make(chan error, 1)
+	go func() {
+		_, err := second.Delete("orders", predicate.Eq("id", int32(10)))
+		deleted <- err
+	}()
+	assert.Eventually(t, func() bool { return db.locks.Waiting(second.id) }, time.Second, time.Millisecond)
+
+	// the first committer wins
+	assert.Nil(t, first.Commit())
+	assert.Nil(t, <-deleted)
+	assert.ErrorAs(t, second.Commit(), new(*table.WriteConflictError))
+
+	rows, err := db.Tables["orders"].Select(predicate.Eq("id", int32(10)))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), rows[0]["user_id"])
+}
+
+func TestTx_Deadlock(t *testing.T) {
+	db := newJoinTestDatabase(t)
+
+	first, err := db.Begin()
+	assert.Nil(t, err)
+	second, err := db.Begin()
+	assert.Nil(t, err)
+	_, err = first.Update("orders", predicate.Eq("id", int32(10)), map[string]interface{}{"user_id": int32(2)})
+	assert.Nil(t, err)
+	_, err = second.Update("orders", predicate.Eq("id", int32(11)), map[string]interface{}{"user_id": int32(2)})
+	assert.Nil(t, err)
+
+	updated := make(chan error, 1)
+	go func() {
+		_, err := first.Update("orders", predicate.Eq("id", int32(11)), map[string]interface{}{"user_id": int32(3)})
+		updated <- err
+	}()
+	assert.Eventually(t, func() bool { return db.locks.Waiting(first.id) }, time.Second, time.Millisecond)
+
+	// the younger transaction is the victim and is rolled back
+	_, err = second.Update("orders", predicate.Eq("id", int32(10)), map[string]interface{}{"user_id": int32(3)})
+	assert.ErrorAs(t, err, new(*lock.DeadlockError))
+	assert.True(t, lock.IsRetryable(err))
+	assert.ErrorAs(t, second.Commit(), new(*TxDoneError))
+
+	assert.Nil(t, <-updated)
+	assert.Nil(t, first.Commit())
+	rows, err := db.Tables["orders"].Select(predicate.Eq("id", int32(10)))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), rows[0]["user_id"])
+	rows, err = db.Tables["orders"].Select(predicate.Eq("id", int32(11)))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), rows[0]["user_id"])
+}